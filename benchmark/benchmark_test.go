@@ -1,30 +1,162 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"os"
 	"strings"
 	"testing"
 
+	tokencoder "github.com/currybab/tokgo/encoder"
+	"github.com/currybab/tokgo/encoding"
 	tokmod "github.com/currybab/tokgo/mod"
 	tokgo "github.com/currybab/tokgo/registry"
 )
 
 // go test -benchmem -run=^$ -bench ^BenchmarkEncodingInFullLanguage$ -benchtime=100000x github.com/currybab/tokgo/benchmark
 func BenchmarkEncodingInFullLanguage(b *testing.B) {
-	data, err := os.ReadFile("../tmp/udhr.txt")
+	benchmarkEncodingInFullLanguage(b, tokmod.GPT_4O)
+}
+
+// go test -benchmem -run=^$ -bench ^BenchmarkEncodingInFullLanguageCl100k$ -benchtime=100000x github.com/currybab/tokgo/benchmark
+func BenchmarkEncodingInFullLanguageCl100k(b *testing.B) {
+	benchmarkEncodingInFullLanguage(b, tokmod.GPT_4)
+}
+
+// go test -benchmem -run=^$ -bench ^BenchmarkEncodingInFullLanguageWithPieceCache$ -benchtime=100000x github.com/currybab/tokgo/benchmark
+func BenchmarkEncodingInFullLanguageWithPieceCache(b *testing.B) {
+	encoder := encoding.O200kBase().(*encoding.GptBytePairEncoding)
+	encoder.SetPieceCache(tokencoder.NewPieceCache(100_000, 64))
+	benchmarkEncodingInFullLanguageWith(b, encoder)
+	b.Logf("%+v", encoder.GetPieceCache().Stats())
+}
+
+func benchmarkEncodingInFullLanguage(b *testing.B, modelType tokmod.ModelType) {
+	encoder, err := tokgo.NewDefaultEncodingRegistry().GetEncodingForModelType(modelType)
 	if err != nil {
 		log.Fatal(err)
 	}
+	benchmarkEncodingInFullLanguageWith(b, encoder)
+}
 
-	lines := strings.Split(string(data), "\n")
-	encoder, err := tokgo.NewDefaultEncodingRegistry().GetEncodingForModelType(tokmod.GPT_4O)
-	lineCount := len(lines)
+func benchmarkEncodingInFullLanguageWith(b *testing.B, encoder tokmod.Encoding) {
+	data, err := os.ReadFile("../tmp/udhr.txt")
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	lines := strings.Split(string(data), "\n")
+	lineCount := len(lines)
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
 		encoder.EncodeOrdinaryToIntArray(lines[n%lineCount])
 	}
 }
+
+const asciiText = "The quick brown fox jumps over the lazy dog, antidisestablishmentarianism 12345!\n"
+
+// go test -benchmem -run=^$ -bench ^BenchmarkAppendEncodeAscii$ github.com/currybab/tokgo/benchmark
+func BenchmarkAppendEncodeAscii(b *testing.B) {
+	registry := tokgo.NewDefaultEncodingRegistry()
+	for _, encodingType := range tokmod.EncodingTypeValues() {
+		encoder, err := registry.GetEncodingByType(encodingType)
+		if err != nil {
+			log.Fatal(err)
+		}
+		appendEncoder := encoder.(tokmod.AppendEncoding)
+		b.Run(encodingType.GetName(), func(b *testing.B) {
+			dst := make([]int, 0, 100)
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				dst = appendEncoder.AppendEncode(dst[:0], asciiText)
+			}
+		})
+	}
+}
+
+// go test -benchmem -run=^$ -bench ^BenchmarkCountTokensAscii$ github.com/currybab/tokgo/benchmark
+func BenchmarkCountTokensAscii(b *testing.B) {
+	registry := tokgo.NewDefaultEncodingRegistry()
+	for _, encodingType := range tokmod.EncodingTypeValues() {
+		encoder, err := registry.GetEncodingByType(encodingType)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b.Run(encodingType.GetName(), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				encoder.CountTokens(asciiText)
+			}
+		})
+	}
+}
+
+// go test -benchmem -run=^$ -bench ^BenchmarkEncodingLongPieces$ github.com/currybab/tokgo/benchmark
+func BenchmarkEncodingLongPieces(b *testing.B) {
+	words := []string{
+		"antidisestablishmentarianismpneumonoultramicroscopicsilicovolcanoconiosis",
+		"Rindfleischetikettierungsüberwachungsaufgabenübertragungsgesetz",
+		"모든인간은태어날때부터자유로우며그존엄과권리에있어동등하다",
+		"すべての人間は生まれながらにして自由であり尊厳と権利とについて平等である",
+	}
+	text := strings.Repeat(strings.Join(words, " ")+" ", 4)
+	for _, modelType := range []tokmod.ModelType{tokmod.GPT_4, tokmod.GPT_4O} {
+		encoder, err := tokgo.NewDefaultEncodingRegistry().GetEncodingForModelType(modelType)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b.Run(modelType.GetName(), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				encoder.CountTokensOrdinary(text)
+			}
+		})
+	}
+}
+
+// go test -run=^$ -bench ^BenchmarkLargePieceThreshold$ github.com/currybab/tokgo/benchmark
+//
+// BenchmarkLargePieceThreshold merges single pieces of increasing length once with the quadratic merge
+// and once with the heap based merge. The default threshold is the length from which the heap is faster.
+func BenchmarkLargePieceThreshold(b *testing.B) {
+	random := rand.New(rand.NewSource(42))
+	letters := make([]byte, 2048)
+	for i := range letters {
+		letters[i] = byte('a' + random.Intn(26))
+	}
+	hangul := []rune(strings.Repeat("모든인간은태어날때부터자유로우며그존엄과권리에있어동등하다", 20))
+	for _, factory := range []struct {
+		name string
+		new  func(opts ...encoding.Option) tokmod.Encoding
+	}{
+		{"cl100k_base", encoding.Cl100kBase},
+		{"o200k_base", encoding.O200kBase},
+	} {
+		merges := []struct {
+			name    string
+			encoder tokmod.Encoding
+		}{
+			{"small", factory.new(encoding.WithLargePieceThreshold(math.MaxInt))},
+			{"large", factory.new(encoding.WithLargePieceThreshold(1))},
+		}
+		for _, length := range []int{64, 128, 160, 192, 224, 256, 512, 1024} {
+			for _, piece := range []struct {
+				name string
+				text string
+			}{
+				{"letters", string(letters[:length])},
+				{"hangul", string(hangul[:length/3])},
+			} {
+				for _, merge := range merges {
+					b.Run(fmt.Sprintf("%s/%s/%d/%s", factory.name, piece.name, length, merge.name), func(b *testing.B) {
+						for n := 0; n < b.N; n++ {
+							merge.encoder.CountTokensOrdinary(piece.text)
+						}
+					})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// Types of content parts.
+const (
+	PART_TEXT      = "text"
+	PART_IMAGE_URL = "image_url"
+)
+
+// ContentPart is a part of the content of a message, a text or an image.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL is an image input, a URL or a data URL.
+type ImageURL struct {
+	URL    string          `json:"url"`
+	Detail mod.ImageDetail `json:"detail,omitempty"`
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: PART_TEXT, Text: text}
+}
+
+// ImagePart returns an image content part.
+func ImagePart(url string, detail mod.ImageDetail) ContentPart {
+	return ContentPart{Type: PART_IMAGE_URL, ImageURL: &ImageURL{URL: url, Detail: detail}}
+}
+
+// Text returns the content of a message followed by its text parts.
+func (m *Message) Text() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+	var b strings.Builder
+	b.WriteString(m.Content)
+	for _, part := range m.Parts {
+		if part.Type == PART_TEXT {
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String()
+}
+
+// MarshalJSON writes the parts of a message as its content if it has any.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	if len(m.Parts) == 0 {
+		return json.Marshal(message(m))
+	}
+	return json.Marshal(struct {
+		message
+		Content []ContentPart `json:"content"`
+	}{message(m), m.Parts})
+}
+
+// UnmarshalJSON reads a content that is a string, null or a list of parts.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	var fields struct {
+		message
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*m = Message(fields.message)
+	content := bytes.TrimSpace(fields.Content)
+	switch {
+	case len(content) == 0 || string(content) == "null":
+		return nil
+	case content[0] == '[':
+		return json.Unmarshal(content, &m.Parts)
+	default:
+		return json.Unmarshal(content, &m.Content)
+	}
+}
+
+// CountOption configures CountRequest.
+type CountOption func(*countOptions)
+
+type countOptions struct {
+	imageCost *mod.ImageCost
+	imageSize func(url string) (width int, height int, err error)
+}
+
+// WithImageCost prices the image parts of the messages, CountRequest fails for images without it.
+func WithImageCost(cost mod.ImageCost) CountOption {
+	return func(o *countOptions) {
+		o.imageCost = &cost
+	}
+}
+
+// WithModel prices the image parts like model does, if it accepts images.
+func WithModel(model mod.ModelType) CountOption {
+	return func(o *countOptions) {
+		if cost, ok := model.GetImageCost(); ok {
+			o.imageCost = &cost
+		}
+	}
+}
+
+// WithImageSize returns the size of the images that aren't data URLs, which CountRequest can't read.
+func WithImageSize(imageSize func(url string) (width int, height int, err error)) CountOption {
+	return func(o *countOptions) {
+		o.imageSize = imageSize
+	}
+}
+
+// imageTokens returns the tokens of the image parts of messages.
+func (o *countOptions) imageTokens(messages []Message) (int, error) {
+	count := 0
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if part.Type != PART_IMAGE_URL {
+				continue
+			}
+			if part.ImageURL == nil {
+				return 0, fmt.Errorf("image part without image_url")
+			}
+			if o.imageCost == nil {
+				return 0, fmt.Errorf("no image cost to count the image %s", abbreviate(part.ImageURL.URL))
+			}
+			detail := part.ImageURL.Detail
+			if detail == mod.IMAGE_DETAIL_LOW {
+				count += o.imageCost.BaseTokens
+				continue
+			}
+			width, height, err := o.size(part.ImageURL.URL)
+			if err != nil {
+				return 0, fmt.Errorf("size of the image %s: %w", abbreviate(part.ImageURL.URL), err)
+			}
+			count += o.imageCost.Tokens(width, height, detail)
+		}
+	}
+	return count, nil
+}
+
+// size returns the size of an image, decoded from the header of a data URL or given by WithImageSize.
+func (o *countOptions) size(url string) (int, int, error) {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		_, data, ok := strings.Cut(rest, ";base64,")
+		if !ok {
+			return 0, 0, fmt.Errorf("data URL is not base64 encoded")
+		}
+		config, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+		if err != nil {
+			return 0, 0, err
+		}
+		return config.Width, config.Height, nil
+	}
+	if o.imageSize == nil {
+		return 0, 0, fmt.Errorf("unknown, see WithImageSize")
+	}
+	return o.imageSize(url)
+}
+
+// abbreviate shortens a URL for error messages, data URLs can be megabytes long.
+func abbreviate(url string) string {
+	const maxLength = 64
+	if len(url) <= maxLength {
+		return url
+	}
+	return url[:maxLength] + "..."
+}
@@ -0,0 +1,87 @@
+package chat_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/currybab/tokgo/chat"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageCostTokens(t *testing.T) {
+	// the examples of the OpenAI vision guide
+	assert.Equal(t, 765, mod.GPT_4O_IMAGE_COST.Tokens(1024, 1024, mod.IMAGE_DETAIL_HIGH))
+	assert.Equal(t, 1105, mod.GPT_4O_IMAGE_COST.Tokens(2048, 4096, mod.IMAGE_DETAIL_HIGH))
+	assert.Equal(t, 85, mod.GPT_4O_IMAGE_COST.Tokens(4096, 8192, mod.IMAGE_DETAIL_LOW))
+	assert.Equal(t, 1105, mod.GPT_4O_IMAGE_COST.Tokens(2048, 4096, mod.IMAGE_DETAIL_AUTO))
+
+	assert.Equal(t, 85+170, mod.GPT_4O_IMAGE_COST.Tokens(512, 512, mod.IMAGE_DETAIL_HIGH))
+	assert.Equal(t, 85+2*170, mod.GPT_4O_IMAGE_COST.Tokens(513, 100, mod.IMAGE_DETAIL_HIGH))
+	// 4000x1000 fits 2048x512, the shortest side isn't scaled up
+	assert.Equal(t, 85+4*170, mod.GPT_4O_IMAGE_COST.Tokens(4000, 1000, mod.IMAGE_DETAIL_HIGH))
+	assert.Equal(t, 2833+4*5667, mod.GPT_4O_MINI_IMAGE_COST.Tokens(1024, 1024, mod.IMAGE_DETAIL_HIGH))
+
+	cost, ok := mod.GPT_4O_MINI.GetImageCost()
+	assert.True(t, ok)
+	assert.Equal(t, mod.GPT_4O_MINI_IMAGE_COST, cost)
+	model, _ := mod.ModelTypeFromName("gpt-4o-mini-2024-07-18")
+	assert.Equal(t, mod.GPT_4O_MINI, *model)
+	_, ok = mod.GPT_3_5_TURBO.GetImageCost()
+	assert.False(t, ok)
+}
+
+func pngDataURL(width int, height int) string {
+	var b bytes.Buffer
+	png.Encode(&b, image.NewGray(image.Rect(0, 0, width, height)))
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes())
+}
+
+func TestCountRequestWithImages(t *testing.T) {
+	enc := encoding.O200kBase()
+	var request chat.Request
+	err := json.Unmarshal([]byte(`{"messages": [{"role": "user", "content": [
+		{"type": "text", "text": "What is in these images?"},
+		{"type": "image_url", "image_url": {"url": "`+pngDataURL(1024, 1024)+`"}},
+		{"type": "image_url", "image_url": {"url": "https://example.com/cat.jpg", "detail": "high"}},
+		{"type": "image_url", "image_url": {"url": "https://example.com/dog.jpg", "detail": "low"}}
+	]}]}`), &request)
+	assert.NoError(t, err)
+	assert.Len(t, request.Messages[0].Parts, 4)
+	assert.Equal(t, "What is in these images?", request.Messages[0].Text())
+
+	text := chat.CountTokens(enc, request.Messages)
+	count, err := chat.CountRequest(enc, &request, chat.WithModel(mod.GPT_4O), chat.WithImageSize(func(url string) (int, int, error) {
+		assert.Equal(t, "https://example.com/cat.jpg", url)
+		return 2048, 4096, nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, text+765+1105+85, count)
+
+	_, err = chat.CountRequest(enc, &request, chat.WithModel(mod.GPT_4O))
+	assert.EqualError(t, err, "size of the image https://example.com/cat.jpg: unknown, see WithImageSize")
+	_, err = chat.CountRequest(enc, &request, chat.WithModel(mod.GPT_4))
+	assert.ErrorContains(t, err, "no image cost to count the image data:image/png;base64,")
+}
+
+func TestMessageJSON(t *testing.T) {
+	message := chat.Message{Role: "user", Parts: []chat.ContentPart{chat.TextPart("Hi"), chat.ImagePart("https://example.com/a.png", mod.IMAGE_DETAIL_LOW)}}
+	data, err := json.Marshal(message)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"role": "user", "content": [{"type": "text", "text": "Hi"}, {"type": "image_url", "image_url": {"url": "https://example.com/a.png", "detail": "low"}}]}`, string(data))
+
+	var decoded chat.Message
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, message, decoded)
+
+	data, err = json.Marshal(chat.Message{Role: "user", Content: "Hi"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"role": "user", "content": "Hi"}`, string(data))
+	assert.NoError(t, json.Unmarshal([]byte(`{"role": "assistant", "content": null}`), &decoded))
+	assert.Equal(t, chat.Message{Role: "assistant"}, decoded)
+}
@@ -0,0 +1,90 @@
+package chat
+
+import "github.com/currybab/tokgo/mod"
+
+// Tokens the chat completions API adds around the messages of the models since gpt-3.5-turbo-0613.
+const (
+	// TOKENS_PER_MESSAGE frame every message.
+	TOKENS_PER_MESSAGE = 3
+	// TOKENS_PER_NAME are added for a message with a name.
+	TOKENS_PER_NAME = 1
+	// TOKENS_PER_TOOL_CALL frame every tool call of an assistant message.
+	TOKENS_PER_TOOL_CALL = 3
+	// TOKENS_PER_REPLY prime the reply of the assistant.
+	TOKENS_PER_REPLY = 3
+	// TOKENS_PER_TOOLS introduce the namespace of the tools in the system message.
+	TOKENS_PER_TOOLS = 5
+)
+
+// Request is the part of a chat completions request that is counted.
+type Request struct {
+	Messages []Message `json:"messages"`
+	Tools    []Tool    `json:"tools,omitempty"`
+	// Functions are the deprecated predecessor of Tools.
+	Functions      []FunctionDefinition `json:"functions,omitempty"`
+	ResponseFormat *ResponseFormat      `json:"response_format,omitempty"`
+}
+
+// CountTokens estimates the prompt tokens the chat completions API bills for messages, the way
+// OpenAI documents it: the role, content and name of every message are encoded as ordinary text
+// and TOKENS_PER_MESSAGE, TOKENS_PER_NAME and TOKENS_PER_REPLY are added. The name and the
+// arguments of a tool call are counted with TOKENS_PER_TOOL_CALL. Images are left out, see CountRequest.
+func CountTokens(encoding mod.Encoding, messages []Message) int {
+	count := TOKENS_PER_REPLY
+	for _, message := range messages {
+		count += TOKENS_PER_MESSAGE
+		count += encoding.CountTokensOrdinary(message.Role)
+		count += encoding.CountTokensOrdinary(message.Text())
+		if message.Name != "" {
+			count += TOKENS_PER_NAME + encoding.CountTokensOrdinary(message.Name)
+		}
+		for _, call := range message.ToolCalls {
+			count += TOKENS_PER_TOOL_CALL
+			count += encoding.CountTokensOrdinary(call.Function.Name)
+			count += encoding.CountTokensOrdinary(call.Function.Arguments)
+		}
+	}
+	return count
+}
+
+// CountRequest estimates the prompt tokens of a request like CountTokens, including its tools and
+// response format. They are added to the system message, or to a new one if the request has none:
+// the tools as the namespace of RenderTools with TOKENS_PER_TOOLS and the response format as the
+// text of RenderResponseFormat. The estimate is the same for the cl100k_base and o200k_base model families.
+// Image parts are priced with the cost of WithImageCost or WithModel, and fail to count without.
+func CountRequest(encoding mod.Encoding, request *Request, options ...CountOption) (int, error) {
+	o := &countOptions{}
+	for _, option := range options {
+		option(o)
+	}
+	images, err := o.imageTokens(request.Messages)
+	if err != nil {
+		return 0, err
+	}
+
+	tools, err := RenderTools(request.Tools, request.Functions)
+	if err != nil {
+		return 0, err
+	}
+	responseFormat, err := RenderResponseFormat(request.ResponseFormat)
+	if err != nil {
+		return 0, err
+	}
+
+	count := CountTokens(encoding, request.Messages) + images
+	if tools == "" && responseFormat == "" {
+		return count, nil
+	}
+	if tools != "" {
+		count += TOKENS_PER_TOOLS + encoding.CountTokensOrdinary(tools)
+	}
+	count += encoding.CountTokensOrdinary(responseFormat)
+	hasSystem := false
+	for _, message := range request.Messages {
+		hasSystem = hasSystem || message.Role == "system" || message.Role == "developer"
+	}
+	if !hasSystem {
+		count += TOKENS_PER_MESSAGE + encoding.CountTokensOrdinary("system")
+	}
+	return count, nil
+}
@@ -0,0 +1,26 @@
+package chat_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/chat"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/stretchr/testify/assert"
+)
+
+// the example of the OpenAI cookbook "How to count tokens with tiktoken"
+var cookbookMessages = []chat.Message{
+	{Role: "system", Content: "You are a helpful, pattern-following assistant that translates corporate jargon into plain English."},
+	{Role: "system", Name: "example_user", Content: "New synergies will help drive top-line growth."},
+	{Role: "system", Name: "example_assistant", Content: "Things working well together will increase revenue."},
+	{Role: "system", Name: "example_user", Content: "Let's circle back when we have more bandwidth to touch base on opportunities for increased leverage."},
+	{Role: "system", Name: "example_assistant", Content: "Let's talk later when we're less busy about how to do better."},
+	{Role: "user", Content: "This late pivot means we don't have time to boil the ocean for the client deliverable."},
+}
+
+func TestCountTokens(t *testing.T) {
+	// prompt_tokens reported by the API
+	assert.Equal(t, 129, chat.CountTokens(encoding.Cl100kBase(), cookbookMessages))
+	assert.Equal(t, 124, chat.CountTokens(encoding.O200kBase(), cookbookMessages))
+	assert.Equal(t, chat.TOKENS_PER_REPLY, chat.CountTokens(encoding.O200kBase(), nil))
+}
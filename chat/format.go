@@ -0,0 +1,60 @@
+// Package chat renders chat conversations into the exact token sequences models see,
+// with the special tokens of the chat format inserted by id.
+package chat
+
+// Format describes how a chat format frames messages. A message is rendered as
+//
+//	MessageStart role [" to=" recipient] [ChannelStart channel] (ContentStart | HeaderEnd) content MessageEnd MessageSeparator
+//
+// where the fields named Start and End are special tokens and HeaderEnd and MessageSeparator are ordinary text.
+type Format struct {
+	Name string
+	// MessageStart is the special token opening a message, followed by the role.
+	MessageStart string
+	// ChannelStart is the special token before the channel of a message, empty if the format has no channels.
+	ChannelStart string
+	// ContentStart is the special token between the header and the content, empty if HeaderEnd is used.
+	ContentStart string
+	// HeaderEnd is the text between the header and the content if there is no ContentStart.
+	HeaderEnd string
+	// MessageEnd is the special token closing a message unless the message has its own EndToken.
+	MessageEnd string
+	// MessageSeparator is the text following every message.
+	MessageSeparator string
+}
+
+// Special tokens of the chat formats.
+const (
+	IM_START = "<|im_start|>"
+	IM_END   = "<|im_end|>"
+)
+
+var (
+	// ChatML is <|im_start|>role\ncontent<|im_end|>\n. The special tokens aren't part of the
+	// built-in encodings, derive one with CHATML_SPECIAL_TOKENS_CL100K first.
+	ChatML = Format{
+		Name:             "chatml",
+		MessageStart:     IM_START,
+		HeaderEnd:        "\n",
+		MessageEnd:       IM_END,
+		MessageSeparator: "\n",
+	}
+
+	// Harmony is the format of gpt-oss, <|start|>role<|channel|>channel<|message|>content<|end|>,
+	// rendered with the o200k_harmony encoding. The last assistant message of a training example
+	// usually ends with <|return|> and tool calls with <|call|>, see Message.EndToken.
+	Harmony = Format{
+		Name:         "harmony",
+		MessageStart: "<|start|>",
+		ChannelStart: "<|channel|>",
+		ContentStart: "<|message|>",
+		MessageEnd:   "<|end|>",
+	}
+
+	// CHATML_SPECIAL_TOKENS_CL100K are the ids of the ChatML tokens for cl100k_base,
+	// to be added with encoding.Derive.
+	CHATML_SPECIAL_TOKENS_CL100K = map[string]int{
+		IM_START: 100264,
+		IM_END:   100265,
+	}
+)
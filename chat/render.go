@@ -0,0 +1,191 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// Message is a message of a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Parts are the content of a message that mixes texts and images, following Content.
+	// Their JSON is the content of the message.
+	Parts []ContentPart `json:"-"`
+	// Name of the author, counted by CountTokens. Render ignores it.
+	Name string `json:"name,omitempty"`
+	// ToolCalls are the calls of an assistant message, counted by CountTokens. Render ignores them,
+	// a harmony tool call is a message with a Recipient.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the call a tool message answers.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Recipient of the message, rendered as " to=recipient" after the role, such as functions.get_weather in harmony.
+	Recipient string `json:"recipient,omitempty"`
+	// Channel of the message, such as analysis or final in harmony. Formats without channels ignore it.
+	Channel string `json:"channel,omitempty"`
+	// EndToken replaces the MessageEnd special token of the format for this message.
+	EndToken string `json:"end_token,omitempty"`
+}
+
+// MessageSpan is the range of tokens [Start, End) of a message, and [ContentStart, ContentEnd) of its content.
+type MessageSpan struct {
+	Start        int
+	ContentStart int
+	ContentEnd   int
+	End          int
+}
+
+// Rendered is a rendered conversation.
+type Rendered struct {
+	Tokens []int
+	// Messages are the spans of the messages in Tokens, in order. The generation prompt isn't a message.
+	Messages []MessageSpan
+}
+
+// Mask returns a flag per token, set for the content and the closing tokens of the selected messages,
+// for example the assistant messages whose tokens the loss of a fine-tune is computed on.
+func (r *Rendered) Mask(selected func(message int) bool) []bool {
+	mask := make([]bool, len(r.Tokens))
+	for i, span := range r.Messages {
+		if selected(i) {
+			for j := span.ContentStart; j < span.End; j++ {
+				mask[j] = true
+			}
+		}
+	}
+	return mask
+}
+
+// Renderer renders conversations in a format with an encoding.
+type Renderer struct {
+	encoding      mod.Encoding
+	format        Format
+	specialTokens map[string]int
+}
+
+// NewRenderer creates a renderer. The encoding must have the special tokens of the format.
+// A renderer can be used concurrently.
+func NewRenderer(encoding mod.Encoding, format Format) (*Renderer, error) {
+	r := &Renderer{encoding: encoding, format: format, specialTokens: map[string]int{}}
+	for _, token := range []string{format.MessageStart, format.ChannelStart, format.ContentStart, format.MessageEnd} {
+		if token == "" {
+			continue
+		}
+		id, err := r.lookupSpecialToken(token)
+		if err != nil {
+			return nil, err
+		}
+		r.specialTokens[token] = id
+	}
+	return r, nil
+}
+
+func (r *Renderer) lookupSpecialToken(token string) (int, error) {
+	if id, ok := r.specialTokens[token]; ok {
+		return id, nil
+	}
+	specialTokenEncoding, ok := r.encoding.(mod.SpecialTokenEncoding)
+	if !ok {
+		return 0, fmt.Errorf("encoding %s cannot look up special tokens", r.encoding.GetName())
+	}
+	id, ok := specialTokenEncoding.SpecialTokenID(token)
+	if !ok {
+		return 0, fmt.Errorf("encoding %s has no special token %s for the %s format", r.encoding.GetName(), token, r.format.Name)
+	}
+	return id, nil
+}
+
+// Render returns the tokens of the messages, followed by the header of an assistant message
+// if addGenerationPrompt is set. The texts of the messages are encoded as ordinary text,
+// so special tokens written in them can't change the structure of the conversation.
+// Text between two special tokens is encoded at once, like a rendered template would be,
+// and a token spanning the end of a header and the start of the content counts as content.
+// It fails if a message ends with a special token the encoding doesn't have.
+func (r *Renderer) Render(messages []Message, addGenerationPrompt bool) (*Rendered, error) {
+	rendered := &Rendered{Tokens: []int{}, Messages: make([]MessageSpan, 0, len(messages))}
+	for _, message := range messages {
+		span := MessageSpan{Start: len(rendered.Tokens)}
+		span.ContentStart = r.appendMessageStart(rendered, message)
+		span.ContentEnd = len(rendered.Tokens)
+
+		endToken := r.format.MessageEnd
+		if message.EndToken != "" {
+			endToken = message.EndToken
+		}
+		id, err := r.lookupSpecialToken(endToken)
+		if err != nil {
+			return nil, err
+		}
+		rendered.Tokens = append(rendered.Tokens, id)
+		r.appendText(rendered, r.format.MessageSeparator)
+		span.End = len(rendered.Tokens)
+		rendered.Messages = append(rendered.Messages, span)
+	}
+	if addGenerationPrompt {
+		r.appendMessageStart(rendered, Message{Role: "assistant"})
+		if r.format.ContentStart != "" {
+			// the model continues with the channel or the content
+			rendered.Tokens = rendered.Tokens[:len(rendered.Tokens)-1]
+		}
+	}
+	return rendered, nil
+}
+
+// Count returns the number of tokens Render would return.
+func (r *Renderer) Count(messages []Message, addGenerationPrompt bool) (int, error) {
+	rendered, err := r.Render(messages, addGenerationPrompt)
+	if err != nil {
+		return 0, err
+	}
+	return len(rendered.Tokens), nil
+}
+
+// appendMessageStart appends the header and the content of a message and returns the index of the first content token.
+func (r *Renderer) appendMessageStart(rendered *Rendered, message Message) int {
+	r.appendSpecialToken(rendered, r.format.MessageStart)
+	header := message.Role
+	if message.Recipient != "" {
+		header += " to=" + message.Recipient
+	}
+	if message.Channel != "" && r.format.ChannelStart != "" {
+		r.appendText(rendered, header)
+		r.appendSpecialToken(rendered, r.format.ChannelStart)
+		header = message.Channel
+	}
+	if r.format.ContentStart != "" {
+		r.appendText(rendered, header)
+		r.appendSpecialToken(rendered, r.format.ContentStart)
+		contentStart := len(rendered.Tokens)
+		r.appendText(rendered, message.Text())
+		return contentStart
+	}
+
+	header += r.format.HeaderEnd
+	start := len(rendered.Tokens)
+	r.appendText(rendered, header+message.Text())
+	contentStart, length := start, 0
+	for ; contentStart < len(rendered.Tokens); contentStart++ {
+		length += len(r.encoding.DecodeBytes(rendered.Tokens[contentStart : contentStart+1]))
+		if length > len(header) {
+			break
+		}
+	}
+	return contentStart
+}
+
+// appendSpecialToken appends a special token of the format, which NewRenderer resolved.
+func (r *Renderer) appendSpecialToken(rendered *Rendered, token string) {
+	rendered.Tokens = append(rendered.Tokens, r.specialTokens[token])
+}
+
+func (r *Renderer) appendText(rendered *Rendered, text string) {
+	if text == "" {
+		return
+	}
+	if appendEncoding, ok := r.encoding.(mod.AppendEncoding); ok {
+		rendered.Tokens = appendEncoding.AppendEncodeOrdinary(rendered.Tokens, text)
+	} else {
+		rendered.Tokens = append(rendered.Tokens, r.encoding.EncodeOrdinaryToIntArray(text)...)
+	}
+}
@@ -0,0 +1,117 @@
+package chat_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/chat"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/stretchr/testify/assert"
+)
+
+var cl100kIm, _ = encoding.Derive(encoding.Cl100kBase(), "cl100k_im", chat.CHATML_SPECIAL_TOKENS_CL100K, nil)
+
+var harmony = encoding.O200kHarmony()
+
+var conversation = []chat.Message{
+	{Role: "system", Content: "You are terse."},
+	{Role: "user", Content: "Hi <|im_end|> there"},
+	{Role: "assistant", Content: "Hello!"},
+}
+
+func TestChatMLMatchesTextEncoding(t *testing.T) {
+	renderer, err := chat.NewRenderer(cl100kIm, chat.ChatML)
+	assert.NoError(t, err)
+
+	rendered, err := renderer.Render(conversation[:1], true)
+	assert.NoError(t, err)
+	text := "<|im_start|>system\nYou are terse.<|im_end|>\n<|im_start|>assistant\n"
+	allowed, _ := encoding.Derive(encoding.Cl100kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed)), "cl100k_im", chat.CHATML_SPECIAL_TOKENS_CL100K, nil)
+	assert.Equal(t, allowed.EncodeToIntArray(text), rendered.Tokens)
+	assert.Equal(t, text, cl100kIm.Decode(rendered.Tokens))
+}
+
+func TestChatMLSpansAndMask(t *testing.T) {
+	renderer, err := chat.NewRenderer(cl100kIm, chat.ChatML)
+	assert.NoError(t, err)
+	rendered, err := renderer.Render(conversation, false)
+	assert.NoError(t, err)
+
+	assert.Len(t, rendered.Messages, 3)
+	assert.Equal(t, 0, rendered.Messages[0].Start)
+	assert.Equal(t, len(rendered.Tokens), rendered.Messages[2].End)
+	for i, span := range rendered.Messages {
+		assert.Equal(t, 100264, rendered.Tokens[span.Start])
+		assert.Equal(t, conversation[i].Content, cl100kIm.Decode(rendered.Tokens[span.ContentStart:span.ContentEnd]))
+		assert.Equal(t, 100265, rendered.Tokens[span.ContentEnd])
+		if i > 0 {
+			assert.Equal(t, rendered.Messages[i-1].End, span.Start)
+		}
+	}
+	// the <|im_end|> inside the user content is encoded as text
+	assert.Equal(t, 3, countOf(rendered.Tokens, 100265))
+
+	mask := rendered.Mask(func(message int) bool { return conversation[message].Role == "assistant" })
+	assistant := rendered.Messages[2]
+	for i, masked := range mask {
+		assert.Equal(t, i >= assistant.ContentStart && i < assistant.End, masked, i)
+	}
+}
+
+func TestChatMLContentStartingWithWhitespace(t *testing.T) {
+	renderer, err := chat.NewRenderer(cl100kIm, chat.ChatML)
+	assert.NoError(t, err)
+	rendered, err := renderer.Render([]chat.Message{{Role: "user", Content: "\n\nHi"}}, false)
+	assert.NoError(t, err)
+
+	span := rendered.Messages[0]
+	// "\n" of the header and "\n\n" of the content are a single token
+	assert.Equal(t, "\n\n\nHi", cl100kIm.Decode(rendered.Tokens[span.ContentStart:span.ContentEnd]))
+	assert.Equal(t, "user", cl100kIm.Decode(rendered.Tokens[span.Start+1:span.ContentStart]))
+}
+
+func TestHarmony(t *testing.T) {
+	renderer, err := chat.NewRenderer(harmony, chat.Harmony)
+	assert.NoError(t, err)
+	rendered, err := renderer.Render([]chat.Message{
+		{Role: "user", Content: "What's the weather?"},
+		{Role: "assistant", Channel: "commentary", Recipient: "functions.get_weather", Content: `{"city":"Oslo"}`, EndToken: "<|call|>"},
+		{Role: "assistant", Channel: "final", Content: "Sunny.", EndToken: "<|return|>"},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`<|start|>user<|message|>What's the weather?<|end|>`+
+			`<|start|>assistant to=functions.get_weather<|channel|>commentary<|message|>{"city":"Oslo"}<|call|>`+
+			`<|start|>assistant<|channel|>final<|message|>Sunny.<|return|>`,
+		harmony.Decode(rendered.Tokens))
+	assert.Equal(t, 200012, rendered.Tokens[rendered.Messages[1].End-1])
+	assert.Equal(t, "Sunny.", harmony.Decode(rendered.Tokens[rendered.Messages[2].ContentStart:rendered.Messages[2].ContentEnd]))
+
+	prompt, err := renderer.Render(nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "<|start|>assistant", harmony.Decode(prompt.Tokens))
+	assert.Empty(t, prompt.Messages)
+
+	count, err := renderer.Count([]chat.Message{{Role: "user", Content: "Hi"}}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, count)
+}
+
+func TestRendererNeedsFormatTokens(t *testing.T) {
+	_, err := chat.NewRenderer(encoding.Cl100kBase(), chat.ChatML)
+	assert.EqualError(t, err, "encoding cl100k_base has no special token <|im_start|> for the chatml format")
+
+	renderer, err := chat.NewRenderer(cl100kIm, chat.ChatML)
+	assert.NoError(t, err)
+	_, err = renderer.Render([]chat.Message{{Role: "user", EndToken: "<|call|>"}}, false)
+	assert.Error(t, err)
+}
+
+func countOf(tokens []int, token int) int {
+	count := 0
+	for _, t := range tokens {
+		if t == token {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,37 @@
+# Records the prompt tokens the chat completions API reports for the requests of
+# usage_requests.jsonl into usages.jsonl, which TestCountRequestMatchesUsages checks
+# chat.CountRequest against. Rows of other sources, such as the cookbook, are kept.
+#
+#   pip install -r requirements.txt
+#   OPENAI_API_KEY=... python record_usages.py
+import datetime
+import json
+
+from openai import OpenAI
+
+client = OpenAI()
+recorded = datetime.date.today().isoformat()
+
+with open("usages.jsonl", encoding="utf-8") as f:
+    usages = [json.loads(line) for line in f if line.strip()]
+
+with open("usage_requests.jsonl", encoding="utf-8") as f:
+    requests = [json.loads(line) for line in f if line.strip()]
+
+for entry in requests:
+    source = "API usage: " + entry["name"]
+    for model in entry["models"]:
+        completion = client.chat.completions.create(model=model, max_tokens=1, **entry["request"])
+        usages = [u for u in usages if not (u["source"] == source and u["model"] == model)]
+        usages.append({
+            "source": source,
+            "recorded": recorded,
+            "model": model,
+            "prompt_tokens": completion.usage.prompt_tokens,
+            "request": entry["request"],
+        })
+        print(f"{model}: {entry['name']}: {completion.usage.prompt_tokens}")
+
+with open("usages.jsonl", "w", encoding="utf-8") as f:
+    for usage in usages:
+        f.write(json.dumps(usage, ensure_ascii=False) + "\n")
@@ -0,0 +1,316 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Tool is a tool of a chat completions request, only function tools are rendered.
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition defines a function the model can call.
+type FunctionDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON schema of the arguments, an object. The order of its properties is kept.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	Strict     bool            `json:"strict,omitempty"`
+}
+
+// ToolCall is a call of a function by the assistant.
+type ToolCall struct {
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall is the name and the JSON arguments of a called function.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ResponseFormat is the response_format of a chat completions request, only json_schema formats are rendered.
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema is a named schema of structured outputs.
+type JSONSchema struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// RenderTools renders the definitions of the function tools and the legacy functions into the
+// TypeScript-like namespace the models see:
+//
+//	namespace functions {
+//
+//	// Get the current weather in a given location
+//	type get_current_weather = (_: {
+//	// The city and state, e.g. San Francisco, CA
+//	location: string,
+//	unit?: "celsius" | "fahrenheit", // default: celsius
+//	}) => any;
+//
+//	} // namespace functions
+//
+// It returns an empty string if there are no functions, and fails if parameters aren't a JSON schema object.
+func RenderTools(tools []Tool, functions []FunctionDefinition) (string, error) {
+	definitions := functions
+	for _, tool := range tools {
+		if tool.Type == "" || tool.Type == "function" {
+			definitions = append(definitions, tool.Function)
+		}
+	}
+	if len(definitions) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("namespace functions {\n\n")
+	for _, definition := range definitions {
+		writeComment(&b, definition.Description, "")
+		var parameters schema
+		if len(definition.Parameters) > 0 && string(definition.Parameters) != "null" {
+			if err := json.Unmarshal(definition.Parameters, &parameters); err != nil {
+				return "", fmt.Errorf("parameters of function %s: %w", definition.Name, err)
+			}
+		}
+		if len(parameters.Properties) == 0 {
+			fmt.Fprintf(&b, "type %s = () => any;\n\n", definition.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "type %s = (_: {\n", definition.Name)
+		writeProperties(&b, &parameters, "")
+		b.WriteString("}) => any;\n\n")
+	}
+	b.WriteString("} // namespace functions")
+	return b.String(), nil
+}
+
+// RenderResponseFormat renders a json_schema response format the way the models see it:
+//
+//	# Response Formats
+//
+//	## name
+//
+//	// description
+//	{"type":"object",...}
+//
+// The schema is compacted, not reformatted, and left out if it is empty or null.
+// It returns an empty string for the other formats.
+func RenderResponseFormat(format *ResponseFormat) (string, error) {
+	if format == nil || format.Type != "json_schema" || format.JSONSchema == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Response Formats\n\n## %s\n\n", format.JSONSchema.Name)
+	writeComment(&b, format.JSONSchema.Description, "")
+	if schema := bytes.TrimSpace(format.JSONSchema.Schema); len(schema) == 0 || string(schema) == "null" {
+		return b.String(), nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, format.JSONSchema.Schema); err != nil {
+		return "", fmt.Errorf("schema of response format %s: %w", format.JSONSchema.Name, err)
+	}
+	b.Write(compact.Bytes())
+	return b.String(), nil
+}
+
+// schema is the part of a JSON schema that is rendered.
+type schema struct {
+	Types       []string
+	Description string
+	Enum        []json.RawMessage
+	Default     json.RawMessage
+	Properties  []property
+	Required    []string
+	Items       *schema
+	// Variants are the schemas of anyOf or oneOf.
+	Variants []*schema
+}
+
+type property struct {
+	name   string
+	schema *schema
+}
+
+func (s *schema) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		Type        json.RawMessage   `json:"type"`
+		Description string            `json:"description"`
+		Enum        []json.RawMessage `json:"enum"`
+		Default     json.RawMessage   `json:"default"`
+		Properties  json.RawMessage   `json:"properties"`
+		Required    []string          `json:"required"`
+		Items       *schema           `json:"items"`
+		AnyOf       []*schema         `json:"anyOf"`
+		OneOf       []*schema         `json:"oneOf"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*s = schema{
+		Description: fields.Description,
+		Enum:        fields.Enum,
+		Default:     fields.Default,
+		Required:    fields.Required,
+		Items:       fields.Items,
+		Variants:    append(fields.AnyOf, fields.OneOf...),
+	}
+	if len(fields.Type) > 0 {
+		var typ string
+		if err := json.Unmarshal(fields.Type, &typ); err == nil {
+			s.Types = []string{typ}
+		} else if err := json.Unmarshal(fields.Type, &s.Types); err != nil {
+			return fmt.Errorf("type is neither a string nor a list of strings")
+		}
+	}
+	if len(fields.Properties) > 0 {
+		return s.unmarshalProperties(fields.Properties)
+	}
+	return nil
+}
+
+// unmarshalProperties decodes the properties in the order they are written.
+func (s *schema) unmarshalProperties(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		return fmt.Errorf("properties are not an object")
+	}
+	for decoder.More() {
+		name, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		p := property{name: name.(string), schema: &schema{}}
+		if err := decoder.Decode(p.schema); err != nil {
+			return fmt.Errorf("property %s: %w", p.name, err)
+		}
+		s.Properties = append(s.Properties, p)
+	}
+	return nil
+}
+
+// writeProperties writes a line per property, preceded by its description.
+func writeProperties(b *strings.Builder, s *schema, indent string) {
+	for _, p := range s.Properties {
+		writeComment(b, p.schema.Description, indent)
+		b.WriteString(indent)
+		b.WriteString(p.name)
+		if !slices.Contains(s.Required, p.name) {
+			b.WriteByte('?')
+		}
+		b.WriteString(": ")
+		writeType(b, p.schema, indent)
+		b.WriteByte(',')
+		if len(p.schema.Default) > 0 {
+			b.WriteString(" // default: ")
+			writeValue(b, p.schema.Default)
+		}
+		b.WriteByte('\n')
+	}
+}
+
+func writeType(b *strings.Builder, s *schema, indent string) {
+	switch {
+	case len(s.Variants) > 0:
+		for i, variant := range s.Variants {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			writeType(b, variant, indent)
+		}
+	case len(s.Enum) > 0:
+		for i, value := range s.Enum {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			var compact bytes.Buffer
+			json.Compact(&compact, value)
+			b.Write(compact.Bytes())
+		}
+	case len(s.Types) == 0:
+		b.WriteString("any")
+	default:
+		for i, typ := range s.Types {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			writeSingleType(b, s, typ, indent)
+		}
+	}
+}
+
+func writeSingleType(b *strings.Builder, s *schema, typ string, indent string) {
+	switch typ {
+	case "string", "boolean", "null":
+		b.WriteString(typ)
+	case "number", "integer":
+		b.WriteString("number")
+	case "object":
+		if len(s.Properties) == 0 {
+			b.WriteString("object")
+			return
+		}
+		b.WriteString("{\n")
+		writeProperties(b, s, indent+"  ")
+		b.WriteString(indent)
+		b.WriteByte('}')
+	case "array":
+		if s.Items == nil {
+			b.WriteString("any[]")
+			return
+		}
+		union := len(s.Items.Variants) > 1 || len(s.Items.Enum) > 1 || len(s.Items.Types) > 1
+		if union {
+			b.WriteByte('(')
+		}
+		writeType(b, s.Items, indent)
+		if union {
+			b.WriteByte(')')
+		}
+		b.WriteString("[]")
+	default:
+		b.WriteString("any")
+	}
+}
+
+// writeValue writes a default value, strings without quotes.
+func writeValue(b *strings.Builder, value json.RawMessage) {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		b.WriteString(text)
+		return
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, value)
+	b.Write(compact.Bytes())
+}
+
+// writeComment writes every line of text as a // comment.
+func writeComment(b *strings.Builder, text string, indent string) {
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(indent)
+		b.WriteString("// ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+}
@@ -0,0 +1,198 @@
+package chat_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/chat"
+	"github.com/currybab/tokgo/mod"
+	tokgo "github.com/currybab/tokgo/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usage is a request whose prompt tokens were reported by the API.
+type usage struct {
+	Source       string       `json:"source"`
+	Model        string       `json:"model"`
+	PromptTokens int          `json:"prompt_tokens"`
+	Request      chat.Request `json:"request"`
+}
+
+func TestCountRequestMatchesUsages(t *testing.T) {
+	file, err := os.Open("testdata/usages.jsonl")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	registry := tokgo.NewDefaultEncodingRegistry()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var u usage
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &u))
+		enc, err := registry.GetEncodingForModel(u.Model)
+		assert.NoError(t, err)
+
+		count, err := chat.CountRequest(enc, &u.Request)
+		assert.NoError(t, err)
+		assert.Equal(t, u.PromptTokens, count, "line %d: %s, %s", line, u.Model, u.Source)
+	}
+	assert.NoError(t, scanner.Err())
+}
+
+// usageRequest is a request whose usage record_usages.py records for every model.
+type usageRequest struct {
+	Name    string       `json:"name"`
+	Models  []string     `json:"models"`
+	Request chat.Request `json:"request"`
+}
+
+func TestUsageRequestsAreRecorded(t *testing.T) {
+	recorded := map[string]bool{}
+	for _, u := range readJSONLines[usage](t, "testdata/usages.jsonl") {
+		recorded[u.Source+"\x00"+u.Model] = true
+	}
+
+	registry := tokgo.NewDefaultEncodingRegistry()
+	var missing []string
+	for _, r := range readJSONLines[usageRequest](t, "testdata/usage_requests.jsonl") {
+		for _, model := range r.Models {
+			enc, err := registry.GetEncodingForModel(model)
+			assert.NoError(t, err)
+			_, err = chat.CountRequest(enc, &r.Request)
+			assert.NoError(t, err, "%s, %s", model, r.Name)
+			if !recorded["API usage: "+r.Name+"\x00"+model] {
+				missing = append(missing, model+", "+r.Name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("no usage recorded for %d requests, run testdata/record_usages.py: %s", len(missing), strings.Join(missing, "; "))
+	}
+}
+
+func readJSONLines[T any](t *testing.T, path string) []T {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var values []T
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var value T
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &value))
+		values = append(values, value)
+	}
+	require.NoError(t, scanner.Err())
+	return values
+}
+
+func TestRenderTools(t *testing.T) {
+	tools := []chat.Tool{
+		{Type: "function", Function: chat.FunctionDefinition{Name: "get_location", Description: "Gets the location of the user."}},
+		{Type: "function", Function: chat.FunctionDefinition{
+			Name:        "search",
+			Description: "Searches the catalog.\nReturns at most 10 items.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"query": {"type": "string", "description": "Words to look for"},
+					"limit": {"type": "integer", "default": 10},
+					"tags": {"type": "array", "items": {"type": "string", "enum": ["new", "sale"]}},
+					"price": {"type": "object", "description": "Price range", "properties": {"min": {"type": "number"}, "max": {"type": ["number", "null"]}}, "required": ["min"]},
+					"sort": {"anyOf": [{"type": "string", "enum": ["price"]}, {"type": "null"}], "default": "price"},
+					"filters": {"type": "object"},
+					"raw": {}
+				},
+				"required": ["query"]
+			}`),
+		}},
+		{Type: "code_interpreter"},
+	}
+	rendered, err := chat.RenderTools(tools, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `namespace functions {
+
+// Gets the location of the user.
+type get_location = () => any;
+
+// Searches the catalog.
+// Returns at most 10 items.
+type search = (_: {
+// Words to look for
+query: string,
+limit?: number, // default: 10
+tags?: ("new" | "sale")[],
+// Price range
+price?: {
+  min: number,
+  max?: number | null,
+},
+sort?: "price" | null, // default: price
+filters?: object,
+raw?: any,
+}) => any;
+
+} // namespace functions`, rendered)
+
+	rendered, err = chat.RenderTools(nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, rendered)
+
+	_, err = chat.RenderTools(nil, []chat.FunctionDefinition{{Name: "broken", Parameters: json.RawMessage(`{"properties": []}`)}})
+	assert.EqualError(t, err, "parameters of function broken: properties are not an object")
+}
+
+func TestRenderResponseFormat(t *testing.T) {
+	format := &chat.ResponseFormat{Type: "json_schema", JSONSchema: &chat.JSONSchema{
+		Name:        "shape_info",
+		Description: "A shape",
+		Schema:      json.RawMessage(`{"properties": {"shape": {"type": "string"}, "area": {"type": "number"}}, "required": ["shape", "area"], "type": "object"}`),
+	}}
+	rendered, err := chat.RenderResponseFormat(format)
+	assert.NoError(t, err)
+	assert.Equal(t, "# Response Formats\n\n## shape_info\n\n// A shape\n"+
+		`{"properties":{"shape":{"type":"string"},"area":{"type":"number"}},"required":["shape","area"],"type":"object"}`, rendered)
+
+	for _, empty := range []string{"", "null", " null "} {
+		rendered, err = chat.RenderResponseFormat(&chat.ResponseFormat{Type: "json_schema", JSONSchema: &chat.JSONSchema{Name: "free", Schema: json.RawMessage(empty)}})
+		assert.NoError(t, err, "%q", empty)
+		assert.Equal(t, "# Response Formats\n\n## free\n\n", rendered, "%q", empty)
+	}
+
+	rendered, err = chat.RenderResponseFormat(&chat.ResponseFormat{Type: "json_object"})
+	assert.NoError(t, err)
+	assert.Empty(t, rendered)
+}
+
+func TestCountRequest(t *testing.T) {
+	enc, _ := tokgo.NewDefaultEncodingRegistry().GetEncodingByType(mod.O200K_BASE)
+	messages := []chat.Message{
+		{Role: "user", Content: "Weather in Oslo?"},
+		{Role: "assistant", ToolCalls: []chat.ToolCall{{ID: "call_1", Type: "function", Function: chat.FunctionCall{Name: "get_weather", Arguments: `{"city":"Oslo"}`}}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "Sunny"},
+	}
+	withoutTools, err := chat.CountRequest(enc, &chat.Request{Messages: messages})
+	assert.NoError(t, err)
+	assert.Equal(t, chat.CountTokens(enc, messages), withoutTools)
+	assert.Equal(t, chat.CountTokens(enc, messages[:1])+chat.TOKENS_PER_MESSAGE+enc.CountTokensOrdinary("assistant")+
+		chat.TOKENS_PER_TOOL_CALL+enc.CountTokensOrdinary("get_weather")+enc.CountTokensOrdinary(`{"city":"Oslo"}`)+
+		chat.TOKENS_PER_MESSAGE+enc.CountTokensOrdinary("tool")+enc.CountTokensOrdinary("Sunny"), withoutTools)
+
+	request := &chat.Request{
+		Messages:       messages,
+		Functions:      []chat.FunctionDefinition{{Name: "get_weather"}},
+		ResponseFormat: &chat.ResponseFormat{Type: "json_schema", JSONSchema: &chat.JSONSchema{Name: "answer", Schema: json.RawMessage(`{"type":"string"}`)}},
+	}
+	count, err := chat.CountRequest(enc, request)
+	assert.NoError(t, err)
+	tools, _ := chat.RenderTools(nil, request.Functions)
+	responseFormat, _ := chat.RenderResponseFormat(request.ResponseFormat)
+	// both are added to a new system message
+	assert.Equal(t, withoutTools+chat.TOKENS_PER_TOOLS+enc.CountTokensOrdinary(tools)+enc.CountTokensOrdinary(responseFormat)+
+		chat.TOKENS_PER_MESSAGE+enc.CountTokensOrdinary("system"), count)
+}
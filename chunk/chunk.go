@@ -0,0 +1,213 @@
+// Package chunk splits texts into chunks of at most a number of tokens along their structure, for
+// retrieval: Markdown sections, paragraphs, lines, sentences and words are kept whole as long as they fit.
+package chunk
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// DefaultSeparators split a part of a text that has too many tokens at blank lines first,
+// then at line breaks, sentence ends and finally at spaces.
+var DefaultSeparators = []*regexp.Regexp{
+	regexp.MustCompile(`\n[ \t]*\n\s*`),
+	regexp.MustCompile(`\n`),
+	regexp.MustCompile(`[.!?]+['")\]]*\s+|[。！？]+`),
+	regexp.MustCompile(`\s+`),
+}
+
+// Chunk is a part of a text.
+type Chunk struct {
+	Text string
+	// Start and End are the byte offsets of Text in the split text.
+	Start int
+	End   int
+	// Tokens is the number of tokens of Text, counted as part of the whole text.
+	Tokens int
+	// Headings are the titles of the Markdown sections the chunk is in, outermost first.
+	Headings []string
+}
+
+// Options configures Split.
+type Options struct {
+	// MaxTokens is the largest number of tokens of a chunk.
+	MaxTokens int
+	// Separators are tried in order to split a part that has too many tokens, DefaultSeparators if nil.
+	// A part is split after every match of a separator.
+	Separators []*regexp.Regexp
+	// PlainText doesn't split the text at Markdown headings first.
+	PlainText bool
+}
+
+// span is a part of the text and its number of tokens.
+type span struct {
+	start  int
+	end    int
+	tokens int
+}
+
+type splitter struct {
+	encoding mod.Encoding
+	text     string
+	options  Options
+	index    *tokenIndex
+}
+
+// Split splits text into consecutive chunks of at most MaxTokens tokens, which together are the whole text.
+//
+// Unless the text is plain text, it is split into its Markdown sections first and a chunk never spans two
+// of them. A part with too many tokens is split after every match of the first separator that matches it,
+// and the resulting parts are merged again as long as they fit into a chunk. Parts that still have too many
+// tokens are split with the next separator, and those without any separators between their pieces and
+// finally between their tokens.
+//
+// The text is encoded only once. Chunks start and end at pre-tokenization pieces of the whole text, so
+// their tokens add up, and are usually the same as if the text of a chunk was encoded on its own.
+// Special tokens are counted like the Pieces of the encoding yield them.
+func Split(encoding mod.Encoding, text string, options Options) ([]Chunk, error) {
+	if options.MaxTokens <= 0 {
+		return nil, fmt.Errorf("max tokens must be positive, not %d", options.MaxTokens)
+	}
+	if options.Separators == nil {
+		options.Separators = DefaultSeparators
+	}
+	s := &splitter{encoding: encoding, text: text, options: options, index: newTokenIndex(encoding, text)}
+
+	sections := []section{{}}
+	if !options.PlainText {
+		sections = markdownSections(text)
+	}
+	var chunks []Chunk
+	for i, section := range sections {
+		start, end := s.index.snap(section.start), len(text)
+		if i+1 < len(sections) {
+			end = s.index.snap(sections[i+1].start)
+		}
+		if start >= end {
+			continue
+		}
+		for _, part := range s.split(start, end, 0) {
+			chunks = append(chunks, Chunk{
+				Text:     text[part.start:part.end],
+				Start:    part.start,
+				End:      part.end,
+				Tokens:   part.tokens,
+				Headings: section.headings,
+			})
+		}
+	}
+	return chunks, nil
+}
+
+// split splits the part between start and end with the separators from level on.
+func (s *splitter) split(start int, end int, level int) []span {
+	tokens := s.index.tokens(start, end)
+	if tokens <= s.options.MaxTokens {
+		return []span{{start: start, end: end, tokens: tokens}}
+	}
+	if level == len(s.options.Separators) {
+		return s.splitPieces(start, end)
+	}
+	points := s.splitPoints(start, end, s.options.Separators[level])
+	if len(points) == 0 {
+		return s.split(start, end, level+1)
+	}
+
+	var spans []span
+	var current span
+	flush := func() {
+		if current.end > current.start {
+			spans = append(spans, current)
+		}
+		current = span{}
+	}
+	previous := start
+	for _, point := range append(points, end) {
+		part := span{start: previous, end: point, tokens: s.index.tokens(previous, point)}
+		previous = point
+		switch {
+		case part.tokens > s.options.MaxTokens:
+			flush()
+			spans = append(spans, s.split(part.start, part.end, level+1)...)
+		case current.end > current.start && current.tokens+part.tokens <= s.options.MaxTokens:
+			current.end = part.end
+			current.tokens += part.tokens
+		default:
+			flush()
+			current = part
+		}
+	}
+	flush()
+	return spans
+}
+
+// splitPoints returns the piece boundaries between start and end at the end of the matches of separator.
+// A match that ends inside a piece is split in front of that piece, unless the piece starts before the match,
+// like ".\n\n" for a line break, then it is split after the piece.
+func (s *splitter) splitPoints(start int, end int, separator *regexp.Regexp) []int {
+	var points []int
+	for _, match := range separator.FindAllStringIndex(s.text[start:end], -1) {
+		point := s.index.snap(start + match[1])
+		if point < start+match[0] {
+			point = s.index.snapAfter(start + match[1])
+		}
+		if point > start && point < end && (len(points) == 0 || point > points[len(points)-1]) {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// splitPieces fills chunks with as many pieces as fit, and cuts pieces with too many tokens between their tokens.
+func (s *splitter) splitPieces(start int, end int) []span {
+	var spans []span
+	current := span{start: start, end: start}
+	for i := s.index.position(start); s.index.boundaries[i] < end; i++ {
+		pieceStart, pieceEnd := s.index.boundaries[i], s.index.boundaries[i+1]
+		tokens := s.index.tokens(pieceStart, pieceEnd)
+		if current.tokens+tokens <= s.options.MaxTokens {
+			current.end = pieceEnd
+			current.tokens += tokens
+			continue
+		}
+		if current.end > current.start {
+			spans = append(spans, current)
+		}
+		current = span{start: pieceStart, end: pieceEnd, tokens: tokens}
+		if tokens > s.options.MaxTokens {
+			cut := s.cutTokens(pieceStart, pieceEnd)
+			spans = append(spans, cut[:len(cut)-1]...)
+			current = cut[len(cut)-1]
+		}
+	}
+	return append(spans, current)
+}
+
+// cutTokens cuts a piece after every MaxTokens of its tokens, moving the cuts back to the start of a character.
+func (s *splitter) cutTokens(start int, end int) []span {
+	var spans []span
+	current := span{start: start}
+	offset := start
+	// the last offset that is the start of a character and the tokens in front of it
+	candidate, candidateTokens := -1, 0
+	for _, token := range s.encoding.EncodeOrdinaryToIntArray(s.text[start:end]) {
+		if current.tokens == s.options.MaxTokens {
+			if candidate <= current.start {
+				candidate, candidateTokens = offset, current.tokens
+			}
+			spans = append(spans, span{start: current.start, end: candidate, tokens: candidateTokens})
+			current = span{start: candidate, tokens: current.tokens - candidateTokens}
+			candidate = -1
+		}
+		offset += len(s.encoding.DecodeBytes([]int{token}))
+		current.tokens++
+		if offset == end || utf8.RuneStart(s.text[offset]) {
+			candidate, candidateTokens = offset, current.tokens
+		}
+	}
+	current.end = end
+	return append(spans, current)
+}
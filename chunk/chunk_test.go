@@ -0,0 +1,167 @@
+package chunk_test
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/chunk"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const document = `Introduction without a heading.
+
+# Installation
+
+Install the module with go get. It has no dependencies besides regexp2! Then import it.
+
+## From source
+
+Clone the repository and build it:
+
+` + "```sh" + `
+# not a heading
+go build ./...
+` + "```" + `
+
+## Verifying ##
+
+Run the tests. They take a while.
+
+# Usage
+
+Create a registry and look up an encoding. Encode a text, count its tokens or decode tokens again.
+`
+
+// assertChunks checks that the chunks are the whole text and that their tokens are those of their texts.
+func assertChunks(t *testing.T, enc mod.Encoding, text string, maxTokens int, chunks []chunk.Chunk) {
+	t.Helper()
+	var joined strings.Builder
+	for i, c := range chunks {
+		if i > 0 {
+			assert.Equal(t, chunks[i-1].End, c.Start)
+		}
+		assert.Equal(t, text[c.Start:c.End], c.Text)
+		assert.LessOrEqual(t, c.Tokens, maxTokens, c.Text)
+		assert.Positive(t, c.Tokens)
+		joined.WriteString(c.Text)
+	}
+	assert.Equal(t, text, joined.String())
+}
+
+func texts(chunks []chunk.Chunk) []string {
+	result := make([]string, len(chunks))
+	for i, c := range chunks {
+		result[i] = c.Text
+	}
+	return result
+}
+
+func TestSplitKeepsMarkdownSections(t *testing.T) {
+	enc := encoding.Cl100kBase()
+	chunks, err := chunk.Split(enc, document, chunk.Options{MaxTokens: 1000})
+	require.NoError(t, err)
+	assertChunks(t, enc, document, 1000, chunks)
+
+	headings := make([][]string, len(chunks))
+	for i, c := range chunks {
+		headings[i] = c.Headings
+		assert.Equal(t, enc.CountTokensOrdinary(c.Text), c.Tokens, c.Text)
+	}
+	assert.Equal(t, [][]string{nil, {"Installation"}, {"Installation", "From source"}, {"Installation", "Verifying"}, {"Usage"}}, headings)
+	assert.True(t, strings.HasPrefix(chunks[2].Text, "## From source\n"))
+	assert.Contains(t, chunks[2].Text, "# not a heading")
+}
+
+func TestSplitAtParagraphsAndSentences(t *testing.T) {
+	enc := encoding.Cl100kBase()
+	chunks, err := chunk.Split(enc, document, chunk.Options{MaxTokens: 12})
+	require.NoError(t, err)
+	assertChunks(t, enc, document, 12, chunks)
+	for _, c := range chunks {
+		assert.Equal(t, enc.CountTokensOrdinary(c.Text), c.Tokens, c.Text)
+	}
+	assert.Subset(t, texts(chunks), []string{
+		"# Installation\n\n",
+		"Install the module with go get.",
+		" It has no dependencies besides regexp2! Then import it.\n\n",
+		"Run the tests. They take a while.\n\n",
+	})
+}
+
+func TestSplitMergesSmallParts(t *testing.T) {
+	enc := encoding.Cl100kBase()
+	text := strings.Repeat("One. Two. Three.\n\n", 10)
+	chunks, err := chunk.Split(enc, text, chunk.Options{MaxTokens: 16, PlainText: true})
+	require.NoError(t, err)
+	assertChunks(t, enc, text, 16, chunks)
+	// a paragraph has 8 tokens
+	assert.Equal(t, strings.Repeat("One. Two. Three.\n\n", 2), chunks[0].Text)
+	assert.Len(t, chunks, 5)
+}
+
+func TestSplitCutsLongPieces(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	letters := make([]byte, 2000)
+	for i := range letters {
+		letters[i] = byte('a' + random.Intn(26))
+	}
+	text := "short words " + string(letters) + " 🤚🏾🤚🏾🤚🏾🤚🏾🤚🏾🤚🏾"
+	for _, enc := range []mod.Encoding{encoding.Cl100kBase(), encoding.O200kBase()} {
+		chunks, err := chunk.Split(enc, text, chunk.Options{MaxTokens: 5})
+		require.NoError(t, err)
+		assertChunks(t, enc, text, 5, chunks)
+		assert.Equal(t, "short words", chunks[0].Text)
+	}
+}
+
+// textEncoding hides the pieces of an encoding.
+type textEncoding struct {
+	mod.Encoding
+}
+
+func TestSplitWithoutPieces(t *testing.T) {
+	enc := textEncoding{encoding.Cl100kBase()}
+	chunks, err := chunk.Split(enc, document, chunk.Options{MaxTokens: 12})
+	require.NoError(t, err)
+	assertChunks(t, enc, document, 12, chunks)
+	assert.Equal(t, "Introduction without a heading.\n\n", chunks[0].Text)
+}
+
+func TestSplitWithSeparators(t *testing.T) {
+	enc := encoding.R50kBase()
+	text := "a, b, c, d, e, f"
+	chunks, err := chunk.Split(enc, text, chunk.Options{MaxTokens: 4, Separators: []*regexp.Regexp{regexp.MustCompile(`,`)}})
+	require.NoError(t, err)
+	assertChunks(t, enc, text, 4, chunks)
+	assert.Equal(t, []string{"a, b,", " c, d,", " e, f"}, texts(chunks))
+}
+
+func TestSplitEncodesTheTextOnce(t *testing.T) {
+	observer := &bytesObserver{}
+	enc := encoding.Cl100kBase(encoding.WithObserver(observer))
+	_, err := chunk.Split(enc, document, chunk.Options{MaxTokens: 12})
+	require.NoError(t, err)
+	assert.Equal(t, len(document), observer.inputBytes)
+}
+
+type bytesObserver struct {
+	inputBytes int
+}
+
+func (o *bytesObserver) Observe(event mod.Event) {
+	o.inputBytes += event.InputBytes
+}
+
+func TestSplitErrors(t *testing.T) {
+	_, err := chunk.Split(encoding.Cl100kBase(), "text", chunk.Options{})
+	assert.EqualError(t, err, "max tokens must be positive, not 0")
+
+	chunks, err := chunk.Split(encoding.Cl100kBase(), "", chunk.Options{MaxTokens: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, chunks)
+}
@@ -0,0 +1,70 @@
+package chunk
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/currybab/tokgo/mod"
+	"github.com/currybab/tokgo/parser"
+)
+
+// tokenIndex holds the number of tokens in front of every boundary between the pieces of a text,
+// so that the tokens between two boundaries are counted without encoding the text again.
+type tokenIndex struct {
+	// boundaries are ascending byte offsets, the first is 0 and the last the length of the text
+	boundaries []int
+	// counts[i] is the number of tokens in front of boundaries[i]
+	counts []int
+}
+
+// newTokenIndex encodes text once. The boundaries are the pieces of the encoding if it is a mod.PieceEncoding,
+// and otherwise the tokens of the text that end at the start of a character.
+func newTokenIndex(encoding mod.Encoding, text string) *tokenIndex {
+	index := &tokenIndex{boundaries: []int{0}, counts: []int{0}}
+	if pieceEncoding, ok := encoding.(mod.PieceEncoding); ok {
+		for piece := range pieceEncoding.Pieces(text) {
+			tokens := 1
+			if piece.Kind != parser.PieceSpecialToken {
+				tokens = encoding.CountTokensOrdinary(piece.Text)
+			}
+			index.add(piece.End, tokens)
+		}
+		return index
+	}
+
+	offset, pending := 0, 0
+	for _, token := range encoding.EncodeOrdinaryToIntArray(text) {
+		offset += len(encoding.DecodeBytes([]int{token}))
+		pending++
+		if offset >= len(text) || utf8.RuneStart(text[offset]) {
+			index.add(offset, pending)
+			pending = 0
+		}
+	}
+	return index
+}
+
+func (t *tokenIndex) add(boundary int, tokens int) {
+	t.boundaries = append(t.boundaries, boundary)
+	t.counts = append(t.counts, t.counts[len(t.counts)-1]+tokens)
+}
+
+// position returns the index of a boundary.
+func (t *tokenIndex) position(boundary int) int {
+	return sort.SearchInts(t.boundaries, boundary)
+}
+
+// snap returns the last boundary at or in front of offset.
+func (t *tokenIndex) snap(offset int) int {
+	return t.boundaries[sort.SearchInts(t.boundaries, offset+1)-1]
+}
+
+// snapAfter returns the first boundary at or after offset.
+func (t *tokenIndex) snapAfter(offset int) int {
+	return t.boundaries[sort.SearchInts(t.boundaries, offset)]
+}
+
+// tokens returns the number of tokens between two boundaries.
+func (t *tokenIndex) tokens(start int, end int) int {
+	return t.counts[t.position(end)] - t.counts[t.position(start)]
+}
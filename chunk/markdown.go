@@ -0,0 +1,63 @@
+package chunk
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// headingPattern matches an ATX heading line, the title without the optional closing hashes is group 2
+	headingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	// fencePattern matches the line that opens or closes a fenced code block
+	fencePattern = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// section is a part of a Markdown text that starts with a heading, except for the first one.
+type section struct {
+	start int
+	// headings are the titles of the heading of the section and of the headings it is nested in
+	headings []string
+}
+
+// markdownSections returns the sections of text in order. Headings in fenced code blocks are ignored.
+func markdownSections(text string) []section {
+	type heading struct {
+		level int
+		title string
+	}
+	var stack []heading
+	sections := []section{{}}
+	fence := ""
+	for start := 0; start < len(text); {
+		end := len(text)
+		if i := strings.IndexByte(text[start:], '\n'); i >= 0 {
+			end = start + i + 1
+		}
+		line := strings.TrimRight(text[start:end], "\r\n")
+
+		if match := fencePattern.FindStringSubmatch(line); match != nil {
+			if fence == "" {
+				fence = match[1]
+			} else if match[1] == fence {
+				fence = ""
+			}
+		} else if match := headingPattern.FindStringSubmatch(line); match != nil && fence == "" {
+			level := len(match[1])
+			for len(stack) > 0 && stack[len(stack)-1].level >= level {
+				stack = stack[:len(stack)-1]
+			}
+			stack = append(stack, heading{level: level, title: match[2]})
+			headings := make([]string, len(stack))
+			for i, h := range stack {
+				headings[i] = h.title
+			}
+			if sections[len(sections)-1].start == start {
+				sections[len(sections)-1].headings = headings
+			} else {
+				sections = append(sections, section{start: start, headings: headings})
+			}
+		}
+		start = end
+	}
+	return sections
+}
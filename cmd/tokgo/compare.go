@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+
+	"github.com/currybab/tokgo/compare"
+	"github.com/currybab/tokgo/mod"
+)
+
+func runCompare(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("compare", stderr)
+	encodingNames := flags.String("encodings", "cl100k_base,o200k_base", "comma separated encodings, the first is the baseline")
+	modelNames := flags.String("models", "", "comma separated models, overrides -encodings")
+	field := flags.String("field", "", "read JSONL and compare the text at this dot separated field, such as messages.content")
+	top := flags.Int("top", compare.DefaultTopPieces, "number of differing pieces to show, 0 for none")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: tokgo compare [flags] [file or directory ...]")
+		fmt.Fprintln(stderr, "Compares the token counts of files, directories or JSONL fields between encodings, stdin is read if no path is given.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	encodings, err := resolveEncodings(newRegistry(), *encodingNames, *modelNames)
+	if err != nil {
+		return fail(stderr, "compare", err)
+	}
+
+	var documents iter.Seq2[compare.Document, error]
+	paths := flags.Args()
+	switch {
+	case len(paths) == 0 || (len(paths) == 1 && paths[0] == "-"):
+		if *field != "" {
+			documents = compare.JSONL("stdin", stdin, *field)
+		} else {
+			text, err := io.ReadAll(stdin)
+			if err != nil {
+				return fail(stderr, "compare", err)
+			}
+			documents = func(yield func(compare.Document, error) bool) {
+				yield(compare.Document{Name: "stdin", Text: string(text)}, nil)
+			}
+		}
+	case *field != "":
+		documents = compare.JSONLFiles(*field, paths...)
+	default:
+		documents = compare.Files(paths...)
+	}
+
+	options := compare.Options{TopPieces: *top}
+	if *top <= 0 {
+		options.TopPieces = -1
+	}
+	report, err := compare.Compare(encodings, documents, options)
+	if err != nil {
+		return fail(stderr, "compare", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		return fail(stderr, "compare", err)
+	}
+	return 0
+}
+
+// resolveEncodings looks up the comma separated models, or the encodings if there are none.
+func resolveEncodings(registry mod.EncodingRegistry, encodingNames string, modelNames string) ([]mod.Encoding, error) {
+	lookup, names := registry.GetEncoding, encodingNames
+	if modelNames != "" {
+		lookup, names = registry.GetEncodingForModel, modelNames
+	}
+
+	var encodings []mod.Encoding
+	for _, name := range strings.Split(names, ",") {
+		encoding, err := lookup(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, encoding)
+	}
+	return encodings, nil
+}
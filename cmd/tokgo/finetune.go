@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/currybab/tokgo/finetune"
+	"github.com/currybab/tokgo/mod"
+)
+
+func runFinetuneCheck(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("finetune-check", stderr)
+	modelName := flags.String("model", mod.GPT_4O_MINI.GetName(), "name of the model to fine-tune")
+	epochs := flags.Int("epochs", 0, "number of training epochs, 0 to choose it like the fine-tuning API")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: tokgo finetune-check [flags] [file.jsonl]")
+		fmt.Fprintln(stderr, "Validates a chat fine-tuning dataset and estimates its training tokens, stdin is read if no file is given.")
+		fmt.Fprintln(stderr, "Exits with 1 if an example is invalid.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	model, ok := mod.ModelTypeFromName(*modelName)
+	if !ok {
+		return fail(stderr, "finetune-check", fmt.Errorf("model %s not found", *modelName))
+	}
+	encoding, err := newRegistry().GetEncodingForModelType(*model)
+	if err != nil {
+		return fail(stderr, "finetune-check", err)
+	}
+
+	input := stdin
+	if path := flags.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fail(stderr, "finetune-check", err)
+		}
+		defer file.Close()
+		input = file
+	}
+	report, err := finetune.Check(input, encoding, *model, finetune.Options{Epochs: *epochs})
+	if err != nil {
+		return fail(stderr, "finetune-check", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		return fail(stderr, "finetune-check", err)
+	}
+	if len(report.Issues) > 0 {
+		return 1
+	}
+	return 0
+}
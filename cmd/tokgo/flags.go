@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/currybab/tokgo/mod"
+	tokgo "github.com/currybab/tokgo/registry"
+)
+
+// encodingFlags selects an encoding by its name or by a model name.
+type encodingFlags struct {
+	encoding string
+	model    string
+}
+
+func (f *encodingFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.encoding, "encoding", mod.CL100K_BASE.GetName(), "name of the encoding")
+	flags.StringVar(&f.model, "model", "", "name of a model, overrides -encoding")
+}
+
+func (f *encodingFlags) resolve(registry mod.EncodingRegistry) (mod.Encoding, error) {
+	if f.model != "" {
+		return registry.GetEncodingForModel(f.model)
+	}
+	return registry.GetEncoding(f.encoding)
+}
+
+func newRegistry() mod.EncodingRegistry {
+	return tokgo.NewLazyEncodingRegistry()
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("tokgo "+name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	return flags
+}
+
+// readText returns the arguments joined by spaces, or the contents of file, or stdin
+// if there are neither arguments nor a file (or the file is "-").
+func readText(args []string, file string, stdin io.Reader) (string, error) {
+	switch {
+	case file != "" && file != "-":
+		data, err := os.ReadFile(file)
+		return string(data), err
+	case len(args) > 0 && file == "":
+		return strings.Join(args, " "), nil
+	default:
+		data, err := io.ReadAll(stdin)
+		return string(data), err
+	}
+}
+
+// fail reports err on stderr and returns the exit code of a failed command.
+func fail(stderr io.Writer, name string, err error) int {
+	fmt.Fprintf(stderr, "tokgo %s: %v\n", name, err)
+	return 1
+}
@@ -0,0 +1,61 @@
+// Command tokgo inspects how texts are tokenized.
+//
+// Usage:
+//
+//	tokgo <command> [flags] [text]
+//
+// Run "tokgo help" for the list of commands.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "show", summary: "show the token boundaries of a text", run: runShow},
+		{name: "compare", summary: "compare token counts of a corpus between encodings", run: runCompare},
+		{name: "finetune-check", summary: "validate a chat fine-tuning dataset and count its tokens", run: runFinetuneCheck},
+		{name: "verify", summary: "verify an encoding against a golden CSV file", run: runVerify},
+		{name: "serve", summary: "serve encodings as JSON over HTTP", run: runServe},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command named by args[0] and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		return 2
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "tokgo: unknown command %q\n", args[0])
+	printUsage(stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: tokgo <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", c.name, c.summary)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr strings.Builder
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestUnknownCommand(t *testing.T) {
+	code, _, stderr := runCommand(t, "", "nope")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "nope"`)
+	assert.Contains(t, stderr, "show")
+}
+
+func TestShow(t *testing.T) {
+	code, stdout, _ := runCommand(t, "", "show", "-encoding", "r50k_base", "hello", "world")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "\x1b[30;48;5;153mhello\x1b[0m\x1b[30;48;5;157m·world\x1b[0m\n", stdout)
+
+	code, stdout, _ = runCommand(t, "hello", "show", "-model", "gpt-4o", "-format", "html")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, `title="24912">hello</span>`)
+
+	code, _, stderr := runCommand(t, "", "show", "-encoding", "unknown", "hi")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "encoding unknown not found")
+}
+
+func TestCompare(t *testing.T) {
+	code, stdout, _ := runCommand(t, `{"text":"Hola, ¿cómo estás?"}`, "compare", "-field", "text")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "stdin:1")
+	assert.Contains(t, stdout, "cl100k_base")
+	assert.Contains(t, stdout, "o200k_base")
+	assert.Contains(t, stdout, "pieces that differ most")
+
+	code, stdout, _ = runCommand(t, "hello", "compare", "-models", "gpt-4,gpt-4o", "-json", "-top", "0")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, `"totals": [`)
+	assert.Contains(t, stdout, `"pieces": []`)
+}
+
+func TestFinetuneCheck(t *testing.T) {
+	dataset := `{"messages": [{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello"}]}`
+	code, stdout, _ := runCommand(t, dataset, "finetune-check", "-model", "gpt-4o-mini", "-epochs", "2")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "model gpt-4o-mini (o200k_base, context length 128000)")
+	assert.Contains(t, stdout, "2 epochs")
+
+	code, stdout, _ = runCommand(t, dataset+"\n{}", "finetune-check", "-json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, `"kind": "missing_messages_list"`)
+
+	code, _, stderr := runCommand(t, dataset, "finetune-check", "-model", "unknown")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "model unknown not found")
+}
+
+func TestVerify(t *testing.T) {
+	golden := "input,output,outputMaxTokens2\nHello world!,\"[9906, 1917, 0]\",\"[9906, 1917]\"\n"
+	code, stdout, _ := runCommand(t, golden, "verify", "-model", "gpt-4")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "cl100k_base: 1 rows, 0 failed (max tokens 2)\n", stdout)
+
+	path := filepath.Join(t.TempDir(), "golden.csv")
+	assert.NoError(t, os.WriteFile(path, []byte(golden), 0o644))
+	code, stdout, _ = runCommand(t, "", "verify", "-encoding", "o200k_base", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "line 2: encode: tokens differ from index 0")
+	assert.Contains(t, stdout, `expected: [9906 "`)
+
+	ranks := filepath.Join(t.TempDir(), "tiny.tiktoken")
+	assert.NoError(t, os.WriteFile(ranks, []byte("YQ== 0\nYg== 1\nIA== 2\nYWI= 3\n"), 0o644))
+	code, stdout, _ = runCommand(t, "input,output\nab ba,\"[3, 2, 1, 0]\"\n", "verify", "-ranks", ranks, "-pattern", `\S+|\s+`, "-max-tokens", "1", "-json")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, `"encoding": "tiny"`)
+	assert.Contains(t, stdout, `"max_tokens": 1`)
+
+	code, _, stderr := runCommand(t, "", "verify", "-ranks", ranks)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "Usage: tokgo verify")
+
+	code, _, stderr = runCommand(t, "text\n", "verify")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "is not input,output")
+}
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		io.WriteString(w, "done")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, listener, handler)
+	}()
+
+	responses := make(chan string, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		responses <- string(body)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-served:
+		t.Fatal("serve returned before the running request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(finish)
+	assert.Equal(t, "done", <-responses)
+	assert.NoError(t, <-served)
+}
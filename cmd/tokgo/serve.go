@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/metrics"
+	tokgo "github.com/currybab/tokgo/registry"
+	"github.com/currybab/tokgo/server"
+)
+
+// shutdownTimeout is how long running requests may take to finish after a shutdown signal.
+const shutdownTimeout = 10 * time.Second
+
+func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("serve", stderr)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	maxRequestBytes := flags.Int64("max-request-bytes", server.DefaultMaxRequestBytes, "largest request body")
+	maxBatchSize := flags.Int("max-batch", server.DefaultMaxBatchSize, "largest number of texts or token lists in a request")
+	publishMetrics := flags.Bool("metrics", false, "publish the calls, tokens and durations per encoding at /debug/vars")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: tokgo serve [flags]")
+		fmt.Fprintln(stderr, "Serves /encode, /decode, /count and /models as JSON endpoints until interrupted.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fail(stderr, "serve", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var options []encoding.Option
+	if *publishMetrics {
+		options = append(options, encoding.WithObserver(metrics.PublishExpvarObserver("tokgo")))
+	}
+	var handler http.Handler = server.NewHandler(tokgo.NewLazyEncodingRegistry(options...), server.Options{MaxRequestBytes: *maxRequestBytes, MaxBatchSize: *maxBatchSize})
+	if *publishMetrics {
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		mux.Handle("GET /debug/vars", expvar.Handler())
+		handler = mux
+	}
+
+	fmt.Fprintf(stderr, "tokgo serve: listening on %s\n", listener.Addr())
+	if err := serve(ctx, listener, handler); err != nil {
+		return fail(stderr, "serve", err)
+	}
+	return 0
+}
+
+// serve answers requests on listener until ctx is done, then waits for the running requests to finish.
+func serve(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	httpServer := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
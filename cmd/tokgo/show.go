@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/currybab/tokgo/visualize"
+)
+
+func runShow(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("show", stderr)
+	var encodingFlags encodingFlags
+	encodingFlags.register(flags)
+	format := flags.String("format", "ansi", "output format, ansi or html")
+	file := flags.String("file", "", "read the text from a file, - for stdin")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: tokgo show [flags] [text]")
+		fmt.Fprintln(stderr, "Shows the token boundaries of text, which is read from stdin if not given.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	encoding, err := encodingFlags.resolve(newRegistry())
+	if err != nil {
+		return fail(stderr, "show", err)
+	}
+	text, err := readText(flags.Args(), *file, stdin)
+	if err != nil {
+		return fail(stderr, "show", err)
+	}
+
+	switch *format {
+	case "ansi":
+		err = visualize.WriteANSI(stdout, encoding, text)
+	case "html":
+		err = visualize.WriteHTML(stdout, encoding, text)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return fail(stderr, "show", err)
+	}
+	return 0
+}
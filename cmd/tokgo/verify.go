@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/currybab/tokgo/conformance"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/dlclark/regexp2"
+)
+
+func runVerify(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("verify", stderr)
+	var selected encodingFlags
+	selected.register(flags)
+	ranks := flags.String("ranks", "", "file of a custom encoding in the .tiktoken format, verified instead of -encoding")
+	pattern := flags.String("pattern", "", "pre-tokenization pattern of the custom encoding, required with -ranks")
+	maxTokens := flags.Int("max-tokens", 0, fmt.Sprintf("max tokens of the truncation check if the file has no outputMaxTokensN column (default %d)", conformance.DEFAULT_MAX_TOKENS))
+	diffs := flags.Int("diffs", 5, "number of mismatches to print a diff for")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: tokgo verify [flags] [golden.csv]")
+		fmt.Fprintln(stderr, "Verifies the encode, max-token truncation and round-trip of an encoding against a golden CSV file")
+		fmt.Fprintln(stderr, "with the columns input,output[,outputMaxTokensN], stdin is read if no file is given.")
+		fmt.Fprintln(stderr, "Exits with 1 if a row doesn't match.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 || (*ranks != "") != (*pattern != "") {
+		flags.Usage()
+		return 2
+	}
+
+	var enc mod.Encoding
+	var err error
+	if *ranks != "" {
+		enc, err = customEncoding(*ranks, *pattern)
+	} else {
+		enc, err = selected.resolve(newRegistry())
+	}
+	if err != nil {
+		return fail(stderr, "verify", err)
+	}
+
+	input := stdin
+	if path := flags.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fail(stderr, "verify", err)
+		}
+		defer file.Close()
+		input = file
+	}
+	report, err := conformance.Verify(enc, input, conformance.Options{MaxTokens: *maxTokens})
+	if err != nil {
+		return fail(stderr, "verify", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(stdout, *diffs)
+	}
+	if err != nil {
+		return fail(stderr, "verify", err)
+	}
+	if len(report.Mismatches) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// customEncoding reads the ranks of an encoding without special tokens, named after its file.
+func customEncoding(ranksFile string, pattern string) (mod.Encoding, error) {
+	regex, err := regexp2.Compile(pattern, regexp2.None)
+	if err != nil {
+		return nil, fmt.Errorf("pattern: %w", err)
+	}
+	file, err := os.Open(ranksFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ranks, err := encoding.ReadMergeableRanks(file)
+	if err != nil {
+		return nil, fmt.Errorf("ranks of %s: %w", ranksFile, err)
+	}
+	if len(ranks) == 0 {
+		return nil, errors.New("no ranks in " + ranksFile)
+	}
+	name := strings.TrimSuffix(filepath.Base(ranksFile), filepath.Ext(ranksFile))
+	return encoding.FromParameters(mod.NewGptBytePairEncodingParams(name, regex, ranks, map[string]int{})), nil
+}
@@ -0,0 +1,234 @@
+// Package compare measures how the token counts of a corpus change between encodings,
+// for example before migrating from cl100k_base to o200k_base.
+package compare
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// DefaultTopPieces is the number of differing pieces kept by Compare when Options.TopPieces is zero.
+const DefaultTopPieces = 20
+
+// Document is a named text of the compared corpus.
+type Document struct {
+	Name string
+	Text string
+}
+
+// DocumentReport holds the token counts of a document, in the order of Report.Encodings.
+type DocumentReport struct {
+	Name   string `json:"name"`
+	Bytes  int    `json:"bytes"`
+	Counts []int  `json:"counts"`
+}
+
+// PieceDifference is a piece of the baseline pre-tokenizer whose token count differs between encodings.
+type PieceDifference struct {
+	Piece       string `json:"piece"`
+	Occurrences int    `json:"occurrences"`
+	// Counts are the tokens of a single occurrence, in the order of Report.Encodings.
+	Counts []int `json:"counts"`
+	// Delta is the largest total difference to the baseline over all occurrences, negative if tokens are saved.
+	Delta int `json:"delta"`
+}
+
+// Report is the result of Compare. The first encoding is the baseline of the ratios and differences.
+type Report struct {
+	Encodings []string          `json:"encodings"`
+	Documents []DocumentReport  `json:"documents"`
+	Bytes     int               `json:"bytes"`
+	Totals    []int             `json:"totals"`
+	Pieces    []PieceDifference `json:"pieces"`
+}
+
+// Options configures Compare.
+type Options struct {
+	// TopPieces is the number of most differing pieces to report, DefaultTopPieces if zero and none if negative.
+	TopPieces int
+}
+
+// Ratio returns the token count of encoding i relative to the baseline.
+func (d DocumentReport) Ratio(i int) float64 {
+	return ratio(d.Counts[i], d.Counts[0])
+}
+
+// Ratio returns the total token count of encoding i relative to the baseline.
+func (r *Report) Ratio(i int) float64 {
+	return ratio(r.Totals[i], r.Totals[0])
+}
+
+func ratio(count int, baseline int) float64 {
+	if baseline == 0 {
+		if count == 0 {
+			return 1
+		}
+		return math.Inf(1)
+	}
+	return float64(count) / float64(baseline)
+}
+
+// Compare counts the tokens of every document with every encoding, special tokens are counted as ordinary text.
+// The pieces that differ are taken from the pre-tokenizer of the first encoding, if it implements
+// mod.PieceEncoding, and counted on their own with each encoding.
+// It stops at the first error of documents.
+func Compare(encodings []mod.Encoding, documents iter.Seq2[Document, error], options Options) (*Report, error) {
+	if len(encodings) == 0 {
+		return nil, fmt.Errorf("no encodings to compare")
+	}
+
+	report := &Report{
+		Encodings: make([]string, len(encodings)),
+		Documents: []DocumentReport{},
+		Totals:    make([]int, len(encodings)),
+	}
+	for i, encoding := range encodings {
+		report.Encodings[i] = encoding.GetName()
+	}
+
+	pieces := newPieceCounter(encodings)
+	for document, err := range documents {
+		if err != nil {
+			return nil, err
+		}
+		documentReport := DocumentReport{Name: document.Name, Bytes: len(document.Text), Counts: make([]int, len(encodings))}
+		for i, encoding := range encodings {
+			documentReport.Counts[i] = encoding.CountTokensOrdinary(document.Text)
+			report.Totals[i] += documentReport.Counts[i]
+		}
+		report.Bytes += documentReport.Bytes
+		report.Documents = append(report.Documents, documentReport)
+		if options.TopPieces >= 0 {
+			pieces.add(document.Text)
+		}
+	}
+
+	topPieces := options.TopPieces
+	if topPieces == 0 {
+		topPieces = DefaultTopPieces
+	}
+	report.Pieces = pieces.top(max(topPieces, 0))
+	return report, nil
+}
+
+// pieceCounter counts the occurrences of the baseline pieces and their tokens with every encoding.
+type pieceCounter struct {
+	encodings   []mod.Encoding
+	baseline    mod.PieceEncoding
+	occurrences map[string]int
+	counts      map[string][]int
+}
+
+func newPieceCounter(encodings []mod.Encoding) *pieceCounter {
+	baseline, _ := encodings[0].(mod.PieceEncoding)
+	return &pieceCounter{
+		encodings:   encodings,
+		baseline:    baseline,
+		occurrences: map[string]int{},
+		counts:      map[string][]int{},
+	}
+}
+
+func (p *pieceCounter) add(text string) {
+	if p.baseline == nil {
+		return
+	}
+	for piece := range p.baseline.Pieces(text) {
+		if p.occurrences[piece.Text] == 0 {
+			counts := make([]int, len(p.encodings))
+			differs := false
+			for i, encoding := range p.encodings {
+				counts[i] = encoding.CountTokensOrdinary(piece.Text)
+				differs = differs || counts[i] != counts[0]
+			}
+			if differs {
+				p.counts[piece.Text] = counts
+			}
+		}
+		p.occurrences[piece.Text]++
+	}
+}
+
+func (p *pieceCounter) top(n int) []PieceDifference {
+	differences := make([]PieceDifference, 0, len(p.counts))
+	for piece, counts := range p.counts {
+		occurrences := p.occurrences[piece]
+		delta := 0
+		for _, count := range counts[1:] {
+			if d := (count - counts[0]) * occurrences; abs(d) > abs(delta) {
+				delta = d
+			}
+		}
+		differences = append(differences, PieceDifference{Piece: piece, Occurrences: occurrences, Counts: counts, Delta: delta})
+	}
+	sort.Slice(differences, func(i, j int) bool {
+		if abs(differences[i].Delta) != abs(differences[j].Delta) {
+			return abs(differences[i].Delta) > abs(differences[j].Delta)
+		}
+		return differences[i].Piece < differences[j].Piece
+	})
+	return differences[:min(n, len(differences))]
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// WriteText writes the report as aligned tables of the documents, the totals and the differing pieces.
+func (r *Report) WriteText(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(table, "document\tbytes\t")
+	for i, name := range r.Encodings {
+		fmt.Fprintf(table, "%s\t", name)
+		if i > 0 {
+			fmt.Fprint(table, "ratio\t")
+		}
+	}
+	fmt.Fprintln(table)
+
+	writeRow := func(name string, bytes int, counts []int) {
+		fmt.Fprintf(table, "%s\t%d\t", name, bytes)
+		for i, count := range counts {
+			fmt.Fprintf(table, "%d\t", count)
+			if i > 0 {
+				fmt.Fprintf(table, "%.3f\t", ratio(count, counts[0]))
+			}
+		}
+		fmt.Fprintln(table)
+	}
+	for _, document := range r.Documents {
+		writeRow(document.Name, document.Bytes, document.Counts)
+	}
+	writeRow("total", r.Bytes, r.Totals)
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.Pieces) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "\npieces that differ most (pre-tokenized with %s):\n", r.Encodings[0])
+	table = tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(table, "piece\toccurrences\t")
+	for _, name := range r.Encodings {
+		fmt.Fprintf(table, "%s\t", name)
+	}
+	fmt.Fprintln(table, "delta\t")
+	for _, piece := range r.Pieces {
+		fmt.Fprintf(table, "%q\t%d\t", piece.Piece, piece.Occurrences)
+		for _, count := range piece.Counts {
+			fmt.Fprintf(table, "%d\t", count)
+		}
+		fmt.Fprintf(table, "%+d\t\n", piece.Delta)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,104 @@
+package compare_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/compare"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+var encodings = []mod.Encoding{encoding.Cl100kBase(), encoding.O200kBase()}
+
+func documents(texts ...string) func(yield func(compare.Document, error) bool) {
+	return func(yield func(compare.Document, error) bool) {
+		for i, text := range texts {
+			if !yield(compare.Document{Name: string(rune('a' + i)), Text: text}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestCompareCountsDocumentsAndTotals(t *testing.T) {
+	texts := []string{"Hola, ¿cómo estás? estás estás", "The quick brown fox", ""}
+	report, err := compare.Compare(encodings, documents(texts...), compare.Options{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"cl100k_base", "o200k_base"}, report.Encodings)
+	assert.Len(t, report.Documents, 3)
+	totals := make([]int, 2)
+	for i, document := range report.Documents {
+		for j, encoding := range encodings {
+			assert.Equal(t, encoding.CountTokensOrdinary(texts[i]), document.Counts[j])
+			totals[j] += document.Counts[j]
+		}
+	}
+	assert.Equal(t, totals, report.Totals)
+	assert.Equal(t, 1.0, report.Documents[2].Ratio(1))
+	assert.InDelta(t, float64(totals[1])/float64(totals[0]), report.Ratio(1), 1e-9)
+
+	assert.Equal(t, compare.PieceDifference{Piece: " estás", Occurrences: 3, Counts: []int{2, 1}, Delta: -3}, report.Pieces[0])
+	for _, piece := range report.Pieces {
+		assert.NotEqual(t, piece.Counts[0], piece.Counts[1])
+	}
+
+	var text strings.Builder
+	assert.NoError(t, report.WriteText(&text))
+	assert.Contains(t, text.String(), "total")
+	assert.Contains(t, text.String(), `" estás"`)
+}
+
+func TestCompareLimitsPieces(t *testing.T) {
+	report, err := compare.Compare(encodings, documents("Hola, ¿cómo estás? cómo"), compare.Options{TopPieces: 1})
+	assert.NoError(t, err)
+	assert.Len(t, report.Pieces, 1)
+
+	report, err = compare.Compare(encodings, documents("Hola, ¿cómo estás? cómo"), compare.Options{TopPieces: -1})
+	assert.NoError(t, err)
+	assert.Empty(t, report.Pieces)
+}
+
+func TestFilesWalksDirectories(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "b"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("first"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b", "c.txt"), []byte("second"), 0o644))
+	single := filepath.Join(t.TempDir(), "single.txt")
+	assert.NoError(t, os.WriteFile(single, []byte("third"), 0o644))
+
+	var texts []string
+	for document, err := range compare.Files(dir, single) {
+		assert.NoError(t, err)
+		texts = append(texts, document.Text)
+	}
+	assert.Equal(t, []string{"first", "second", "third"}, texts)
+
+	for _, err := range compare.Files(filepath.Join(dir, "missing")) {
+		assert.Error(t, err)
+	}
+}
+
+func TestJSONLReadsNestedFields(t *testing.T) {
+	input := `{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}
+
+{"messages":[{"content":"Bye"}]}
+`
+	var documents []compare.Document
+	for document, err := range compare.JSONL("chat.jsonl", strings.NewReader(input), "messages.content") {
+		assert.NoError(t, err)
+		documents = append(documents, document)
+	}
+	assert.Equal(t, []compare.Document{
+		{Name: "chat.jsonl:1", Text: "Be brief.\nHi"},
+		{Name: "chat.jsonl:3", Text: "Bye"},
+	}, documents)
+
+	for _, err := range compare.JSONL("bad.jsonl", strings.NewReader(`{"text": 1}`), "text") {
+		assert.EqualError(t, err, `bad.jsonl:1: no string at field "text"`)
+	}
+}
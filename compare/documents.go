@@ -0,0 +1,142 @@
+package compare
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxJSONLLineBytes is the longest JSONL line that can be read.
+const maxJSONLLineBytes = 64 * 1024 * 1024
+
+// Files yields a document per file. Directories are walked recursively in lexical order.
+func Files(paths ...string) iter.Seq2[Document, error] {
+	return func(yield func(Document, error) bool) {
+		for file, err := range walkFiles(paths) {
+			if err != nil {
+				yield(Document{}, err)
+				return
+			}
+			data, err := os.ReadFile(file)
+			if !yield(Document{Name: file, Text: string(data)}, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// JSONLFiles yields a document per line of the JSONL files with the text of field, see JSONL.
+// Directories are walked recursively in lexical order.
+func JSONLFiles(field string, paths ...string) iter.Seq2[Document, error] {
+	return func(yield func(Document, error) bool) {
+		for file, err := range walkFiles(paths) {
+			if err != nil {
+				yield(Document{}, err)
+				return
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				yield(Document{}, err)
+				return
+			}
+			stopped := false
+			for document, err := range JSONL(file, f, field) {
+				if !yield(document, err) || err != nil {
+					stopped = true
+					break
+				}
+			}
+			f.Close()
+			if stopped {
+				return
+			}
+		}
+	}
+}
+
+// JSONL yields a document named "name:line" per non-empty line of r, with the text of field.
+// field is a dot separated path of object keys, such as "messages.content". Arrays on the path
+// are entered element by element and all strings found are joined with newlines.
+func JSONL(name string, r io.Reader, field string) iter.Seq2[Document, error] {
+	path := strings.Split(field, ".")
+	return func(yield func(Document, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLLineBytes)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			documentName := fmt.Sprintf("%s:%d", name, line)
+			var value any
+			if err := json.Unmarshal(scanner.Bytes(), &value); err != nil {
+				yield(Document{}, fmt.Errorf("%s: %w", documentName, err))
+				return
+			}
+			texts := fieldTexts(value, path, nil)
+			if len(texts) == 0 {
+				yield(Document{}, fmt.Errorf("%s: no string at field %q", documentName, field))
+				return
+			}
+			if !yield(Document{Name: documentName, Text: strings.Join(texts, "\n")}, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(Document{}, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+}
+
+// fieldTexts appends the strings found at path in value to texts.
+func fieldTexts(value any, path []string, texts []string) []string {
+	switch v := value.(type) {
+	case []any:
+		for _, element := range v {
+			texts = fieldTexts(element, path, texts)
+		}
+	case map[string]any:
+		if len(path) > 0 {
+			texts = fieldTexts(v[path[0]], path[1:], texts)
+		}
+	case string:
+		if len(path) == 0 {
+			texts = append(texts, v)
+		}
+	}
+	return texts
+}
+
+// walkFiles yields the regular files of paths, walking directories recursively.
+func walkFiles(paths []string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		stopped := false
+		for _, path := range paths {
+			err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !entry.Type().IsRegular() {
+					return nil
+				}
+				if !yield(file, nil) {
+					stopped = true
+					return filepath.SkipAll
+				}
+				return nil
+			})
+			if err != nil {
+				yield("", err)
+				return
+			}
+			if stopped {
+				return
+			}
+		}
+	}
+}
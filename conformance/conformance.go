@@ -0,0 +1,360 @@
+// Package conformance verifies encodings against golden CSV files, the fixtures the reference
+// tests of the built-in encodings use. Teams registering custom encodings can check them the
+// same way, with Verify or the tokgo verify command.
+//
+// A golden file has a header and a row per input:
+//
+//	input,output,outputMaxTokens10
+//	Hello world!,"[9906, 1917, 0]","[9906, 1917, 0]"
+//
+// output are the tokens of EncodeOrdinary and the optional third column the tokens of
+// EncodeOrdinary limited to the number of tokens its name ends with.
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// DEFAULT_MAX_TOKENS limits the truncation check of golden files without a truncated output column.
+const DEFAULT_MAX_TOKENS = 10
+
+// Checks of the rows of a golden file.
+const (
+	// Encode checks that the input encodes to the output.
+	Encode = "encode"
+	// Truncate checks that the input encoded with max tokens is the truncated output and is
+	// reported as truncated if the output is longer.
+	Truncate = "truncate"
+	// RoundTrip checks that the tokens decode to the input, and the truncated tokens to a prefix of it.
+	RoundTrip = "round_trip"
+)
+
+var errEmpty = errors.New("golden file is empty")
+
+// maxTokensColumn prefixes the name of the truncated output column.
+const maxTokensColumn = "outputMaxTokens"
+
+// Mismatch is a failed check of the row at a line.
+type Mismatch struct {
+	Line  int    `json:"line"`
+	Check string `json:"check"`
+	Input string `json:"input"`
+	// Expected and Actual are the tokens of Encode and Truncate mismatches.
+	Expected []int  `json:"expected,omitempty"`
+	Actual   []int  `json:"actual,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Options configures Verify.
+type Options struct {
+	// MaxTokens limits the truncation check of golden files without a truncated output column,
+	// DEFAULT_MAX_TOKENS if zero. The column name sets it otherwise.
+	MaxTokens int
+}
+
+// Report is the result of Verify.
+type Report struct {
+	Encoding   string     `json:"encoding"`
+	MaxTokens  int        `json:"max_tokens"`
+	Rows       int        `json:"rows"`
+	FailedRows int        `json:"failed_rows"`
+	Mismatches []Mismatch `json:"mismatches"`
+
+	encoding mod.Encoding
+}
+
+// Row is a row of a golden file.
+type Row struct {
+	Line   int
+	Input  string
+	Output []int
+	// OutputMaxTokens is nil if the golden file has no truncated output column.
+	OutputMaxTokens []int
+}
+
+// ParseTokens parses a list of tokens like "[9906, 1917, 0]".
+func ParseTokens(s string) ([]int, error) {
+	inner, ok := strings.CutPrefix(strings.TrimSpace(s), "[")
+	if ok {
+		inner, ok = strings.CutSuffix(inner, "]")
+	}
+	if !ok {
+		return nil, fmt.Errorf("tokens %q are not a list", s)
+	}
+	tokens := []int{}
+	if strings.TrimSpace(inner) == "" {
+		return tokens, nil
+	}
+	for _, field := range strings.Split(inner, ",") {
+		token, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("tokens %q: %w", s, err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// GoldenFile reads the rows of a golden file.
+type GoldenFile struct {
+	it *CsvIterator
+	// MaxTokens is the limit of the truncated output column, 0 if there is none.
+	MaxTokens int
+}
+
+// OpenGoldenFile opens the golden file at filePath and reads its header.
+// The caller is responsible for calling Close() when done.
+func OpenGoldenFile(filePath string) (*GoldenFile, error) {
+	it, err := NewCsvIterator(filePath, true)
+	if err == io.EOF {
+		return nil, errEmpty
+	} else if err != nil {
+		return nil, err
+	}
+	golden, err := newGoldenFile(it)
+	if err != nil {
+		it.Close()
+		return nil, err
+	}
+	return golden, nil
+}
+
+// NewGoldenFile reads the header of the golden file r.
+func NewGoldenFile(r io.Reader) (*GoldenFile, error) {
+	it, err := NewCsvReaderIterator(r, true)
+	if err == io.EOF {
+		return nil, errEmpty
+	} else if err != nil {
+		return nil, err
+	}
+	return newGoldenFile(it)
+}
+
+func newGoldenFile(it *CsvIterator) (*GoldenFile, error) {
+	maxTokens, err := parseHeader(it.Header())
+	if err != nil {
+		return nil, err
+	}
+	return &GoldenFile{it: it, MaxTokens: maxTokens}, nil
+}
+
+// Rows returns the rows of the golden file, stopping at the first row that can't be read.
+func (g *GoldenFile) Rows() iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		for g.it.Next() {
+			row, err := parseRow(g.it.Record(), g.it.Line(), g.MaxTokens > 0)
+			if !yield(row, err) || err != nil {
+				return
+			}
+		}
+		if err := g.it.Err(); err != nil {
+			yield(Row{}, err)
+		}
+	}
+}
+
+// Close closes the file opened by OpenGoldenFile.
+func (g *GoldenFile) Close() error {
+	return g.it.Close()
+}
+
+// parseHeader checks the columns of a golden file and returns the limit of its truncated output column.
+func parseHeader(header []string) (int, error) {
+	if len(header) < 2 || len(header) > 3 || header[0] != "input" || header[1] != "output" {
+		return 0, fmt.Errorf("header %q is not input,output[,%sN]", strings.Join(header, ","), maxTokensColumn)
+	}
+	if len(header) == 2 {
+		return 0, nil
+	}
+	suffix, ok := strings.CutPrefix(header[2], maxTokensColumn)
+	maxTokens, err := strconv.Atoi(suffix)
+	if !ok || err != nil || maxTokens <= 0 {
+		return 0, fmt.Errorf("column %q is not %sN", header[2], maxTokensColumn)
+	}
+	return maxTokens, nil
+}
+
+func parseRow(record []string, line int, truncated bool) (Row, error) {
+	columns := 2
+	if truncated {
+		columns = 3
+	}
+	if len(record) != columns {
+		return Row{}, fmt.Errorf("line %d has %d columns, not %d", line, len(record), columns)
+	}
+	row := Row{Line: line, Input: record[0]}
+	var err error
+	if row.Output, err = ParseTokens(record[1]); err != nil {
+		return Row{}, fmt.Errorf("line %d: %w", line, err)
+	}
+	if truncated {
+		if row.OutputMaxTokens, err = ParseTokens(record[2]); err != nil {
+			return Row{}, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return row, nil
+}
+
+// Verify checks every row of the golden file r against encoding, see CheckRow. An error is only
+// returned if r can't be read or isn't a golden file.
+func Verify(encoding mod.Encoding, r io.Reader, options Options) (*Report, error) {
+	golden, err := NewGoldenFile(r)
+	if err != nil {
+		return nil, err
+	}
+	maxTokens := golden.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = options.MaxTokens
+	}
+	if maxTokens == 0 {
+		maxTokens = DEFAULT_MAX_TOKENS
+	}
+
+	report := &Report{Encoding: encoding.GetName(), MaxTokens: maxTokens, Mismatches: []Mismatch{}, encoding: encoding}
+	for row, err := range golden.Rows() {
+		if err != nil {
+			return nil, err
+		}
+		report.Rows++
+		mismatches := CheckRow(encoding, row, maxTokens)
+		if len(mismatches) > 0 {
+			report.FailedRows++
+			report.Mismatches = append(report.Mismatches, mismatches...)
+		}
+	}
+	return report, nil
+}
+
+// CheckRow checks that the input of row encodes to its output, that it is truncated to
+// maxTokens tokens like its truncated output and that both decode back to the input or a
+// prefix of it. Without a truncated output, the truncated tokens are checked to be a prefix
+// of the encoded tokens instead.
+func CheckRow(encoding mod.Encoding, row Row, maxTokens int) []Mismatch {
+	var mismatches []Mismatch
+	mismatch := func(check string, expected, actual []int, format string, args ...any) {
+		mismatches = append(mismatches, Mismatch{
+			Line:     row.Line,
+			Check:    check,
+			Input:    row.Input,
+			Expected: expected,
+			Actual:   actual,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	tokens := encoding.EncodeOrdinaryToIntArray(row.Input)
+	if i := firstDifference(row.Output, tokens); i >= 0 {
+		mismatch(Encode, row.Output, tokens, "tokens differ from index %d", i)
+	}
+	if decoded := encoding.Decode(tokens); decoded != row.Input {
+		mismatch(RoundTrip, nil, nil, "tokens decode to %q", decoded)
+	}
+
+	result := encoding.EncodeOrdinary(row.Input, maxTokens)
+	truncated := result.GetTokens()
+	if row.OutputMaxTokens != nil {
+		if i := firstDifference(row.OutputMaxTokens, truncated); i >= 0 {
+			mismatch(Truncate, row.OutputMaxTokens, truncated, "tokens truncated to %d differ from index %d", maxTokens, i)
+		}
+	} else if len(truncated) > maxTokens || !isPrefix(truncated, tokens) {
+		mismatch(Truncate, tokens, truncated, "tokens truncated to %d are not a prefix of the tokens", maxTokens)
+	}
+	expected := row.OutputMaxTokens
+	if expected == nil {
+		expected = truncated
+	}
+	if isTruncated := len(tokens) > len(expected); result.IsTruncated() != isTruncated {
+		mismatch(Truncate, nil, nil, "truncated is %t, not %t", result.IsTruncated(), isTruncated)
+	}
+	if decoded := encoding.Decode(truncated); !strings.HasPrefix(row.Input, decoded) {
+		mismatch(RoundTrip, nil, nil, "tokens truncated to %d decode to %q, not a prefix of the input", maxTokens, decoded)
+	}
+	return mismatches
+}
+
+// firstDifference returns the first index at which expected and actual differ, -1 if they are equal.
+func firstDifference(expected, actual []int) int {
+	for i := range min(len(expected), len(actual)) {
+		if expected[i] != actual[i] {
+			return i
+		}
+	}
+	if len(expected) == len(actual) {
+		return -1
+	}
+	return min(len(expected), len(actual))
+}
+
+func isPrefix(prefix, tokens []int) bool {
+	return len(prefix) <= len(tokens) && slices.Equal(prefix, tokens[:len(prefix)])
+}
+
+// diffContext is the number of equal tokens shown before the first difference, and
+// diffTokens the number of tokens shown from it.
+const (
+	diffContext = 2
+	diffTokens  = 8
+)
+
+// WriteText writes the report as text, with a diff of the tokens for the first diffs mismatches.
+func (r *Report) WriteText(w io.Writer, diffs int) error {
+	fmt.Fprintf(w, "%s: %d rows, %d failed (max tokens %d)\n", r.Encoding, r.Rows, r.FailedRows, r.MaxTokens)
+	for i, m := range r.Mismatches {
+		if i == diffs {
+			fmt.Fprintf(w, "\n%d more mismatches\n", len(r.Mismatches)-diffs)
+			break
+		}
+		fmt.Fprintf(w, "\nline %d: %s: %s\n", m.Line, m.Check, m.Message)
+		fmt.Fprintf(w, "  input:    %q\n", abbreviate(m.Input))
+		if m.Expected == nil && m.Actual == nil {
+			continue
+		}
+		start := max(firstDifference(m.Expected, m.Actual)-diffContext, 0)
+		if m.Expected != nil {
+			fmt.Fprintf(w, "  expected: %s\n", r.formatTokens(m.Expected, start))
+		}
+		fmt.Fprintf(w, "  actual:   %s\n", r.formatTokens(m.Actual, start))
+	}
+	return nil
+}
+
+// formatTokens formats diffTokens+diffContext tokens from start, each followed by its decoded text.
+func (r *Report) formatTokens(tokens []int, start int) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	if start > 0 {
+		fmt.Fprintf(&b, "... (%d tokens) ", start)
+	}
+	end := min(len(tokens), start+diffContext+diffTokens)
+	for i := start; i < end; i++ {
+		if i > start {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%d", tokens[i])
+		if r.encoding != nil {
+			fmt.Fprintf(&b, " %q", r.encoding.DecodeBytes(tokens[i:i+1]))
+		}
+	}
+	if end < len(tokens) {
+		fmt.Fprintf(&b, " ... (%d tokens)", len(tokens)-end)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// abbreviate shortens long inputs, the row is found by its line.
+func abbreviate(input string) string {
+	const maxLength = 80
+	if len(input) <= maxLength {
+		return input
+	}
+	return strings.ToValidUTF8(input[:maxLength], "") + "..."
+}
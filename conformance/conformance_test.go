@@ -0,0 +1,118 @@
+package conformance_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/conformance"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const golden = `input,output,outputMaxTokens2
+Hello world!,"[9906, 1917, 0]","[9906, 1917]"
+"",[],[]
+hi,[6151],[6151]
+`
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := conformance.ParseTokens("[9906, 1917, 0]")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{9906, 1917, 0}, tokens)
+
+	tokens, err = conformance.ParseTokens("[]")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{}, tokens)
+
+	_, err = conformance.ParseTokens("9906")
+	assert.ErrorContains(t, err, "not a list")
+	_, err = conformance.ParseTokens("[9906, x]")
+	assert.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	report, err := conformance.Verify(encoding.Cl100kBase(), strings.NewReader(golden), conformance.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "cl100k_base", report.Encoding)
+	assert.Equal(t, 2, report.MaxTokens)
+	assert.Equal(t, 3, report.Rows)
+	assert.Equal(t, 0, report.FailedRows)
+	assert.Empty(t, report.Mismatches)
+}
+
+func TestVerifyReportsMismatches(t *testing.T) {
+	wrong := `input,output,outputMaxTokens2
+Hello world!,"[9906, 1917, 11]","[9906, 1917]"
+Hello world!,"[9906, 1917, 0]","[9906]"
+`
+	report, err := conformance.Verify(encoding.Cl100kBase(), strings.NewReader(wrong), conformance.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Rows)
+	assert.Equal(t, 2, report.FailedRows)
+	require.Len(t, report.Mismatches, 2)
+
+	assert.Equal(t, conformance.Mismatch{
+		Line:     2,
+		Check:    conformance.Encode,
+		Input:    "Hello world!",
+		Expected: []int{9906, 1917, 11},
+		Actual:   []int{9906, 1917, 0},
+		Message:  "tokens differ from index 2",
+	}, report.Mismatches[0])
+	assert.Equal(t, 3, report.Mismatches[1].Line)
+	assert.Equal(t, conformance.Truncate, report.Mismatches[1].Check)
+
+	var text strings.Builder
+	assert.NoError(t, report.WriteText(&text, 1))
+	assert.Equal(t, `cl100k_base: 2 rows, 2 failed (max tokens 2)
+
+line 2: encode: tokens differ from index 2
+  input:    "Hello world!"
+  expected: [9906 "Hello" 1917 " world" 11 ","]
+  actual:   [9906 "Hello" 1917 " world" 0 "!"]
+
+1 more mismatches
+`, text.String())
+}
+
+func TestVerifyWithoutTruncatedOutput(t *testing.T) {
+	report, err := conformance.Verify(encoding.Cl100kBase(), strings.NewReader("input,output\nHello world!,\"[9906, 1917, 0]\"\n"), conformance.Options{MaxTokens: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.MaxTokens)
+	assert.Empty(t, report.Mismatches)
+
+	report, err = conformance.Verify(encoding.R50kBase(), strings.NewReader("input,output\nHello world!,\"[9906, 1917, 0]\"\n"), conformance.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, conformance.DEFAULT_MAX_TOKENS, report.MaxTokens)
+	assert.Equal(t, 1, report.FailedRows)
+	assert.Equal(t, conformance.Encode, report.Mismatches[0].Check)
+}
+
+func TestVerifyRejectsInvalidGoldenFiles(t *testing.T) {
+	for golden, message := range map[string]string{
+		"":                                    "empty",
+		"text,tokens\n":                       "is not input,output",
+		"input,output,maxTokens\n":            "is not outputMaxTokensN",
+		"input,output\nhi,[6151],[6151]\n":    "line 2 has 3 columns, not 2",
+		"input,output\nhi,\"[6151, x]\"\n":    "line 2: tokens",
+		"input,output\nhi,\"[6151]\n":         "extraneous or missing",
+		"input,output,outputMaxTokens0\n":     "is not outputMaxTokensN",
+		"input,output,outputMaxTokens1\nhi\n": "line 2 has 1 columns, not 3",
+	} {
+		_, err := conformance.Verify(encoding.Cl100kBase(), strings.NewReader(golden), conformance.Options{})
+		assert.ErrorContains(t, err, message, golden)
+	}
+}
+
+func TestBasePromptsOfCl100kBase(t *testing.T) {
+	file, err := os.Open("../resources/test/base_prompts.csv")
+	require.NoError(t, err)
+	defer file.Close()
+
+	report, err := conformance.Verify(encoding.Cl100kBase(), file, conformance.Options{})
+	require.NoError(t, err)
+	assert.Greater(t, report.Rows, 400)
+	assert.Empty(t, report.Mismatches)
+}
@@ -0,0 +1,103 @@
+package conformance
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+)
+
+// CsvIterator helps to iterate over records in a CSV file.
+type CsvIterator struct {
+	reader  *csv.Reader
+	closer  io.Closer
+	header  []string
+	current []string
+	lastErr error
+}
+
+// NewCsvIterator creates a new CsvIterator for the given file path.
+// If skipHeader is true, it will attempt to read and discard the first line of the CSV.
+// The caller is responsible for calling Close() on the iterator when done.
+func NewCsvIterator(filePath string, skipHeader bool) (*CsvIterator, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	it, err := NewCsvReaderIterator(file, skipHeader)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	it.closer = file
+	return it, nil
+}
+
+// NewCsvReaderIterator creates a new CsvIterator reading from r, see NewCsvIterator.
+// Closing the iterator doesn't close r.
+func NewCsvReaderIterator(r io.Reader, skipHeader bool) (*CsvIterator, error) {
+	reader := csv.NewReader(r)
+	// Rows are checked by their users, golden files may or may not have a truncated output column.
+	reader.FieldsPerRecord = -1
+
+	it := &CsvIterator{reader: reader}
+	if skipHeader {
+		header, err := reader.Read()
+		if err != nil {
+			// An empty file has no header either.
+			return nil, err
+		}
+		it.header = header
+	}
+	return it, nil
+}
+
+// Header returns the skipped header, nil if it wasn't skipped.
+func (it *CsvIterator) Header() []string {
+	return it.header
+}
+
+// Next advances the iterator to the next record.
+// It returns true if a record was successfully read, false otherwise (EOF or error).
+// After Next returns false, the Err method should be checked to distinguish
+// between EOF and other errors.
+func (it *CsvIterator) Next() bool {
+	record, err := it.reader.Read()
+	if err != nil {
+		if err == io.EOF { // io.EOF is a clean end of file, not an error to be reported by Err()
+			it.lastErr = nil
+		} else {
+			it.lastErr = err
+		}
+		it.current = nil // Clear current record on EOF or error
+		return false
+	}
+	it.current = record
+	it.lastErr = nil
+	return true
+}
+
+// Record returns the current record. It should only be called after a successful call to Next.
+// The returned slice should not be modified by the caller if it's to be reused by the iterator.
+func (it *CsvIterator) Record() []string {
+	return it.current
+}
+
+// Line returns the line the current record starts at.
+func (it *CsvIterator) Line() int {
+	line, _ := it.reader.FieldPos(0)
+	return line
+}
+
+// Err returns the first non-EOF error that was encountered by the iterator.
+func (it *CsvIterator) Err() error {
+	return it.lastErr
+}
+
+// Close closes the underlying file. It should be called when done with the iterator
+// to release system resources.
+func (it *CsvIterator) Close() error {
+	if it.closer != nil {
+		return it.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+// Package embedding plans the requests of embeddings: it batches texts so that every input and every request
+// stays within the token and input limits of the endpoint, and splits or truncates the texts that are too long.
+package embedding
+
+import (
+	"fmt"
+	"iter"
+
+	"github.com/currybab/tokgo/chunk"
+	"github.com/currybab/tokgo/mod"
+)
+
+const (
+	// DefaultMaxRequestTokens limits the tokens of all inputs of a request unless Limits.MaxRequestTokens is set.
+	DefaultMaxRequestTokens = 300000
+	// DefaultMaxInputs limits the inputs of a request unless Limits.MaxInputs is set.
+	DefaultMaxInputs = 2048
+)
+
+// OversizedPolicy decides what happens to a text with more tokens than an input may have.
+type OversizedPolicy int
+
+const (
+	// SplitOversized splits the text into consecutive parts along its structure, this is the default.
+	SplitOversized OversizedPolicy = iota
+	// TruncateOversized keeps as much of the start of the text as fits.
+	TruncateOversized
+	// RejectOversized stops planning with an error.
+	RejectOversized
+)
+
+// Limits are the limits of the embeddings endpoint.
+type Limits struct {
+	// MaxInputTokens is the largest number of tokens of an input, the context length of the model if zero.
+	MaxInputTokens int
+	// MaxRequestTokens is the largest number of tokens of all inputs of a request, DefaultMaxRequestTokens if zero.
+	MaxRequestTokens int
+	// MaxInputs is the largest number of inputs of a request, DefaultMaxInputs if zero.
+	MaxInputs int
+}
+
+// Input is a text or a part of a text to embed.
+type Input struct {
+	Text string
+	// Tokens is the number of tokens of Text.
+	Tokens int
+	// Index is the position of the original text in the planned texts.
+	Index int
+	// Part numbers the parts of a split text from 0, it is 0 for texts that weren't split.
+	Part int
+	// Start and End are the byte offsets of Text in the original text.
+	Start int
+	End   int
+	// Truncated reports whether the end of the original text was dropped.
+	Truncated bool
+}
+
+// Batch holds the inputs of a request.
+type Batch struct {
+	Inputs []Input
+	// Tokens is the number of tokens of all inputs.
+	Tokens int
+}
+
+// Planner batches texts for the embeddings of a model.
+type Planner struct {
+	encoding mod.Encoding
+	limits   Limits
+	policy   OversizedPolicy
+}
+
+// NewPlanner returns a planner for the embeddings of model, whose encoding is encoding.
+func NewPlanner(encoding mod.Encoding, model mod.ModelType, limits Limits, policy OversizedPolicy) *Planner {
+	if limits.MaxInputTokens <= 0 {
+		limits.MaxInputTokens = model.GetMaxContextLength()
+	}
+	if limits.MaxRequestTokens <= 0 {
+		limits.MaxRequestTokens = DefaultMaxRequestTokens
+	}
+	if limits.MaxInputs <= 0 {
+		limits.MaxInputs = DefaultMaxInputs
+	}
+	limits.MaxInputTokens = min(limits.MaxInputTokens, limits.MaxRequestTokens)
+	return &Planner{encoding: encoding, limits: limits, policy: policy}
+}
+
+// Limits returns the limits the planner applies.
+func (p *Planner) Limits() Limits {
+	return p.limits
+}
+
+// Plan reads texts one after another and yields a batch whenever the next input wouldn't fit into it anymore,
+// so the texts don't have to be in memory at once. The inputs keep the order of the texts.
+// With RejectOversized it yields the inputs in front of the first text that is too long, then an error and stops.
+// Empty texts are skipped, the endpoints reject them, but they are counted by the Index of the inputs.
+func (p *Planner) Plan(texts iter.Seq[string]) iter.Seq2[*Batch, error] {
+	return func(yield func(*Batch, error) bool) {
+		batch := &Batch{}
+		index := 0
+		for text := range texts {
+			if text == "" {
+				// the endpoints reject empty inputs
+				index++
+				continue
+			}
+			inputs, err := p.inputs(index, text)
+			if err != nil {
+				if len(batch.Inputs) == 0 || yield(batch, nil) {
+					yield(nil, err)
+				}
+				return
+			}
+			for _, input := range inputs {
+				if len(batch.Inputs) == p.limits.MaxInputs || batch.Tokens+input.Tokens > p.limits.MaxRequestTokens {
+					if !yield(batch, nil) {
+						return
+					}
+					batch = &Batch{}
+				}
+				batch.Inputs = append(batch.Inputs, input)
+				batch.Tokens += input.Tokens
+			}
+			index++
+		}
+		if len(batch.Inputs) > 0 {
+			yield(batch, nil)
+		}
+	}
+}
+
+// inputs returns the inputs of the text at index.
+func (p *Planner) inputs(index int, text string) ([]Input, error) {
+	maxTokens := p.limits.MaxInputTokens
+	tokens := p.encoding.CountTokensOrdinary(text)
+	if tokens <= maxTokens {
+		return []Input{{Text: text, Tokens: tokens, Index: index, End: len(text)}}, nil
+	}
+
+	switch p.policy {
+	case TruncateOversized:
+		prefix, prefixTokens := p.truncate(text, maxTokens)
+		return []Input{{Text: prefix, Tokens: prefixTokens, Index: index, End: len(prefix), Truncated: true}}, nil
+	case RejectOversized:
+		return nil, fmt.Errorf("text %d has %d tokens, more than the %d of an input", index, tokens, maxTokens)
+	}
+
+	inputs := make([]Input, 0, 2*tokens/maxTokens+1)
+	if err := p.split(index, text, 0, maxTokens, &inputs); err != nil {
+		return nil, err
+	}
+	for i := range inputs {
+		inputs[i].Part = i
+	}
+	return inputs, nil
+}
+
+// split appends the parts of text, which starts at offset in the original text, to inputs.
+// A part that has more tokens on its own than in the whole text is split again with a lower limit,
+// once that would drop to zero the part is cut like a truncated text.
+func (p *Planner) split(index int, text string, offset int, maxTokens int, inputs *[]Input) error {
+	chunks, err := chunk.Split(p.encoding, text, chunk.Options{MaxTokens: maxTokens})
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		input := Input{Text: c.Text, Tokens: p.encoding.CountTokensOrdinary(c.Text), Index: index, Start: offset + c.Start, End: offset + c.End}
+		if input.Tokens <= p.limits.MaxInputTokens {
+			*inputs = append(*inputs, input)
+			continue
+		}
+		if lower := maxTokens - (input.Tokens - p.limits.MaxInputTokens); lower > 0 {
+			err = p.split(index, c.Text, input.Start, lower, inputs)
+		} else {
+			err = p.cut(index, c.Text, input.Start, inputs)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cut appends text, which starts at offset in the original text, to inputs as consecutive parts
+// that are each the longest start of the rest that fits into an input.
+func (p *Planner) cut(index int, text string, offset int, inputs *[]Input) error {
+	for text != "" {
+		prefix, tokens := p.truncate(text, p.limits.MaxInputTokens)
+		if prefix == "" {
+			return fmt.Errorf("text %d can't be cut into inputs of %d tokens at byte %d", index, p.limits.MaxInputTokens, offset)
+		}
+		*inputs = append(*inputs, Input{Text: prefix, Tokens: tokens, Index: index, Start: offset, End: offset + len(prefix)})
+		text = text[len(prefix):]
+		offset += len(prefix)
+	}
+	return nil
+}
+
+// truncate returns the longest start of text that has at most maxTokens tokens, and its tokens.
+func (p *Planner) truncate(text string, maxTokens int) (string, int) {
+	// the tokens of the truncated text can differ from the first tokens of the whole text where it is cut
+	limit := maxTokens
+	for {
+		end := p.encoding.EncodeOrdinary(text, limit).GetLastProcessedCharacterIndex() + 1
+		tokens := p.encoding.CountTokensOrdinary(text[:end])
+		if tokens <= maxTokens {
+			return text[:end], tokens
+		}
+		limit -= tokens - maxTokens
+	}
+}
@@ -0,0 +1,160 @@
+package embedding_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/embedding"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func plan(t *testing.T, planner *embedding.Planner, texts []string) []*embedding.Batch {
+	t.Helper()
+	var batches []*embedding.Batch
+	for batch, err := range planner.Plan(slices.Values(texts)) {
+		require.NoError(t, err)
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// assertLimits checks that the batches keep the limits of the planner and that their tokens are counted right.
+func assertLimits(t *testing.T, enc mod.Encoding, planner *embedding.Planner, batches []*embedding.Batch) {
+	t.Helper()
+	limits := planner.Limits()
+	for _, batch := range batches {
+		assert.LessOrEqual(t, len(batch.Inputs), limits.MaxInputs)
+		assert.LessOrEqual(t, batch.Tokens, limits.MaxRequestTokens)
+		tokens := 0
+		for _, input := range batch.Inputs {
+			assert.Equal(t, enc.CountTokensOrdinary(input.Text), input.Tokens)
+			assert.LessOrEqual(t, input.Tokens, limits.MaxInputTokens)
+			tokens += input.Tokens
+		}
+		assert.Equal(t, tokens, batch.Tokens)
+	}
+}
+
+func TestPlanBatchesWithinLimits(t *testing.T) {
+	enc := encoding.Cl100kBase()
+	planner := embedding.NewPlanner(enc, mod.TEXT_EMBEDDING_3_SMALL, embedding.Limits{MaxRequestTokens: 10, MaxInputs: 3}, embedding.SplitOversized)
+	assert.Equal(t, embedding.Limits{MaxInputTokens: 10, MaxRequestTokens: 10, MaxInputs: 3}, planner.Limits())
+
+	texts := []string{"hello world", "one two three", "a", "b", "c", "d", "four five six seven"}
+	batches := plan(t, planner, texts)
+	assertLimits(t, enc, planner, batches)
+
+	var inputs [][]embedding.Input
+	for _, batch := range batches {
+		inputs = append(inputs, batch.Inputs)
+	}
+	assert.Equal(t, [][]embedding.Input{
+		{{Text: "hello world", Tokens: 2, Index: 0, End: 11}, {Text: "one two three", Tokens: 3, Index: 1, End: 13}, {Text: "a", Tokens: 1, Index: 2, End: 1}},
+		{{Text: "b", Tokens: 1, Index: 3, End: 1}, {Text: "c", Tokens: 1, Index: 4, End: 1}, {Text: "d", Tokens: 1, Index: 5, End: 1}},
+		{{Text: "four five six seven", Tokens: 4, Index: 6, End: 19}},
+	}, inputs)
+}
+
+func TestPlanSplitsOversizedTexts(t *testing.T) {
+	enc := encoding.Cl100kBase()
+	planner := embedding.NewPlanner(enc, mod.TEXT_EMBEDDING_3_SMALL, embedding.Limits{MaxInputTokens: 8, MaxRequestTokens: 20}, embedding.SplitOversized)
+	long := "# Title\n\nThe first sentence is here. The second sentence follows it.\n\nAnother paragraph."
+	batches := plan(t, planner, []string{"short", long, "last"})
+	assertLimits(t, enc, planner, batches)
+
+	var parts []string
+	for _, batch := range batches {
+		for _, input := range batch.Inputs {
+			assert.False(t, input.Truncated)
+			if input.Index == 1 {
+				assert.Equal(t, len(parts), input.Part)
+				assert.Equal(t, long[input.Start:input.End], input.Text)
+				parts = append(parts, input.Text)
+			}
+		}
+	}
+	assert.Equal(t, long, strings.Join(parts, ""))
+	assert.Greater(t, len(parts), 2)
+	last := batches[len(batches)-1].Inputs
+	assert.Equal(t, embedding.Input{Text: "last", Tokens: 1, Index: 2, End: 4}, last[len(last)-1])
+}
+
+func TestPlanCutsPartsThatDontShrink(t *testing.T) {
+	// the parts of this text have more tokens on their own than chunk.Split counts for them in the whole text,
+	// splitting them again with a lower limit would go below one token
+	enc := encoding.Cl100kBase()
+	text := "🌍🌍🌍 모든인간은태어날때부터 🦀🦀 ☃️☃️ ﷽﷽"
+	for maxInputTokens := 1; maxInputTokens <= 4; maxInputTokens++ {
+		planner := embedding.NewPlanner(enc, mod.TEXT_EMBEDDING_3_SMALL, embedding.Limits{MaxInputTokens: maxInputTokens}, embedding.SplitOversized)
+		batches := plan(t, planner, []string{text})
+		assertLimits(t, enc, planner, batches)
+
+		var parts []string
+		for _, batch := range batches {
+			for _, input := range batch.Inputs {
+				assert.Equal(t, len(parts), input.Part)
+				assert.Equal(t, text[input.Start:input.End], input.Text)
+				assert.False(t, input.Truncated)
+				parts = append(parts, input.Text)
+			}
+		}
+		assert.Equal(t, text, strings.Join(parts, ""), "max input tokens %d", maxInputTokens)
+	}
+}
+
+func TestPlanSkipsEmptyTexts(t *testing.T) {
+	for _, policy := range []embedding.OversizedPolicy{embedding.SplitOversized, embedding.TruncateOversized, embedding.RejectOversized} {
+		planner := embedding.NewPlanner(encoding.Cl100kBase(), mod.TEXT_EMBEDDING_3_SMALL, embedding.Limits{}, policy)
+		batches := plan(t, planner, []string{"", "hello", "", "world", ""})
+		require.Len(t, batches, 1)
+		assert.Equal(t, []embedding.Input{
+			{Text: "hello", Tokens: 1, Index: 1, End: 5},
+			{Text: "world", Tokens: 1, Index: 3, End: 5},
+		}, batches[0].Inputs)
+		assert.Empty(t, plan(t, planner, []string{"", ""}))
+	}
+}
+
+func TestPlanTruncatesOversizedTexts(t *testing.T) {
+	enc := encoding.Cl100kBase()
+	planner := embedding.NewPlanner(enc, mod.TEXT_EMBEDDING_3_SMALL, embedding.Limits{MaxInputTokens: 3}, embedding.TruncateOversized)
+	batches := plan(t, planner, []string{"hello world, how are you?", "hi 🤚🏾"})
+	assertLimits(t, enc, planner, batches)
+	require.Len(t, batches, 1)
+	assert.Equal(t, []embedding.Input{
+		{Text: "hello world,", Tokens: 3, Index: 0, End: 12, Truncated: true},
+		{Text: "hi", Tokens: 1, Index: 1, End: 2, Truncated: true},
+	}, batches[0].Inputs)
+}
+
+func TestPlanRejectsOversizedTexts(t *testing.T) {
+	planner := embedding.NewPlanner(encoding.Cl100kBase(), mod.TEXT_EMBEDDING_3_SMALL, embedding.Limits{MaxInputTokens: 2, MaxInputs: 1}, embedding.RejectOversized)
+	var errs []error
+	batches := 0
+	for batch, err := range planner.Plan(slices.Values([]string{"a", "b", "one two three", "c"})) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		assert.Len(t, batch.Inputs, 1)
+		batches++
+	}
+	assert.Equal(t, 2, batches)
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "text 2 has 3 tokens, more than the 2 of an input")
+}
+
+func TestPlanUsesTheContextLengthOfTheModel(t *testing.T) {
+	planner := embedding.NewPlanner(encoding.Cl100kBase(), mod.TEXT_EMBEDDING_3_LARGE, embedding.Limits{}, embedding.SplitOversized)
+	assert.Equal(t, embedding.Limits{MaxInputTokens: 8191, MaxRequestTokens: embedding.DefaultMaxRequestTokens, MaxInputs: embedding.DefaultMaxInputs}, planner.Limits())
+
+	text := strings.Repeat("word ", 10000)
+	batches := plan(t, planner, []string{text})
+	require.Len(t, batches, 1)
+	assert.Len(t, batches[0].Inputs, 2)
+	assert.Equal(t, encoding.Cl100kBase().CountTokensOrdinary(text), batches[0].Tokens)
+}
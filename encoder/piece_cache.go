@@ -0,0 +1,137 @@
+package encoder
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+const pieceCacheShardCount = 16
+
+// PieceCacheStats is a snapshot of the counters of a PieceCache.
+type PieceCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+}
+
+// HitRatio returns the share of lookups that were served from the cache.
+func (s PieceCacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type pieceCacheEntry struct {
+	piece  string
+	tokens []int
+}
+
+type pieceCacheShard struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	capacity int
+}
+
+// PieceCache is a bounded, concurrency-safe LRU cache from the bytes of a piece
+// to its merged tokens. Only pieces which are not a single token themselves are
+// stored, so repeated pieces skip the byte pair merges.
+type PieceCache struct {
+	shards        [pieceCacheShardCount]pieceCacheShard
+	maxPieceBytes int
+	hits          atomic.Int64
+	misses        atomic.Int64
+	evictions     atomic.Int64
+}
+
+// NewPieceCache creates a cache holding at most maxEntries pieces, each at most maxPieceBytes long.
+func NewPieceCache(maxEntries int, maxPieceBytes int) *PieceCache {
+	if maxEntries <= 0 {
+		panic("maxEntries must be positive")
+	}
+	cache := &PieceCache{maxPieceBytes: maxPieceBytes}
+	for i := range cache.shards {
+		cache.shards[i] = pieceCacheShard{
+			entries:  make(map[string]*list.Element),
+			lru:      list.New(),
+			capacity: max(maxEntries/pieceCacheShardCount, 1),
+		}
+	}
+	return cache
+}
+
+// emptyCopy returns an empty cache of the same size as c, nil if c is nil.
+func (c *PieceCache) emptyCopy() *PieceCache {
+	if c == nil {
+		return nil
+	}
+	return NewPieceCache(c.shards[0].capacity*pieceCacheShardCount, c.maxPieceBytes)
+}
+
+func (c *PieceCache) accepts(piece []byte) bool {
+	return len(piece) <= c.maxPieceBytes
+}
+
+func (c *PieceCache) shard(piece []byte) *pieceCacheShard {
+	return &c.shards[hashKey(loadPrefix(piece), piece)%pieceCacheShardCount]
+}
+
+func (c *PieceCache) get(piece []byte) ([]int, bool) {
+	shard := c.shard(piece)
+	shard.mu.Lock()
+	element, ok := shard.entries[string(piece)]
+	if ok {
+		shard.lru.MoveToFront(element)
+	}
+	shard.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return element.Value.(*pieceCacheEntry).tokens, true
+}
+
+func (c *PieceCache) put(piece []byte, tokens []int) {
+	shard := c.shard(piece)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, ok := shard.entries[string(piece)]; ok {
+		return
+	}
+	entry := &pieceCacheEntry{piece: string(piece), tokens: tokens}
+	shard.entries[entry.piece] = shard.lru.PushFront(entry)
+	if shard.lru.Len() > shard.capacity {
+		oldest := shard.lru.Back()
+		shard.lru.Remove(oldest)
+		delete(shard.entries, oldest.Value.(*pieceCacheEntry).piece)
+		c.evictions.Add(1)
+	}
+}
+
+// Lookups returns the current hit and miss counters, without counting the cached pieces like Stats.
+func (c *PieceCache) Lookups() (hits int64, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// Stats returns the current hit, miss and eviction counters and the number of cached pieces.
+func (c *PieceCache) Stats() PieceCacheStats {
+	entries := 0
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		entries += shard.lru.Len()
+		shard.mu.Unlock()
+	}
+	return PieceCacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+	}
+}
@@ -0,0 +1,113 @@
+package encoder
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	hashMultiplier1 = 0x9e3779b97f4a7c15
+	hashMultiplier2 = 0xbf58476d1ce4e5b9
+)
+
+// rankSlot is one bucket of the open-addressing rankTable.
+// The first 8 bytes of the key are stored inline, so most tokens are compared
+// without touching rankTable.keys.
+type rankSlot struct {
+	prefix uint64
+	length uint32
+	offset uint32 // position of the key bytes after the prefix in rankTable.keys
+	rank   int32  // -1 == empty slot
+}
+
+// rankTable maps the byte sequences of mergeable tokens to their ranks.
+// It replaces a map[string]int per token length: the keys are hashed directly
+// from the candidate bytes and looked up with linear probing, without converting
+// them to a string or selecting a map by length first.
+type rankTable struct {
+	slots     []rankSlot
+	mask      uint64
+	keys      []byte
+	maxLength int
+}
+
+// loadPrefix returns the first (up to) 8 bytes of key as a little endian word.
+func loadPrefix(key []byte) uint64 {
+	if len(key) >= 8 {
+		return binary.LittleEndian.Uint64(key)
+	}
+	var prefix uint64
+	for i, b := range key {
+		prefix |= uint64(b) << (8 * i)
+	}
+	return prefix
+}
+
+// hashKey is a multiplicative hash over 8 byte words. It doesn't need a random seed:
+// the keys are fixed by the vocabulary, so the probe sequences a lookup can walk are too.
+func hashKey(prefix uint64, key []byte) uint64 {
+	hash := (prefix ^ uint64(len(key))*hashMultiplier1) * hashMultiplier2
+	for i := 8; i < len(key); i += 8 {
+		hash = bits.RotateLeft64(hash, 31) ^ loadPrefix(key[i:])
+		hash *= hashMultiplier2
+	}
+	return hash ^ (hash >> 31)
+}
+
+func newRankTable(encoder map[string]int) *rankTable {
+	// keep the load factor at or below 0.5 to make probe sequences short
+	size := 1 << bits.Len(uint(2*len(encoder)))
+	table := &rankTable{
+		slots: make([]rankSlot, size),
+		mask:  uint64(size - 1),
+	}
+	for i := range table.slots {
+		table.slots[i].rank = -1
+	}
+
+	totalLength := 0
+	for k := range encoder {
+		totalLength += max(len(k)-8, 0)
+	}
+	table.keys = make([]byte, 0, totalLength)
+	for k, v := range encoder {
+		table.put([]byte(k), v)
+	}
+	return table
+}
+
+func (r *rankTable) put(key []byte, rank int) {
+	prefix := loadPrefix(key)
+	for i := hashKey(prefix, key) & r.mask; ; i = (i + 1) & r.mask {
+		slot := &r.slots[i]
+		if slot.rank < 0 {
+			slot.prefix = prefix
+			slot.length = uint32(len(key))
+			slot.offset = uint32(len(r.keys))
+			slot.rank = int32(rank)
+			if len(key) > 8 {
+				r.keys = append(r.keys, key[8:]...)
+			}
+			r.maxLength = max(r.maxLength, len(key))
+			return
+		}
+	}
+}
+
+// get returns the rank of key or MAX_RANK if key is not a token.
+func (r *rankTable) get(key []byte) int {
+	if len(key) > r.maxLength {
+		return MAX_RANK
+	}
+	prefix := loadPrefix(key)
+	for i := hashKey(prefix, key) & r.mask; ; i = (i + 1) & r.mask {
+		slot := &r.slots[i]
+		if slot.rank < 0 {
+			return MAX_RANK
+		}
+		if slot.prefix == prefix && int(slot.length) == len(key) &&
+			(len(key) <= 8 || string(r.keys[slot.offset:int(slot.offset)+len(key)-8]) == string(key[8:])) {
+			return int(slot.rank)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package encoder
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankTableFindsEveryKey(t *testing.T) {
+	encoder := map[string]int{
+		"":                         0,
+		"a":                        1,
+		"a\x00":                    2, // same inline prefix as "a", told apart by the length
+		"abcdefgh":                 3,
+		"abcdefghi":                4,
+		"abcdefghij":               5,
+		"abcdefghijklmnopq":        6, // longer than two words
+		"abcdefghijklmnopr":        7, // differs from the previous key only in its last byte
+		" antidisestablishmentism": 8,
+	}
+	table := newRankTable(encoder)
+	for key, rank := range encoder {
+		assert.Equal(t, rank, table.get([]byte(key)), "%q", key)
+	}
+	assert.Equal(t, len(" antidisestablishmentism"), table.maxLength)
+
+	for _, missing := range []string{"b", "a\x00\x00", "abcdefg", "abcdefghk", "abcdefghijklmnops", "abcdefghijklmnopqr"} {
+		assert.Equal(t, MAX_RANK, table.get([]byte(missing)), "%q", missing)
+	}
+	assert.Equal(t, MAX_RANK, table.get([]byte(strings.Repeat("a", table.maxLength+1))), "keys over maxLength aren't looked up")
+}
+
+func TestRankTableProbesCollidingKeys(t *testing.T) {
+	// find keys that all start probing at the same slot of a table of 8 keys
+	const count = 8
+	mask := uint64(1<<bits.Len(2*count) - 1)
+	var colliding []string
+	for i := 0; len(colliding) < count; i++ {
+		key := fmt.Sprintf("key %d of many", i)
+		if hashKey(loadPrefix([]byte(key)), []byte(key))&mask == 0 {
+			colliding = append(colliding, key)
+		}
+	}
+	encoder := make(map[string]int, count)
+	for i, key := range colliding {
+		encoder[key] = i
+	}
+	table := newRankTable(encoder)
+	require.Equal(t, mask, table.mask)
+	for key, rank := range encoder {
+		assert.Equal(t, rank, table.get([]byte(key)), key)
+	}
+	assert.Equal(t, MAX_RANK, table.get([]byte("key of none")))
+}
+
+func TestEmptyRankTable(t *testing.T) {
+	table := newRankTable(map[string]int{})
+	assert.Equal(t, MAX_RANK, table.get(nil))
+	assert.Equal(t, MAX_RANK, table.get([]byte("a")))
+}
+
+// lengthMaps is the lookup rankTable replaced: a map per token length.
+type lengthMaps []map[string]int
+
+func newLengthMaps(encoder map[string]int) lengthMaps {
+	maps := lengthMaps{}
+	for k, v := range encoder {
+		for len(maps) <= len(k) {
+			maps = append(maps, map[string]int{})
+		}
+		maps[len(k)][k] = v
+	}
+	return maps
+}
+
+func (m lengthMaps) get(payload []byte) int {
+	if len(payload) < len(m) {
+		if rank, ok := m[len(payload)][string(payload)]; ok {
+			return rank
+		}
+	}
+	return MAX_RANK
+}
+
+func readRanks(tb testing.TB, fileName string) map[string]int {
+	file, err := os.Open("../resources/" + fileName)
+	require.NoError(tb, err)
+	defer file.Close()
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		token, rank, _ := strings.Cut(scanner.Text(), " ")
+		key, err := base64.StdEncoding.DecodeString(token)
+		require.NoError(tb, err)
+		ranks[string(key)], err = strconv.Atoi(rank)
+		require.NoError(tb, err)
+	}
+	require.NoError(tb, scanner.Err())
+	return ranks
+}
+
+// go test -run=^$ -bench ^BenchmarkRankTable$ github.com/currybab/tokgo/encoder
+//
+// BenchmarkRankTable looks up the byte sequences the merge loop asks for, every substring of up to
+// 16 bytes of a text, in the rank table and in the map per length it replaced.
+func BenchmarkRankTable(b *testing.B) {
+	text := []byte("The quick brown fox jumps over the lazy dog. 모든 인간은 태어날 때부터 자유로우며 func main() { return 42 }")
+	var candidates [][]byte
+	for start := range text {
+		for end := start + 1; end <= min(start+16, len(text)); end++ {
+			candidates = append(candidates, text[start:end])
+		}
+	}
+	for _, fileName := range []string{"cl100k_base.tiktoken", "o200k_base.tiktoken"} {
+		encoder := readRanks(b, fileName)
+		table, maps := newRankTable(encoder), newLengthMaps(encoder)
+		for _, candidate := range candidates {
+			require.Equal(b, maps.get(candidate), table.get(candidate))
+		}
+		name := strings.TrimSuffix(fileName, ".tiktoken")
+		b.Run(name+"/rankTable", func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				for _, candidate := range candidates {
+					table.get(candidate)
+				}
+			}
+		})
+		b.Run(name+"/lengthMaps", func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				for _, candidate := range candidates {
+					maps.get(candidate)
+				}
+			}
+		})
+	}
+}
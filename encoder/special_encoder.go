@@ -7,22 +7,33 @@ const (
 	SPECIAL_END   = "|>"
 )
 
+// SPECIAL_TOKENS_NOT_SUPPORTED is the panic value of CheckForSpecialTokens.
+const SPECIAL_TOKENS_NOT_SUPPORTED = "Encoding special tokens is not supported."
+
 type SpecialEncoder struct {
 	encodedToDecoded map[int]string
+	decodedToEncoded map[string]int
 }
 
+// NewSpecialEncoder returns the special encoder of the tokens of encoder. Tokens sharing an id are aliases:
+// each of them encodes to the id, which decodes to the smallest of them.
 func NewSpecialEncoder(encoder map[string]int) *SpecialEncoder {
 	encodedToDecoded := make(map[int]string, len(encoder))
+	decodedToEncoded := make(map[string]int, len(encoder))
 	for key, value := range encoder {
 		if !strings.Contains(key, SPECIAL_START) || !strings.Contains(key, SPECIAL_END) {
 			panic("Special tokens must contain " + SPECIAL_START + " and " + SPECIAL_END + " (but was " + key + ")")
 		}
 
-		encodedToDecoded[value] = key
+		if other, ok := encodedToDecoded[value]; !ok || key < other {
+			encodedToDecoded[value] = key
+		}
+		decodedToEncoded[key] = value
 	}
 
 	return &SpecialEncoder{
 		encodedToDecoded: encodedToDecoded,
+		decodedToEncoded: decodedToEncoded,
 	}
 }
 
@@ -36,10 +47,51 @@ func (s *SpecialEncoder) DecodeIfPresent(encodedToken int) []byte {
 
 func (s *SpecialEncoder) CheckForSpecialTokens(text string) {
 	if strings.Contains(text, SPECIAL_START) && strings.Contains(text, SPECIAL_END) {
-		for _, specialToken := range s.encodedToDecoded {
+		for specialToken := range s.decodedToEncoded {
 			if strings.Contains(text, specialToken) {
-				panic("Encoding special tokens is not supported.")
+				panic(SPECIAL_TOKENS_NOT_SUPPORTED)
 			}
 		}
 	}
 }
+
+// FindNext returns the byte index, the token and the length of the first special token in text,
+// preferring the longest one if several start at the same index. The index is -1 if there is none.
+func (s *SpecialEncoder) FindNext(text string) (int, int, int) {
+	index, token, length := -1, -1, 0
+	if !strings.Contains(text, SPECIAL_START) {
+		return index, token, length
+	}
+	for specialToken, encoded := range s.decodedToEncoded {
+		i := strings.Index(text, specialToken)
+		if i >= 0 && (index < 0 || i < index || (i == index && len(specialToken) > length)) {
+			index, token, length = i, encoded, len(specialToken)
+		}
+	}
+	return index, token, length
+}
+
+// Tokens returns a copy of the special tokens and their ids, including the aliases.
+func (s *SpecialEncoder) Tokens() map[string]int {
+	tokens := make(map[string]int, len(s.decodedToEncoded))
+	for decoded, encoded := range s.decodedToEncoded {
+		tokens[decoded] = encoded
+	}
+	return tokens
+}
+
+// HasTokenContainingAny reports whether a special token contains any of the characters of chars.
+func (s *SpecialEncoder) HasTokenContainingAny(chars string) bool {
+	for decoded := range s.decodedToEncoded {
+		if strings.ContainsAny(decoded, chars) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode returns the id of a special token.
+func (s *SpecialEncoder) Encode(specialToken string) (int, bool) {
+	encoded, ok := s.decodedToEncoded[specialToken]
+	return encoded, ok
+}
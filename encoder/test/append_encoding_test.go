@@ -0,0 +1,37 @@
+package encoder_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+const ASCII_TEXT = "The quick brown fox jumps over the lazy dog, antidisestablishmentarianism 12345!\n"
+
+func TestAppendEncodeMatchesEncode(t *testing.T) {
+	appendEncoding := getEncoding().(mod.AppendEncoding)
+	dst := []int{1, 2, 3}
+	for _, text := range []string{"", ASCII_TEXT, "Mixed script: 你好 world! 🌍", "😩\n"} {
+		expected := append(append([]int{}, dst...), getEncoding().EncodeToIntArray(text)...)
+		assert.Equal(t, expected, appendEncoding.AppendEncode(append([]int{}, dst...), text))
+		assert.Equal(t, expected, appendEncoding.AppendEncodeOrdinary(append([]int{}, dst...), text))
+	}
+}
+
+// TestAppendEncodeAndCountTokensDoNotAllocate holds for cl100k_base only, the other encodings
+// allocate the matches of their pattern (see BenchmarkAppendEncodeAscii).
+func TestAppendEncodeAndCountTokensDoNotAllocate(t *testing.T) {
+	appendEncoding := getEncoding().(mod.AppendEncoding)
+	dst := make([]int, 0, 100)
+
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		dst = appendEncoding.AppendEncode(dst[:0], ASCII_TEXT)
+	}))
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		getEncoding().CountTokens(ASCII_TEXT)
+	}))
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		getEncoding().CountTokensOrdinary(ASCII_TEXT)
+	}))
+}
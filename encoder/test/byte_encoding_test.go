@@ -0,0 +1,87 @@
+package encoder_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+var INVALID_UTF8_TEXTS = []string{
+	"\xff",
+	"abc\xffdef",
+	"Hello\x80\x80 world",
+	"truncated \xe4\xbd",
+	"\xf0\x9f\x98 emoji without its last byte",
+	"\xc0\xaf overlong slash",
+	"mixed 你好\xfe🌍\xed\xa0\x80 surrogate",
+	"trailing byte\xe2",
+}
+
+func byteEncodings() []mod.ByteEncoding {
+	return []mod.ByteEncoding{
+		encoding.Cl100kBase().(mod.ByteEncoding),
+		encoding.O200kBase().(mod.ByteEncoding),
+		encoding.R50kBase().(mod.ByteEncoding),
+	}
+}
+
+func TestEncodeBytesRoundTripsRandomBytes(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	for _, byteEncoding := range byteEncodings() {
+		for i := 0; i < 200; i++ {
+			data := make([]byte, random.Intn(100))
+			random.Read(data)
+
+			tokens := byteEncoding.EncodeBytes(data)
+			assert.True(t, bytes.Equal(data, byteEncoding.DecodeBytes(tokens)), "%s: %q", byteEncoding.GetName(), data)
+			assert.Equal(t, len(tokens), byteEncoding.CountTokensBytes(data))
+		}
+	}
+}
+
+func TestStringApisAcceptInvalidUtf8(t *testing.T) {
+	for _, byteEncoding := range byteEncodings() {
+		for _, text := range INVALID_UTF8_TEXTS {
+			tokens := byteEncoding.EncodeToIntArray(text)
+			assert.Equal(t, []byte(text), byteEncoding.DecodeBytes(tokens), "%s: %q", byteEncoding.GetName(), text)
+			assert.Equal(t, tokens, byteEncoding.EncodeBytes([]byte(text)))
+			assert.Equal(t, len(tokens), byteEncoding.CountTokens(text))
+		}
+	}
+}
+
+func TestEncodeBytesMatchesStringEncodingForValidUtf8(t *testing.T) {
+	for _, byteEncoding := range byteEncodings() {
+		for _, text := range []string{"", ASCII_TEXT, "Mixed script: 你好 world! 🌍", "😩\n"} {
+			assert.Equal(t, byteEncoding.EncodeOrdinaryToIntArray(text), byteEncoding.EncodeBytes([]byte(text)))
+		}
+	}
+}
+
+func TestEncodeBytesTreatsSpecialTokensAsText(t *testing.T) {
+	byteEncoding := encoding.Cl100kBase().(mod.ByteEncoding)
+	data := []byte("<|endoftext|>\xff")
+	tokens := byteEncoding.EncodeBytes(data)
+	assert.NotContains(t, tokens, 100257)
+	assert.Equal(t, data, byteEncoding.DecodeBytes(tokens))
+}
+
+func TestTruncatedInvalidUtf8IsPrefix(t *testing.T) {
+	for _, byteEncoding := range byteEncodings() {
+		for _, text := range INVALID_UTF8_TEXTS {
+			for maxTokens := 1; maxTokens < 8; maxTokens++ {
+				result := byteEncoding.EncodeOrdinary(text, maxTokens)
+				decoded := byteEncoding.DecodeBytes(result.GetTokens())
+				assert.True(t, bytes.HasPrefix([]byte(text), decoded), "%s: %q %d", byteEncoding.GetName(), text, maxTokens)
+				if utf8.Valid([]byte(text)) {
+					assert.True(t, utf8.Valid(decoded))
+				}
+			}
+		}
+	}
+}
@@ -1,60 +1,64 @@
 package encoder_test
 
 import (
-	"os"
 	"testing"
 
 	"github.com/currybab/tokgo/encoding"
 	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
 )
 
-// Environment Setup
-func setup(t *testing.T) (string, bool) {
-	originalThresholdValue, originalWasSet := os.LookupEnv(mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY)
-	setEnvErr := os.Setenv(mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY, "0")
-	if setEnvErr != nil {
-		t.Fatalf("Failed to set environment variable '%s' to '0': %v", mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY, setEnvErr)
-	}
-	ENCODING = encoding.Cl100kBase()
-	return originalThresholdValue, originalWasSet
-}
-
-func teardown(t *testing.T, originalThresholdValue string, originalWasSet bool) {
-	if !originalWasSet {
-		unsetEnvErr := os.Unsetenv(mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY)
-		if unsetEnvErr != nil {
-			t.Logf("Error trying to unset environment variable '%s': %v", mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY, unsetEnvErr)
-		}
-	} else {
-		restoreEnvErr := os.Setenv(mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY, originalThresholdValue)
-		if restoreEnvErr != nil {
-			t.Logf("Failed to restore environment variable '%s' to '%s': %v", mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY, originalThresholdValue, restoreEnvErr)
-		}
-	}
+func setup() {
+	ENCODING = encoding.Cl100kBase(encoding.WithLargePieceThreshold(0))
+}
 
+func teardown() {
 	ENCODING = encoding.Cl100kBase()
 }
 
 func TestLargeCl100kMeasureEncodingSpeeds(t *testing.T) {
-	originalThresholdValue, originalWasSet := setup(t)
-	defer teardown(t, originalThresholdValue, originalWasSet)
+	setup()
+	defer teardown()
 	measureEncodingSpeeds(t)
 }
 
 func TestLargeCl100kEdgeCaseRoundTrips(t *testing.T) {
-	originalThresholdValue, originalWasSet := setup(t)
-	defer teardown(t, originalThresholdValue, originalWasSet)
+	setup()
+	defer teardown()
 	cl100kEdgeCaseRoundTrips(t)
 }
 
 func TestLargeCl100kEncodeRoundTripWithRandomStrings(t *testing.T) {
-	originalThresholdValue, originalWasSet := setup(t)
-	defer teardown(t, originalThresholdValue, originalWasSet)
+	setup()
+	defer teardown()
 	cl100kEncodeRoundTripWithRandomStrings(t)
 }
 
 func TestLargeCl100kEncodeOrdinaryRoundTripWithRandomStrings(t *testing.T) {
-	originalThresholdValue, originalWasSet := setup(t)
-	defer teardown(t, originalThresholdValue, originalWasSet)
+	setup()
+	defer teardown()
 	cl100kEncodeOrdinaryRoundTripWithRandomStrings(t)
 }
+
+func TestLargeCl100kMatchesSmall(t *testing.T) {
+	smallEncoding := encoding.Cl100kBase()
+	setup()
+	defer teardown()
+
+	singleTokenStrings := getAllTokens()
+	for i := 0; i < 10_000; i++ {
+		testString := generateRandomUtf8String(singleTokenStrings)
+		assert.Equal(t, smallEncoding.EncodeToIntArray(testString), getEncoding().EncodeToIntArray(testString), normalizeStringForTesting(testString))
+	}
+	longString := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa antidisestablishmentarianism 🤚🏾🤚🏾🤚🏾"
+	assert.Equal(t, smallEncoding.EncodeToIntArray(longString), getEncoding().EncodeToIntArray(longString))
+}
+
+func TestLargePieceThresholdFallsBackToEnvironment(t *testing.T) {
+	t.Setenv(mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY, "0")
+	fromEnvironment := encoding.Cl100kBase().(*encoding.Cl100kGptBytePairEncoding)
+	assert.Equal(t, 0, fromEnvironment.Encoder.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD)
+
+	fromOption := encoding.Cl100kBase(encoding.WithLargePieceThreshold(42)).(*encoding.Cl100kGptBytePairEncoding)
+	assert.Equal(t, 42, fromOption.Encoder.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD)
+}
@@ -0,0 +1,112 @@
+package encoder_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/currybab/tokgo/encoder"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// randomLetters returns a single piece of n random ASCII letters, which has to be merged as a whole.
+func randomLetters(n int) string {
+	random := rand.New(rand.NewSource(42))
+	letters := make([]byte, n)
+	for i := range letters {
+		letters[i] = byte('a' + random.Intn(26))
+	}
+	return string(letters)
+}
+
+func TestContextEncodingMatchesEncoding(t *testing.T) {
+	texts := []string{
+		"",
+		"hello world",
+		"hello <|endoftext|> world<|endoftext|>",
+		"invalid \xff\xfe utf-8",
+		"🤚🏾 antidisestablishmentarianism\n\n  " + randomLetters(300),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, enc := range []mod.Encoding{
+		encoding.R50kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed)),
+		encoding.Cl100kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed), encoding.WithLargePieceThreshold(0)),
+		encoding.O200kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAsText), encoding.WithPieceCache(1024, 1024)),
+	} {
+		contextEncoding := enc.(mod.ContextEncoding)
+		for _, text := range texts {
+			for _, maxTokens := range []int{math.MaxInt, 3} {
+				result, err := contextEncoding.EncodeContext(ctx, text, maxTokens)
+				require.NoError(t, err)
+				assert.Equal(t, enc.Encode(text, maxTokens), result, enc.GetName())
+				result, err = contextEncoding.EncodeOrdinaryContext(context.Background(), text, maxTokens)
+				require.NoError(t, err)
+				assert.Equal(t, enc.EncodeOrdinary(text, maxTokens), result, enc.GetName())
+			}
+			count, err := contextEncoding.CountTokensContext(ctx, text)
+			require.NoError(t, err)
+			assert.Equal(t, enc.CountTokens(text), count)
+			count, err = contextEncoding.CountTokensOrdinaryContext(ctx, text)
+			require.NoError(t, err)
+			assert.Equal(t, enc.CountTokensOrdinary(text), count)
+		}
+	}
+}
+
+func TestContextEncodingReturnsErrorOfCanceledContext(t *testing.T) {
+	enc := encoding.Cl100kBase().(mod.ContextEncoding)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := enc.EncodeContext(ctx, "hello world", math.MaxInt)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, mod.NewEncodingResult([]int{}, true, -1), result)
+	count, err := enc.CountTokensOrdinaryContext(ctx, "hello world")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, count)
+}
+
+func TestContextEncodingStopsInsideLargePiece(t *testing.T) {
+	enc := encoding.Cl100kBase()
+	prefix := "hello world, "
+	text := prefix + randomLetters(4<<20)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := enc.(mod.ContextEncoding).EncodeContext(ctx, text, math.MaxInt)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.True(t, result.IsTruncated())
+	// the progress ends at a piece boundary in the prefix
+	processed := result.GetLastProcessedCharacterIndex() + 1
+	assert.LessOrEqual(t, processed, len(prefix))
+	assert.Equal(t, text[:processed], enc.Decode(result.GetTokens()))
+	assert.Equal(t, enc.EncodeToIntArray(text[:processed]), result.GetTokens())
+}
+
+func TestAddTokensAndGetCountContextLeavesOutUnchanged(t *testing.T) {
+	enc := encoding.Cl100kBase(encoding.WithLargePieceThreshold(0), encoding.WithPieceCache(1024, 1024)).(*encoding.Cl100kGptBytePairEncoding)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := []int{1, 2}
+	var ranks []int
+	count, err := enc.Encoder.AddTokensAndGetCountContext(ctx, math.MaxInt, true, []byte(strings.Repeat("ab", 10)), &out, &ranks)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, []int{1, 2}, out)
+	assert.Equal(t, encoder.PieceCacheStats{Misses: 1}, enc.GetPieceCache().Stats())
+
+	count, err = enc.Encoder.AddTokensAndGetCountContext(context.Background(), math.MaxInt, true, []byte(strings.Repeat("ab", 10)), &out, &ranks)
+	assert.NoError(t, err)
+	assert.Equal(t, len(out)-2, count)
+}
@@ -0,0 +1,120 @@
+package encoder_test
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+// gpt2BytesToUnicode is bytes_to_unicode of GPT-2's encoder.py.
+func gpt2BytesToUnicode() map[byte]rune {
+	var bs []int
+	for b := '!'; b <= '~'; b++ {
+		bs = append(bs, int(b))
+	}
+	for b := '¡'; b <= '¬'; b++ {
+		bs = append(bs, int(b))
+	}
+	for b := '®'; b <= 'ÿ'; b++ {
+		bs = append(bs, int(b))
+	}
+	mapping := make(map[byte]rune, 256)
+	for _, b := range bs {
+		mapping[byte(b)] = rune(b)
+	}
+	n := 0
+	for b := 0; b < 256; b++ {
+		if _, ok := mapping[byte(b)]; !ok {
+			mapping[byte(b)] = rune(256 + n)
+			n++
+		}
+	}
+	return mapping
+}
+
+func toDataGym(mapping map[byte]rune, token string) string {
+	var builder strings.Builder
+	for i := 0; i < len(token); i++ {
+		builder.WriteRune(mapping[byte(token[i])])
+	}
+	return builder.String()
+}
+
+// mergeOf returns the two tokens that are merged into token, by merging its bytes with the ranks below rank.
+func mergeOf(ranks map[string]int, token string, rank int) (string, string) {
+	parts := make([]string, 0, len(token))
+	for i := 0; i < len(token); i++ {
+		parts = append(parts, token[i:i+1])
+	}
+	for len(parts) > 2 {
+		minIndex, minRank := -1, rank
+		for i := 0; i+1 < len(parts); i++ {
+			if r, ok := ranks[parts[i]+parts[i+1]]; ok && r < minRank {
+				minIndex, minRank = i, r
+			}
+		}
+		parts = append(append(parts[:minIndex:minIndex], parts[minIndex]+parts[minIndex+1]), parts[minIndex+2:]...)
+	}
+	return parts[0], parts[1]
+}
+
+// r50kAsDataGym writes the r50k_base ranks as the original GPT-2 vocab.bpe and encoder.json.
+func r50kAsDataGym(t *testing.T) (string, string, map[string]int) {
+	ranks, err := encoding.LoadMergeableRanks("r50k_base.tiktoken")
+	assert.NoError(t, err)
+
+	tokens := make([]string, 0, len(ranks))
+	for token := range ranks {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return ranks[tokens[i]] < ranks[tokens[j]] })
+
+	mapping := gpt2BytesToUnicode()
+	var vocabBpe strings.Builder
+	vocabBpe.WriteString("#version: 0.2\n")
+	encoderJson := map[string]int{"<|endoftext|>": 50256}
+	for _, token := range tokens {
+		encoderJson[toDataGym(mapping, token)] = ranks[token]
+		if len(token) > 1 {
+			first, second := mergeOf(ranks, token, ranks[token])
+			vocabBpe.WriteString(toDataGym(mapping, first) + " " + toDataGym(mapping, second) + "\n")
+		}
+	}
+	encoded, err := json.Marshal(encoderJson)
+	assert.NoError(t, err)
+	return vocabBpe.String(), string(encoded), ranks
+}
+
+func TestDataGymRanksMatchR50k(t *testing.T) {
+	vocabBpe, encoderJson, r50kRanks := r50kAsDataGym(t)
+
+	ranks, err := encoding.ReadDataGymRanks(strings.NewReader(vocabBpe), strings.NewReader(encoderJson))
+	assert.NoError(t, err)
+	assert.Equal(t, r50kRanks, ranks)
+
+	params := mod.NewGptBytePairEncodingParams("gpt2", nil, ranks, encoding.SPECIAL_TOKENS_X50K_BASE)
+	gpt2 := encoding.FromParameters(params)
+	assert.Equal(t, encoding.R50kBase().Decode([]int{31373, 995}), gpt2.Decode([]int{31373, 995}))
+}
+
+func TestDataGymRejectsMismatchedEncoder(t *testing.T) {
+	vocabBpe := "#version: 0.2\nĠ t\nĠt he\n"
+
+	ranks, err := encoding.ReadDataGymRanks(strings.NewReader(vocabBpe), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 256, ranks[" t"])
+	assert.Equal(t, 257, ranks[" the"])
+	assert.Equal(t, 0, ranks["!"])
+	assert.Equal(t, 188, ranks["\x00"])
+
+	_, err = encoding.ReadDataGymRanks(strings.NewReader(vocabBpe), strings.NewReader(`{"Ġt": 257}`))
+	assert.EqualError(t, err, `encoder.json token "Ġt" has id 257 but rank 256 in vocab.bpe`)
+
+	_, err = encoding.ReadDataGymRanks(strings.NewReader("#version: 0.2\nĠ t x\n"), nil)
+	assert.EqualError(t, err, `vocab.bpe line 2: expected two tokens but was "Ġ t x"`)
+}
@@ -0,0 +1,84 @@
+package encoder_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+var CHATML_SPECIAL_TOKENS = map[string]int{"<|im_start|>": 100264, "<|im_end|>": 100265}
+
+func TestDeriveAddsSpecialTokensAndSharesRanks(t *testing.T) {
+	base := encoding.Cl100kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed))
+	derived, err := encoding.Derive(base, "cl100k_im", CHATML_SPECIAL_TOKENS, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "cl100k_im", derived.GetName())
+	text := "<|im_start|>user\nHello<|im_end|><|endoftext|>"
+	tokens := derived.EncodeToIntArray(text)
+	assert.Equal(t, []int{100264, 882, 198, 9906, 100265, 100257}, tokens)
+	assert.Equal(t, text, derived.Decode(tokens))
+
+	// the base encoding is unchanged
+	assert.NotContains(t, base.EncodeToIntArray(text), 100264)
+	assert.NotSame(t, base.(*encoding.Cl100kGptBytePairEncoding).Encoder, derived.(*encoding.Cl100kGptBytePairEncoding).Encoder)
+}
+
+func TestDeriveKeepsTheOptionsOfBaseWithoutSharingThem(t *testing.T) {
+	base := encoding.R50kBase(encoding.WithPieceCache(1024, 64), encoding.WithLargePieceThreshold(7)).(*encoding.GptBytePairEncoding)
+	baseCache := base.GetPieceCache()
+	for name, extraTokens := range map[string]map[string]int{"special tokens only": nil, "regular tokens": {"xyzzyplugh": 50300}} {
+		derived, err := encoding.Derive(base, "r50k_derived", map[string]int{"<|derived|>": 50400}, extraTokens)
+		assert.NoError(t, err)
+		gptDerived := derived.(*encoding.GptBytePairEncoding)
+		assert.Equal(t, 7, gptDerived.Encoder.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD, name)
+		assert.NotNil(t, gptDerived.GetPieceCache(), name)
+		assert.NotSame(t, baseCache, gptDerived.GetPieceCache(), name)
+
+		gptDerived.SetPieceCache(nil)
+		gptDerived.Encoder.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD = 1
+		assert.Same(t, baseCache, base.GetPieceCache(), name)
+		assert.Equal(t, 7, base.Encoder.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD, name)
+		assert.Equal(t, base.EncodeOrdinaryToIntArray("hello world"), derived.EncodeOrdinaryToIntArray("hello world"), name)
+	}
+}
+
+func TestDeriveAddsRegularTokens(t *testing.T) {
+	base := encoding.R50kBase()
+	derived, err := encoding.Derive(base, "r50k_reserved", nil, map[string]int{"xyzzyplugh": 50300})
+	assert.NoError(t, err)
+
+	tokens := derived.EncodeOrdinaryToIntArray("xyzzyplugh and magic")
+	assert.Equal(t, 50300, tokens[0])
+	assert.Equal(t, base.EncodeOrdinaryToIntArray(" and magic"), tokens[1:])
+	assert.Equal(t, "xyzzyplugh and magic", derived.Decode(tokens))
+	assert.Greater(t, len(base.EncodeOrdinaryToIntArray("xyzzyplugh")), 1)
+	assert.Equal(t, base.(mod.Encoding).Decode([]int{50256}), derived.Decode([]int{50256}))
+}
+
+func TestDeriveRejectsCollisions(t *testing.T) {
+	base := encoding.Cl100kBase()
+	for name, test := range map[string]struct {
+		special map[string]int
+		tokens  map[string]int
+		message string
+	}{
+		"existing special token":  {special: map[string]int{"<|endoftext|>": 200000}, message: `special token "<|endoftext|>" already exists`},
+		"special id in use":       {special: map[string]int{"<|im_start|>": 100257}, message: `special token id 100257 of "<|im_start|>" is already used by "<|endoftext|>"`},
+		"special id of a token":   {special: map[string]int{"<|im_start|>": 0}, message: `special token id 0 of "<|im_start|>" is already used by a regular token`},
+		"special without markers": {special: map[string]int{"im_start": 100264}, message: `special token "im_start" must contain <| and |>`},
+		"duplicate special ids":   {special: map[string]int{"<|a|>": 100264, "<|b|>": 100264}, message: `special token id 100264 of "<|b|>" is already used by "<|a|>"`},
+		"existing token bytes":    {tokens: map[string]int{"hello": 200000}, message: `cannot derive x from cl100k_base: token "hello" already exists`},
+		"token id in use":         {tokens: map[string]int{"xyzzyplugh": 0}, message: `cannot derive x from cl100k_base: token id 0 of "xyzzyplugh" is already used`},
+		"token id of special":     {tokens: map[string]int{"xyzzyplugh": 100257}, message: `token id 100257 of "xyzzyplugh" is already used by "<|endoftext|>"`},
+		"special id of new token": {special: map[string]int{"<|a|>": 100264}, tokens: map[string]int{"xyzzyplugh": 100264}, message: `special token id 100264 of "<|a|>" is already used by a regular token`},
+	} {
+		_, err := encoding.Derive(base, "x", test.special, test.tokens)
+		assert.EqualError(t, err, test.message, name)
+	}
+
+	_, err := encoding.Derive(base, "", nil, nil)
+	assert.Error(t, err)
+}
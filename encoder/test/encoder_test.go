@@ -13,7 +13,6 @@ import (
 	"github.com/currybab/tokgo/encoding"
 	"github.com/currybab/tokgo/mod"
 	"github.com/currybab/tokgo/parser"
-	"github.com/emirpasic/gods/v2/maps/treemap"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -173,7 +172,11 @@ func measureEncodingSpeeds(t *testing.T) {
 	}
 
 	var input strings.Builder
-	measurements := treemap.New[int, int64]()
+	type measurement struct {
+		length   int
+		duration int64
+	}
+	var measurements []measurement
 	iterations := 20
 	// Math.max(i + 1, i * 1.01) equivalent
 	maxFloat := func(a, b float64) float64 {
@@ -201,13 +204,12 @@ func measureEncodingSpeeds(t *testing.T) {
 			assert.NotEmpty(t, encodingResult, "Encoding result should not be empty")
 		}
 		endTime := time.Now().UnixNano()
-		measurements.Put(int(i), (endTime-startTime)/int64(iterations))
+		measurements = append(measurements, measurement{int(i), (endTime - startTime) / int64(iterations)})
 	}
 
-	// To print in sorted order of keys, like TreeMap
-	it := measurements.Iterator()
-	for it.Begin(); it.Next(); {
-		t.Logf("%d\t%d\n", it.Key(), it.Value())
+	// lengths are increasing, so this prints in sorted order like the TreeMap in the Java version
+	for _, m := range measurements {
+		t.Logf("%d\t%d\n", m.length, m.duration)
 	}
 }
 
@@ -0,0 +1,76 @@
+package encoder_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestO200kHarmonySpecialTokens(t *testing.T) {
+	tokens := encoding.SPECIAL_TOKENS_O200K_HARMONY
+	for token, id := range map[string]int{
+		"<|startoftext|>":     199998,
+		"<|endoftext|>":       199999,
+		"<|reserved_200000|>": 200000,
+		"<|return|>":          200002,
+		"<|constrain|>":       200003,
+		"<|channel|>":         200005,
+		"<|start|>":           200006,
+		"<|end|>":             200007,
+		"<|message|>":         200008,
+		"<|call|>":            200012,
+		"<|reserved_200013|>": 200013,
+		"<|endofprompt|>":     200018,
+		"<|reserved_201087|>": 201087,
+	} {
+		assert.Equal(t, id, tokens[token], token)
+	}
+	assert.Equal(t, 200018, tokens["<|reserved_200018|>"])
+	assert.NotContains(t, tokens, "<|reserved_201088|>")
+
+	ids := make(map[int]bool, len(tokens))
+	for _, id := range tokens {
+		ids[id] = true
+	}
+	assert.Len(t, ids, 201088-199998)
+	assert.Len(t, tokens, len(ids)+1, "only <|reserved_200018|> shares its id")
+}
+
+func TestO200kHarmonyReservedAlias(t *testing.T) {
+	harmony := encoding.O200kHarmony(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed))
+	assert.Equal(t, []int{200018}, harmony.EncodeToIntArray("<|reserved_200018|>"))
+	assert.Equal(t, []int{200018}, harmony.EncodeToIntArray("<|endofprompt|>"))
+	assert.Equal(t, "<|endofprompt|>", harmony.Decode([]int{200018}))
+
+	assert.Panics(t, func() {
+		encoding.O200kHarmony().EncodeToIntArray("<|reserved_200018|>")
+	})
+}
+
+func TestO200kHarmonyEncodesHarmonyMessages(t *testing.T) {
+	harmony := encoding.O200kHarmony(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed))
+	assert.Equal(t, "o200k_harmony", harmony.GetName())
+
+	text := "<|start|>assistant<|channel|>final<|message|>Hello!<|return|>"
+	tokens := harmony.EncodeToIntArray(text)
+	assert.Equal(t, 200006, tokens[0])
+	assert.Equal(t, 200002, tokens[len(tokens)-1])
+	assert.Contains(t, tokens, 200005)
+	assert.Contains(t, tokens, 200008)
+	assert.Equal(t, text, harmony.Decode(tokens))
+
+	base := encoding.O200kBase()
+	assert.Equal(t, base.EncodeOrdinaryToIntArray(text), harmony.EncodeOrdinaryToIntArray(text))
+}
+
+func TestHasToken(t *testing.T) {
+	enc := encoding.O200kHarmony().(mod.VocabularyEncoding)
+	assert.True(t, enc.HasToken(0))
+	assert.True(t, enc.HasToken(199997), "the last regular token")
+	assert.True(t, enc.HasToken(200006), "a special token")
+	assert.True(t, enc.HasToken(201087), "a reserved special token")
+	assert.False(t, enc.HasToken(201088))
+	assert.False(t, enc.HasToken(-1))
+}
@@ -0,0 +1,85 @@
+package encoder_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []mod.Event
+}
+
+func (o *recordingObserver) Observe(event mod.Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	event.Duration = 0
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) take() []mod.Event {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	events := o.events
+	o.events = nil
+	return events
+}
+
+func TestObserverReceivesAnEventPerOperation(t *testing.T) {
+	observer := &recordingObserver{}
+	enc := encoding.R50kBase(encoding.WithObserver(observer))
+	event := func(operation mod.Operation, inputBytes int, tokens int, truncated bool) mod.Event {
+		return mod.Event{Encoding: "r50k_base", Operation: operation, InputBytes: inputBytes, Tokens: tokens, Truncated: truncated}
+	}
+
+	enc.EncodeToIntArray("hello world")
+	assert.Equal(t, []mod.Event{event(mod.OPERATION_ENCODE, 11, 2, false)}, observer.take())
+	enc.EncodeOrdinary("hello world", 1)
+	assert.Equal(t, []mod.Event{event(mod.OPERATION_ENCODE_ORDINARY, 11, 1, true)}, observer.take())
+	enc.CountTokens("hello world")
+	enc.CountTokensOrdinary("hello")
+	assert.Equal(t, []mod.Event{event(mod.OPERATION_COUNT, 11, 2, false), event(mod.OPERATION_COUNT_ORDINARY, 5, 1, false)}, observer.take())
+	enc.Decode([]int{31373, 995})
+	assert.Equal(t, []mod.Event{event(mod.OPERATION_DECODE, 11, 2, false)}, observer.take())
+
+	enc.(mod.AppendEncoding).AppendEncode([]int{1, 2}, "hello world")
+	enc.(mod.ByteEncoding).EncodeBytes([]byte("hello\xff"))
+	enc.(mod.ParallelEncoding).CountTokensOrdinaryParallel("hello world", 2)
+	assert.Equal(t, []mod.Event{
+		event(mod.OPERATION_ENCODE, 11, 2, false),
+		event(mod.OPERATION_ENCODE_ORDINARY, 6, 2, false),
+		event(mod.OPERATION_COUNT_ORDINARY, 11, 2, false),
+	}, observer.take())
+
+	// truncating decodes internally, which isn't observed
+	enc.Encode("hello 😀", 2)
+	assert.Equal(t, []mod.Event{event(mod.OPERATION_ENCODE, 10, 1, true)}, observer.take())
+}
+
+func TestObserverSeesCacheLookups(t *testing.T) {
+	observer := &recordingObserver{}
+	enc := encoding.O200kBase(encoding.WithObserver(observer), encoding.WithPieceCache(100, 64))
+
+	enc.CountTokens(" tokenization tokenization")
+	events := observer.take()
+	assert.Equal(t, int64(1), events[0].CacheHits)
+	assert.Equal(t, int64(1), events[0].CacheMisses)
+}
+
+func TestObserverIsKeptByDeriveAndCanBeDetached(t *testing.T) {
+	observer := &recordingObserver{}
+	derived, err := encoding.Derive(encoding.Cl100kBase(encoding.WithObserver(observer)), "cl100k_im", map[string]int{"<|im_start|>": 100264}, nil)
+	assert.NoError(t, err)
+	derived.CountTokens("hi")
+	assert.Equal(t, "cl100k_im", observer.take()[0].Encoding)
+
+	enc := encoding.Cl100kBase(encoding.WithObserver(mod.NopObserver{}))
+	assert.Nil(t, enc.(*encoding.Cl100kGptBytePairEncoding).GetObserver())
+	enc.(*encoding.Cl100kGptBytePairEncoding).SetObserver(observer)
+	enc.CountTokens("hi")
+	assert.Len(t, observer.take(), 1)
+}
@@ -0,0 +1,52 @@
+package encoder_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecialTokenPolicies(t *testing.T) {
+	text := "Hello<|endoftext|>, world <|fim_prefix|>!"
+
+	disallowed := encoding.Cl100kBase()
+	assert.Panics(t, func() { disallowed.EncodeToIntArray(text) })
+	assert.Panics(t, func() { disallowed.CountTokens(text) })
+
+	asText := encoding.Cl100kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAsText))
+	assert.Equal(t, disallowed.EncodeOrdinaryToIntArray(text), asText.EncodeToIntArray(text))
+	assert.Equal(t, disallowed.CountTokensOrdinary(text), asText.CountTokens(text))
+
+	allowed := encoding.Cl100kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed))
+	expected := []int{9906, 100257, 11, 1917, 220, 100258, 0}
+	assert.Equal(t, expected, allowed.EncodeToIntArray(text))
+	assert.Equal(t, len(expected), allowed.CountTokens(text))
+	assert.Equal(t, text, allowed.Decode(allowed.EncodeToIntArray(text)))
+	assert.Equal(t, expected[:2], allowed.Encode(text, 2).GetTokens())
+	assert.Equal(t, disallowed.EncodeOrdinaryToIntArray(text), allowed.EncodeOrdinaryToIntArray(text))
+}
+
+func TestTruncationModes(t *testing.T) {
+	text := "🤚🏾 hello"
+
+	atCharacter := encoding.Cl100kBase()
+	result := atCharacter.Encode(text, 1)
+	assert.Empty(t, result.GetTokens())
+	assert.True(t, result.IsTruncated())
+
+	atToken := encoding.Cl100kBase(encoding.WithTruncation(encoding.TruncateAtToken))
+	result = atToken.Encode(text, 1)
+	assert.Equal(t, atToken.EncodeToIntArray(text)[:1], result.GetTokens())
+	assert.True(t, result.IsTruncated())
+	assert.Equal(t, len(atToken.DecodeBytes(result.GetTokens()))-1, result.GetLastProcessedCharacterIndex())
+}
+
+func TestPieceCacheOption(t *testing.T) {
+	enc := encoding.O200kBase(encoding.WithPieceCache(128, 32)).(*encoding.GptBytePairEncoding)
+	assert.NotNil(t, enc.GetPieceCache())
+	enc.CountTokens("an antidisestablishmentarianism, an antidisestablishmentarianism")
+	assert.Positive(t, enc.GetPieceCache().Stats().Hits)
+
+	assert.Nil(t, encoding.O200kBase().(*encoding.GptBytePairEncoding).GetPieceCache())
+}
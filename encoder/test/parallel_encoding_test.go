@@ -0,0 +1,87 @@
+package encoder_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/dlclark/regexp2"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateLargeDocument() string {
+	lines := []string{
+		"Many words map to one token, but some don't: indivisible.",
+		"Unicode characters like emojis may be split into many tokens containing the underlying bytes: 🤚🏾",
+		"I paid $123,456 to 9876543210 people!\r",
+		"Mixed script: 你好 world! 🌍",
+		"",
+		"    indented code(x, y) {",
+		"  \n\r  \r\n  \r \n  A\nA \n A",
+		"こんにちは世界 안녕하세요",
+		"It's 2:30pm;\n\n\n\nlet's eat, sleep , and code!",
+	}
+	var sb strings.Builder
+	for i := 0; sb.Len() < 600_000; i++ {
+		sb.WriteString(lines[i%len(lines)])
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func TestParallelEncodingMatchesSequential(t *testing.T) {
+	text := generateLargeDocument()
+	for _, enc := range []mod.Encoding{encoding.Cl100kBase(), encoding.O200kBase(), encoding.R50kBase()} {
+		parallelEncoding := enc.(mod.ParallelEncoding)
+
+		expected := enc.EncodeOrdinaryToIntArray(text)
+		assert.Equal(t, expected, parallelEncoding.EncodeOrdinaryParallel(text, len(expected)+1, 4).GetTokens(), enc.GetName())
+		assert.Equal(t, expected, parallelEncoding.EncodeParallel(text, len(expected), 0).GetTokens(), enc.GetName())
+		assert.Equal(t, len(expected), parallelEncoding.CountTokensParallel(text, 3))
+		assert.Equal(t, len(expected), parallelEncoding.CountTokensOrdinaryParallel(text, 8))
+	}
+}
+
+func TestParallelEncodingHonoursMaxTokens(t *testing.T) {
+	text := generateLargeDocument()
+	enc := encoding.Cl100kBase()
+	parallelEncoding := enc.(mod.ParallelEncoding)
+
+	for _, maxTokens := range []int{1, 10, 25_000, 60_000} {
+		expected := enc.EncodeOrdinary(text, maxTokens)
+		actual := parallelEncoding.EncodeOrdinaryParallel(text, maxTokens, 4)
+		assert.Equal(t, expected.GetTokens(), actual.GetTokens())
+		assert.Equal(t, expected.IsTruncated(), actual.IsTruncated())
+		assert.Equal(t, expected.GetLastProcessedCharacterIndex(), actual.GetLastProcessedCharacterIndex())
+	}
+}
+
+func TestParallelEncodingOfCustomPatternsIsSequential(t *testing.T) {
+	// the pieces of this pattern end with the line break, so cutting in front of it would lose the merge of "a\n"
+	ranks := map[string]int{"a\n": 256}
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	pattern := regexp2.MustCompile(`[^\n]*\n|[^\n]+`, regexp2.None)
+	enc := encoding.FromParameters(mod.NewGptBytePairEncodingParams("lines", pattern, ranks, map[string]int{}))
+	assert.False(t, encoding.CutsAtLineEnds(pattern))
+
+	text := strings.Repeat(strings.Repeat("a", 99)+"\n", 5000)
+	expected := enc.EncodeOrdinaryToIntArray(text)
+	assert.Equal(t, expected, enc.(mod.ParallelEncoding).EncodeOrdinaryParallel(text, len(expected), 4).GetTokens())
+	assert.Equal(t, len(expected), enc.(mod.ParallelEncoding).CountTokensOrdinaryParallel(text, 4))
+}
+
+func TestParallelEncodingKeepsSpecialTokensWithLineBreaks(t *testing.T) {
+	base := encoding.Cl100kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed))
+	enc, err := encoding.Derive(base, "cl100k_split", map[string]int{"<|a\nb|>": 200_000}, nil)
+	assert.NoError(t, err)
+
+	// the only positions to cut at are inside the special token
+	text := strings.Repeat(strings.Repeat("word ", 1000)+"<|a\nb|>", 200)
+	expected := enc.Encode(text, math.MaxInt).GetTokens()
+	assert.Contains(t, expected, 200_000)
+	assert.Equal(t, expected, enc.(mod.ParallelEncoding).EncodeParallel(text, math.MaxInt, 4).GetTokens())
+}
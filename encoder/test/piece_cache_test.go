@@ -0,0 +1,54 @@
+package encoder_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/currybab/tokgo/encoder"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPieceCacheGivesSameTokens(t *testing.T) {
+	enc := encoding.O200kBase().(*encoding.GptBytePairEncoding)
+	cache := encoder.NewPieceCache(1024, 64)
+	enc.SetPieceCache(cache)
+
+	reference := encoding.O200kBase()
+	text := "Hello, antidisestablishmentarianism! Hello, antidisestablishmentarianism! 🤚🏾🤚🏾 안녕하세요"
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, reference.EncodeToIntArray(text), enc.EncodeToIntArray(text))
+		assert.Equal(t, reference.CountTokens(text), enc.CountTokens(text))
+		for _, maxTokens := range []int{1, 3, 7} {
+			assert.Equal(t, reference.Encode(text, maxTokens).GetTokens(), enc.Encode(text, maxTokens).GetTokens())
+		}
+	}
+
+	stats := cache.Stats()
+	assert.Positive(t, stats.Hits)
+	assert.Positive(t, stats.Misses)
+	assert.Positive(t, stats.Entries)
+	assert.Greater(t, stats.HitRatio(), 0.5)
+}
+
+func TestPieceCacheIsBounded(t *testing.T) {
+	enc := encoding.Cl100kBase().(*encoding.Cl100kGptBytePairEncoding)
+	cache := encoder.NewPieceCache(32, 16)
+	enc.SetPieceCache(cache)
+
+	singleTokenStrings := getAllTokens()
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testString := generateRandomUtf8String(singleTokenStrings)
+			assert.Equal(t, testString, enc.Decode(enc.EncodeToIntArray(testString)))
+		}()
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	assert.LessOrEqual(t, stats.Entries, 32)
+	assert.Positive(t, stats.Evictions)
+}
@@ -0,0 +1,88 @@
+package encoder_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	"github.com/currybab/tokgo/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const PIECES_TEXT = "I'm here, they'll pay 12345!\n\n  ok  <|endoftext|>\xff"
+
+func collectPieces(encoding mod.Encoding, text string) []parser.Piece {
+	var pieces []parser.Piece
+	for piece := range encoding.(mod.PieceEncoding).Pieces(text) {
+		pieces = append(pieces, piece)
+	}
+	return pieces
+}
+
+func TestCl100kPiecesAreClassifiedBySplitRules(t *testing.T) {
+	pieces := collectPieces(encoding.Cl100kBase(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed)), PIECES_TEXT)
+
+	expected := []parser.Piece{
+		{Text: "I", Start: 0, End: 1, Kind: parser.PieceWord},
+		{Text: "'m", Start: 1, End: 3, Kind: parser.PieceContraction},
+		{Text: " here", Start: 3, End: 8, Kind: parser.PieceWord},
+		{Text: ",", Start: 8, End: 9, Kind: parser.PiecePunctuation},
+		{Text: " they", Start: 9, End: 14, Kind: parser.PieceWord},
+		{Text: "'ll", Start: 14, End: 17, Kind: parser.PieceContraction},
+		{Text: " pay", Start: 17, End: 21, Kind: parser.PieceWord},
+		{Text: " ", Start: 21, End: 22, Kind: parser.PieceTrailingWhitespace},
+		{Text: "123", Start: 22, End: 25, Kind: parser.PieceNumber},
+		{Text: "45", Start: 25, End: 27, Kind: parser.PieceNumber},
+		{Text: "!\n\n", Start: 27, End: 30, Kind: parser.PiecePunctuation},
+		{Text: " ", Start: 30, End: 31, Kind: parser.PieceTrailingWhitespace},
+		{Text: " ok", Start: 31, End: 34, Kind: parser.PieceWord},
+		{Text: "  ", Start: 34, End: 36, Kind: parser.PieceTrailingWhitespace},
+		{Text: "<|endoftext|>", Start: 36, End: 49, Kind: parser.PieceSpecialToken},
+		{Text: "\xff", Start: 49, End: 50, Kind: parser.PieceInvalidByte},
+	}
+	assert.Equal(t, expected, pieces)
+}
+
+func TestPiecesCoverTextForEveryEncoding(t *testing.T) {
+	texts := []string{"", PIECES_TEXT, "Mixed script: 你好 world! 🌍\r\n\r\n    x", ASCII_TEXT}
+	for _, encoding := range []mod.Encoding{encoding.Cl100kBase(), encoding.O200kBase(), encoding.P50kBase(), encoding.R50kBase()} {
+		for _, text := range texts {
+			var builder strings.Builder
+			end := 0
+			for _, piece := range collectPieces(encoding, text) {
+				assert.Equal(t, end, piece.Start, encoding.GetName())
+				assert.Equal(t, text[piece.Start:piece.End], piece.Text)
+				builder.WriteString(piece.Text)
+				end = piece.End
+			}
+			assert.Equal(t, text, builder.String(), encoding.GetName())
+		}
+	}
+}
+
+func TestRegexPiecesAreClassified(t *testing.T) {
+	pieces := collectPieces(encoding.R50kBase(), "they'll pay 12345!\n\n ok")
+
+	kinds := make([]parser.PieceKind, len(pieces))
+	for i, piece := range pieces {
+		kinds[i] = piece.Kind
+	}
+	assert.Equal(t, []parser.PieceKind{
+		parser.PieceWord, parser.PieceContraction, parser.PieceWord, parser.PieceNumber,
+		parser.PiecePunctuation, parser.PieceNewlineRun, parser.PieceWord,
+	}, kinds)
+}
+
+func TestPiecesStopEarly(t *testing.T) {
+	for _, encoding := range []mod.Encoding{encoding.Cl100kBase(), encoding.R50kBase()} {
+		count := 0
+		for range encoding.(mod.PieceEncoding).Pieces(ASCII_TEXT) {
+			count++
+			if count == 3 {
+				break
+			}
+		}
+		assert.Equal(t, 3, count)
+	}
+}
@@ -1,12 +1,13 @@
 package encoder
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"os"
 	"strconv"
 
 	"github.com/currybab/tokgo/mod"
-	"github.com/emirpasic/gods/v2/maps/treemap"
 )
 
 const (
@@ -14,53 +15,100 @@ const (
 	dummy_rank int = math.MaxInt32
 )
 
+// DEFAULT_VERY_LARGE_TOKENIZER_BYTE_THRESHOLD is the piece length from which the heap based
+// CalculateTokensLarge is faster than the quadratic calculateTokensSmall. In BenchmarkLargePieceThreshold
+// the quadratic merge wins at 128 bytes of ASCII letters for cl100k and o200k and the heap from 224 bytes,
+// 192 is in between. Multibyte scripts like Hangul cross over before 128 bytes.
+const DEFAULT_VERY_LARGE_TOKENIZER_BYTE_THRESHOLD = 192
+
 type TokenEncoder struct {
-	encoders                            []map[string]int
+	ranks                               *rankTable
 	decoder                             map[int][]byte
+	extraRanks                          *rankTable // nil == not extended
+	extraDecoder                        map[int][]byte
 	VERY_LARGE_TOKENIZER_BYTE_THRESHOLD int
+	PieceCache                          *PieceCache // nil == pieces are always merged
 }
 
 func NewTokenEncoder(encoder map[string]int) *TokenEncoder {
 	if len(encoder) > 0 {
 		thresholdKey := os.Getenv(mod.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY)
 		if thresholdKey == "" {
-			thresholdKey = "500"
+			thresholdKey = strconv.Itoa(DEFAULT_VERY_LARGE_TOKENIZER_BYTE_THRESHOLD)
 		}
 		VERY_LARGE_TOKENIZER_BYTE_THRESHOLD, _ := strconv.Atoi(thresholdKey)
-		tempEncoders := treemap.New[int, map[string]int]()
-		for k, v := range encoder {
-			length := len(k)
-			dict, ok := tempEncoders.Get(length)
-			if !ok {
-				dict = make(map[string]int)
-				tempEncoders.Put(length, dict)
-			}
-			dict[k] = v
-		}
-		//noinspection unchecked
-		keys := tempEncoders.Keys()
-		encoders := make([]map[string]int, keys[len(keys)-1]+1)
-		for _, k := range keys {
-			v, _ := tempEncoders.Get(k)
-			encoders[k] = v
-		}
 
 		decoder := make(map[int][]byte, len(encoder))
 		for k, v := range encoder {
 			decoder[v] = []byte(k)
 		}
 		return &TokenEncoder{
-			encoders:                            encoders,
+			ranks:                               newRankTable(encoder),
 			decoder:                             decoder,
 			VERY_LARGE_TOKENIZER_BYTE_THRESHOLD: VERY_LARGE_TOKENIZER_BYTE_THRESHOLD,
 		}
 	} else {
 		//noinspection unchecked
 		return &TokenEncoder{
-			encoders: []map[string]int{},
-			decoder:  map[int][]byte{},
+			ranks:   newRankTable(encoder),
+			decoder: map[int][]byte{},
+		}
+	}
+}
+
+// Clone returns a token encoder with the tokens and threshold of t and an empty piece cache of the
+// same size as the cache of t. Only the ranks, which never change, are shared.
+func (t *TokenEncoder) Clone() *TokenEncoder {
+	clone := *t
+	clone.PieceCache = t.PieceCache.emptyCopy()
+	return &clone
+}
+
+// Extend returns a token encoder with the tokens of t and the extra tokens. The ranks of t are
+// shared instead of copied, only the extra tokens take new memory. The extra tokens must not
+// reuse the bytes or ids of tokens of t. Like with Clone, the threshold of t is kept and
+// the piece cache of t is replaced by an empty one of the same size.
+func (t *TokenEncoder) Extend(extra map[string]int) (*TokenEncoder, error) {
+	extraDecoder := make(map[int][]byte, len(extra)+len(t.extraDecoder))
+	extraRanks := make(map[string]int, len(extra)+len(t.extraDecoder))
+	for token, bytes := range t.extraDecoder {
+		extraDecoder[token] = bytes
+		extraRanks[string(bytes)] = token
+	}
+	for bytes, token := range extra {
+		if token < 0 || token > math.MaxInt32-2 {
+			return nil, fmt.Errorf("token id %d of %q is out of range", token, bytes)
 		}
+		if t.encode([]byte(bytes)) != MAX_RANK {
+			return nil, fmt.Errorf("token %q already exists", bytes)
+		}
+		if t.HasToken(token) {
+			return nil, fmt.Errorf("token id %d of %q is already used", token, bytes)
+		}
+		extraDecoder[token] = []byte(bytes)
+		extraRanks[bytes] = token
+	}
+	if len(extraDecoder) != len(extraRanks) {
+		return nil, fmt.Errorf("extra token ids must be unique")
+	}
+
+	return &TokenEncoder{
+		ranks:                               t.ranks,
+		decoder:                             t.decoder,
+		extraRanks:                          newRankTable(extraRanks),
+		extraDecoder:                        extraDecoder,
+		VERY_LARGE_TOKENIZER_BYTE_THRESHOLD: t.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD,
+		PieceCache:                          t.PieceCache.emptyCopy(),
+	}, nil
+}
+
+// HasToken reports whether token is the id of a regular token.
+func (t *TokenEncoder) HasToken(token int) bool {
+	if _, ok := t.decoder[token]; ok {
+		return true
 	}
+	_, ok := t.extraDecoder[token]
+	return ok
 }
 
 func getMinRankIndex(ranks []int) int {
@@ -133,13 +181,76 @@ func (t *TokenEncoder) AddTokensAndGetCount(maxTokenCount int, keepEncodings boo
 			*out = append(*out, encoded)
 		}
 		return 1
+	} else if t.PieceCache != nil && t.PieceCache.accepts(match) {
+		return t.addCachedTokensAndGetCount(maxTokenCount, keepEncodings, match, out, ranks)
 	} else {
-		if len(match) < t.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD {
-			return t.calculateTokensSmall(maxTokenCount, keepEncodings, out, ranks, match)
-		} else {
-			return CalculateTokensLarge(t, maxTokenCount, keepEncodings, out, match)
+		return t.calculateTokens(maxTokenCount, keepEncodings, out, ranks, match)
+	}
+}
+
+func (t *TokenEncoder) calculateTokens(maxTokenCount int, keepEncodings bool, out *[]int, ranks *[]int, match []byte) int {
+	if len(match) < t.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD {
+		return t.calculateTokensSmall(maxTokenCount, keepEncodings, out, ranks, match)
+	} else {
+		return CalculateTokensLarge(t, maxTokenCount, keepEncodings, out, match)
+	}
+}
+
+func (t *TokenEncoder) addCachedTokensAndGetCount(maxTokenCount int, keepEncodings bool, match []byte, out *[]int, ranks *[]int) int {
+	tokens, ok := t.PieceCache.get(match)
+	if !ok {
+		// the cached tokens must not depend on the limits of the current call
+		tokens = make([]int, 0, len(match))
+		t.calculateTokens(math.MaxInt, true, &tokens, ranks, match)
+		t.PieceCache.put(match, tokens)
+	}
+	return appendCachedTokens(maxTokenCount, keepEncodings, tokens, out)
+}
+
+func appendCachedTokens(maxTokenCount int, keepEncodings bool, tokens []int, out *[]int) int {
+	if keepEncodings {
+		for _, token := range tokens {
+			if len(*out) >= maxTokenCount {
+				break
+			}
+			*out = append(*out, token)
+		}
+	}
+	return len(tokens)
+}
+
+// AddTokensAndGetCountContext is the same as AddTokensAndGetCount, but stops merging a piece of
+// VERY_LARGE_TOKENIZER_BYTE_THRESHOLD bytes or more once ctx is done and returns ctx.Err().
+// Nothing is added to out then. Shorter pieces are merged too quickly to be worth checking.
+func (t *TokenEncoder) AddTokensAndGetCountContext(ctx context.Context, maxTokenCount int, keepEncodings bool, byteArray []byte, out *[]int, ranks *[]int) (int, error) {
+	match := byteArray
+	done := ctx.Done()
+	if done == nil || len(match) < t.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD {
+		return t.AddTokensAndGetCount(maxTokenCount, keepEncodings, match, out, ranks), nil
+	}
+	if encoded := t.encode(match); encoded != MAX_RANK {
+		if keepEncodings {
+			*out = append(*out, encoded)
+		}
+		return 1, nil
+	}
+	if t.PieceCache == nil || !t.PieceCache.accepts(match) {
+		tokenCount, ok := calculateTokensLarge(t, maxTokenCount, keepEncodings, out, match, done)
+		if !ok {
+			return 0, ctx.Err()
+		}
+		return tokenCount, nil
+	}
+
+	tokens, ok := t.PieceCache.get(match)
+	if !ok {
+		tokens = make([]int, 0, len(match))
+		if _, ok := calculateTokensLarge(t, math.MaxInt, true, &tokens, match, done); !ok {
+			return 0, ctx.Err()
 		}
+		t.PieceCache.put(match, tokens)
 	}
+	return appendCachedTokens(maxTokenCount, keepEncodings, tokens, out), nil
 }
 
 func (t *TokenEncoder) calculateTokensSmall(maxTokenCount int, keepEncodings bool, out *[]int, ranks *[]int, match []byte) int {
@@ -147,7 +258,11 @@ func (t *TokenEncoder) calculateTokensSmall(maxTokenCount int, keepEncodings boo
 	if length <= 1 {
 		panic("Already filtered out")
 	}
-	*ranks = make([]int, 0, length+1)
+	if cap(*ranks) < length+1 {
+		*ranks = make([]int, 0, length+1)
+	} else {
+		*ranks = (*ranks)[:0]
+	}
 
 	minRankIndex := -1
 	for i, minRank := 0, MAX_RANK; i < length+1; i++ {
@@ -214,16 +329,11 @@ func (t *TokenEncoder) MergeBytesAndGetTokenCount(piece []byte, length int, rank
 }
 
 func (t *TokenEncoder) encode(payload []byte) int {
-	if len(payload) < len(t.encoders) {
-		encoder := t.encoders[len(payload)]
-		if len(encoder) > 0 {
-			result, ok := encoder[string(payload)]
-			if ok {
-				return result
-			}
-		}
+	rank := t.ranks.get(payload)
+	if rank == MAX_RANK && t.extraRanks != nil {
+		return t.extraRanks.get(payload)
 	}
-	return MAX_RANK
+	return rank
 }
 
 func (t *TokenEncoder) Encode(piece []byte, start int, end int) int {
@@ -238,5 +348,8 @@ func (t *TokenEncoder) DecodeToken(token int, specialEncodeer *SpecialEncoder) [
 	if decodeToken, ok := t.decoder[token]; ok {
 		return decodeToken
 	}
+	if decodeToken, ok := t.extraDecoder[token]; ok {
+		return decodeToken
+	}
 	return specialEncodeer.DecodeIfPresent(token)
 }
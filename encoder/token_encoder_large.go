@@ -1,142 +1,143 @@
 package encoder
 
-import (
-	"fmt"
-	"math"
-
-	"github.com/emirpasic/gods/v2/maps/linkedhashmap"
-	"github.com/emirpasic/gods/v2/maps/treemap"
-)
-
-type rankNode struct {
+// mergeCandidate is a possible merge of the part starting at index with its next part.
+type mergeCandidate struct {
 	rank  int
 	index int
-	prev  *rankNode
-	next  *rankNode
 }
 
-func newRankNode(rank int, index int, prev *rankNode) *rankNode {
-	return &rankNode{
-		rank:  rank,
-		index: index,
-		prev:  prev,
+func (m mergeCandidate) less(other mergeCandidate) bool {
+	return m.rank < other.rank || (m.rank == other.rank && m.index < other.index)
+}
+
+// mergeHeap is a binary min-heap of merge candidates, ordered by rank and then by index
+// so that equal ranks are merged from left to right, like in calculateTokensSmall.
+type mergeHeap []mergeCandidate
+
+func (h mergeHeap) init() {
+	for i := len(h)/2 - 1; i >= 0; i-- {
+		h.down(i)
 	}
 }
 
-func (r *rankNode) ToString() string {
-	return fmt.Sprintf("rankNode{rank=%d, index=%d}", r.rank, r.index)
+func (h *mergeHeap) push(candidate mergeCandidate) {
+	*h = append(*h, candidate)
+	h.up(len(*h) - 1)
+}
+
+func (h *mergeHeap) pop() mergeCandidate {
+	old := *h
+	last := len(old) - 1
+	top := old[0]
+	old[0] = old[last]
+	*h = old[:last]
+	h.down(0)
+	return top
 }
 
-func RemoveNode(nodeMap *linkedhashmap.Map[int, *rankNode], rankMap *treemap.Map[int, *linkedhashmap.Map[int, *rankNode]], node *rankNode) {
-	if nodeMap.Size() == 1 {
-		if _, ok := nodeMap.Get(node.index); ok {
-			rankMap.Remove(node.rank)
-		} else {
-			panic("nodeMap.containsKey(node.index);")
+func (h mergeHeap) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h[i].less(h[parent]) {
+			break
 		}
-	} else {
-		nodeMap.Remove(node.index)
+		h[i], h[parent] = h[parent], h[i]
+		i = parent
 	}
 }
 
-func CalculateTokensLarge(tokenEncoder *TokenEncoder, maxTokenCount int, keepEncodings bool, out *[]int, match []byte) int {
-	rankMap := treemap.New[int, *linkedhashmap.Map[int, *rankNode]]()
-
-	var prev *rankNode = nil
-	for i := 0; i < len(match)+1; i++ {
-		rank := tokenEncoder.Encode(match, i, i+2)
-		node := newRankNode(rank, i, prev)
-		if prev != nil {
-			prev.next = node
+func (h mergeHeap) down(i int) {
+	for {
+		smallest := i
+		if left := 2*i + 1; left < len(h) && h[left].less(h[smallest]) {
+			smallest = left
 		}
-		prev = node
-
-		rankNodeMap, ok := rankMap.Get(rank)
-		if !ok {
-			rankNodeMap = linkedhashmap.New[int, *rankNode]()
-			rankMap.Put(rank, rankNodeMap)
+		if right := 2*i + 2; right < len(h) && h[right].less(h[smallest]) {
+			smallest = right
 		}
-		rankNodeMap.Put(i, node)
+		if smallest == i {
+			return
+		}
+		h[i], h[smallest] = h[smallest], h[i]
+		i = smallest
 	}
+}
 
-	if _, ok := rankMap.Get(MAX_RANK); !ok {
-		panic("rankMap.containsKey(MAX_RANK)")
-	}
+// cancelCheckInterval is the number of merge steps between two checks for cancellation.
+const cancelCheckInterval = 4096
 
-	tokenCount := len(match)
-	for tokenCount > 2 && rankMap.Size() > 1 {
-		firstIt := rankMap.Iterator()
-		var minNodeMap *linkedhashmap.Map[int, *rankNode] = nil
-		if firstIt.First() {
-			minNodeMap = firstIt.Value()
-			rankMap.Remove(firstIt.Key())
-		}
+// CalculateTokensLarge merges the bytes of a long piece in O(n log n).
+// The remaining parts are kept in an index based doubly linked list and the possible merges
+// in a min-heap. Candidates are not removed from the heap when a merge changes a rank,
+// instead they are skipped when popped if their rank is not the current rank of the part anymore.
+func CalculateTokensLarge(tokenEncoder *TokenEncoder, maxTokenCount int, keepEncodings bool, out *[]int, match []byte) int {
+	tokenCount, _ := calculateTokensLarge(tokenEncoder, maxTokenCount, keepEncodings, out, match, nil)
+	return tokenCount
+}
 
-		it := minNodeMap.Iterator()
-		for it.Begin(); it.Next(); {
-			minNode := it.Value()
-			minRank := minNode.rank
-			if minRank == MAX_RANK {
-				panic("minRank == MAX_RANK")
+// calculateTokensLarge is CalculateTokensLarge, but gives up and returns false once done is closed.
+// Nothing is added to out then. A nil done is never checked.
+func calculateTokensLarge(tokenEncoder *TokenEncoder, maxTokenCount int, keepEncodings bool, out *[]int, match []byte, done <-chan struct{}) (int, bool) {
+	length := len(match)
+
+	// index length is a sentinel part marking the end of the piece
+	prev := make([]int32, length+1)
+	next := make([]int32, length+1)
+	ranks := make([]int, length+1)
+	candidates := make(mergeHeap, 0, length)
+	for i := 0; i <= length; i++ {
+		prev[i] = int32(i - 1)
+		next[i] = int32(i + 1)
+		ranks[i] = tokenEncoder.Encode(match, i, i+2)
+		if ranks[i] != MAX_RANK {
+			candidates = append(candidates, mergeCandidate{rank: ranks[i], index: i})
+		}
+	}
+	candidates.init()
+
+	tokenCount := length
+	for step := 0; len(candidates) > 0; step++ {
+		if done != nil && step%cancelCheckInterval == 0 {
+			select {
+			case <-done:
+				return 0, false
+			default:
 			}
+		}
+		candidate := candidates.pop()
+		index := candidate.index
+		if ranks[index] != candidate.rank {
+			continue // stale
+		}
 
-			previousNode := minNode.prev
-			nextNode := minNode.next
-			nextNextNode := nextNode.next
-			nextNextNextNode := nextNextNode.next
-
-			if previousNode != nil {
-				newRank := tokenEncoder.Encode(match, previousNode.index, nextNextNode.index)
-				if previousNode.rank != newRank {
-					if previousNode.rank == minRank {
-						panic("previousNode.rank == minRank")
-					}
-					if nodeMap, ok := rankMap.Get(previousNode.rank); ok {
-						RemoveNode(nodeMap, rankMap, previousNode)
-					}
-					previousNode.rank = newRank
-					nodeMap, ok := rankMap.Get(newRank)
-					if !ok {
-						nodeMap = linkedhashmap.New[int, *rankNode]()
-						rankMap.Put(newRank, nodeMap)
-					}
-					nodeMap.Put(previousNode.index, previousNode)
-				}
-			}
+		// merge the next part into the part at index
+		nextIndex := int(next[index])
+		nextNextIndex := int(next[nextIndex])
+		next[index] = int32(nextNextIndex)
+		prev[nextNextIndex] = int32(index)
+		ranks[nextIndex] = dummy_rank
+		tokenCount--
+
+		newRankEnd := length + 1
+		if nextNextIndex < length {
+			newRankEnd = int(next[nextNextIndex])
+		}
+		ranks[index] = tokenEncoder.Encode(match, index, newRankEnd)
+		if ranks[index] != MAX_RANK {
+			candidates.push(mergeCandidate{rank: ranks[index], index: index})
+		}
 
-			newRankIndex := math.MaxInt32
-			if nextNextNextNode != nil {
-				newRankIndex = nextNextNextNode.index
-			}
-			newRank := tokenEncoder.Encode(match, minNode.index, newRankIndex)
-			minNode.rank = newRank
-			nodeMap, ok := rankMap.Get(newRank)
-			if !ok {
-				nodeMap = linkedhashmap.New[int, *rankNode]()
-				rankMap.Put(newRank, nodeMap)
+		if previousIndex := int(prev[index]); previousIndex >= 0 {
+			ranks[previousIndex] = tokenEncoder.Encode(match, previousIndex, nextNextIndex)
+			if ranks[previousIndex] != MAX_RANK {
+				candidates.push(mergeCandidate{rank: ranks[previousIndex], index: previousIndex})
 			}
-			nodeMap.Put(minNode.index, minNode)
-
-			minNode.next = nextNextNode
-			nextNextNode.prev = minNode
-			if nextNode.rank != MAX_RANK {
-				if nextNode.rank != minRank {
-					if nodeMap, ok := rankMap.Get(nextNode.rank); ok {
-						RemoveNode(nodeMap, rankMap, nextNode)
-					}
-				} else {
-					it.Next()
-				}
-			}
-
-			tokenCount--
 		}
 	}
 
 	if keepEncodings {
-		headNodeMap, _ := rankMap.Get(MAX_RANK)
-		for head, _ := headNodeMap.Get(0); head.next != nil && len(*out) < maxTokenCount; head = head.next {
-			token := tokenEncoder.Encode(match, head.index, head.next.index)
+		for start := 0; start < length && len(*out) < maxTokenCount; start = int(next[start]) {
+			token := tokenEncoder.Encode(match, start, int(next[start]))
 			if token == MAX_RANK {
 				panic("Token should not be MAX_RANK")
 			}
@@ -144,5 +145,5 @@ func CalculateTokensLarge(tokenEncoder *TokenEncoder, maxTokenCount int, keepEnc
 		}
 	}
 
-	return tokenCount
+	return tokenCount, true
 }
@@ -0,0 +1,43 @@
+package encoding
+
+import (
+	regexp "github.com/dlclark/regexp2"
+)
+
+// CutsAtLineEnds reports whether text that is pre-tokenized with pattern yields the same pieces when it is
+// cut into parts at the positions of NextLineEndCut. That holds for nil, the cl100k splitter of the parser package,
+// and the patterns of the built-in encodings: none of them lets a piece cross such a position or looks behind.
+// It is false for every other pattern, even one with the same expression.
+func CutsAtLineEnds(pattern *regexp.Regexp) bool {
+	return pattern == nil || pattern == o200kPattern || pattern == x50kPattern
+}
+
+// NextLineEndCut returns the first position at or after from that is right before a line break
+// following an ASCII letter or digit, or -1 if there is none.
+func NextLineEndCut[T string | []byte](text T, from int) int {
+	for i := max(from, 1); i < len(text); i++ {
+		if isLineEndCut(text, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// LastLineEndCut returns the last position of text that is right before a line break
+// following an ASCII letter or digit, or -1 if there is none.
+func LastLineEndCut[T string | []byte](text T) int {
+	for i := len(text) - 1; i > 0; i-- {
+		if isLineEndCut(text, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isLineEndCut[T string | []byte](text T, i int) bool {
+	return (text[i] == '\n' || text[i] == '\r') && isASCIIAlphanumeric(text[i-1])
+}
+
+func isASCIIAlphanumeric(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
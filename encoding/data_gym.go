@@ -0,0 +1,149 @@
+package encoding
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// dataGymSpecialTokens are in encoder.json but aren't mergeable tokens.
+var dataGymSpecialTokens = []string{ENDOFTEXT, STARTOFTEXT}
+
+// newDataGymByteDecoder returns the inverse of the byte to unicode mapping of GPT-2's encoder.py and
+// the single byte tokens in rank order: the printable bytes keep their code point, the others are
+// shifted to 256 and up in their order, and the printable bytes get the first ranks.
+func newDataGymByteDecoder() (map[rune]byte, []byte) {
+	decoder := make(map[rune]byte, 256)
+	rankToByte := make([]byte, 0, 256)
+	isPrintable := func(b int) bool {
+		return (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF)
+	}
+	for b := 0; b < 256; b++ {
+		if isPrintable(b) {
+			decoder[rune(b)] = byte(b)
+			rankToByte = append(rankToByte, byte(b))
+		}
+	}
+	shifted := 0
+	for b := 0; b < 256; b++ {
+		if !isPrintable(b) {
+			decoder[rune(256+shifted)] = byte(b)
+			rankToByte = append(rankToByte, byte(b))
+			shifted++
+		}
+	}
+	return decoder, rankToByte
+}
+
+func decodeDataGym(decoder map[rune]byte, value string) (string, error) {
+	var builder strings.Builder
+	for _, r := range value {
+		b, ok := decoder[r]
+		if !ok {
+			return "", fmt.Errorf("%q is not a data gym byte", r)
+		}
+		builder.WriteByte(b)
+	}
+	return builder.String(), nil
+}
+
+// LoadDataGymRanks reads the GPT-2 vocab.bpe and encoder.json files, see ReadDataGymRanks.
+func LoadDataGymRanks(vocabBpeFile string, encoderJsonFile string) (map[string]int, error) {
+	vocabBpe, err := os.Open(vocabBpeFile)
+	if err != nil {
+		return nil, err
+	}
+	defer vocabBpe.Close()
+	encoderJson, err := os.Open(encoderJsonFile)
+	if err != nil {
+		return nil, err
+	}
+	defer encoderJson.Close()
+	return ReadDataGymRanks(vocabBpe, encoderJson)
+}
+
+// ReadDataGymRanks converts a GPT-2 style vocabulary ("data gym" format) to mergeable ranks for
+// mod.NewGptBytePairEncodingParams, like tiktoken's data_gym_to_mergeable_bpe_ranks.
+// The single bytes get the first 256 ranks and every merge of vocabBpe the next one, in order.
+// encoderJson must assign the same ids to the same tokens, except for <|endoftext|> and <|startoftext|>,
+// because the ranks are used as merge priorities. It isn't checked if encoderJson is nil.
+func ReadDataGymRanks(vocabBpe io.Reader, encoderJson io.Reader) (map[string]int, error) {
+	decoder, rankToByte := newDataGymByteDecoder()
+	ranks := make(map[string]int, 50257)
+	for rank, b := range rankToByte {
+		ranks[string([]byte{b})] = rank
+	}
+
+	// like tiktoken every merge takes the next rank, even if its bytes were merged before
+	nextRank := len(ranks)
+	scanner := bufio.NewScanner(vocabBpe)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if (line == 1 && strings.HasPrefix(text, "#version")) || strings.TrimSpace(text) == "" {
+			continue
+		}
+		parts := strings.Fields(text)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("vocab.bpe line %d: expected two tokens but was %q", line, text)
+		}
+		first, err := decodeDataGym(decoder, parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("vocab.bpe line %d: %w", line, err)
+		}
+		second, err := decodeDataGym(decoder, parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("vocab.bpe line %d: %w", line, err)
+		}
+		ranks[first+second] = nextRank
+		nextRank++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if encoderJson == nil {
+		return ranks, nil
+	}
+	if err := verifyDataGymEncoder(decoder, ranks, encoderJson); err != nil {
+		return nil, err
+	}
+	return ranks, nil
+}
+
+func verifyDataGymEncoder(decoder map[rune]byte, ranks map[string]int, encoderJson io.Reader) error {
+	var encoder map[string]int
+	if err := json.NewDecoder(encoderJson).Decode(&encoder); err != nil {
+		return fmt.Errorf("encoder.json: %w", err)
+	}
+	for _, token := range dataGymSpecialTokens {
+		delete(encoder, token)
+	}
+
+	// sorted for a deterministic first mismatch
+	tokens := make([]string, 0, len(encoder))
+	for token := range encoder {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	for _, token := range tokens {
+		decoded, err := decodeDataGym(decoder, token)
+		if err != nil {
+			return fmt.Errorf("encoder.json: %w", err)
+		}
+		rank, ok := ranks[decoded]
+		if !ok {
+			return fmt.Errorf("encoder.json token %q (%d) is not in vocab.bpe", token, encoder[token])
+		}
+		if rank != encoder[token] {
+			return fmt.Errorf("encoder.json token %q has id %d but rank %d in vocab.bpe", token, encoder[token], rank)
+		}
+	}
+	if len(encoder) != len(ranks) {
+		return fmt.Errorf("encoder.json has %d mergeable tokens but vocab.bpe %d", len(encoder), len(ranks))
+	}
+	return nil
+}
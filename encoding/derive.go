@@ -0,0 +1,90 @@
+package encoding
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/currybab/tokgo/encoder"
+	"github.com/currybab/tokgo/mod"
+)
+
+// Derive returns an encoding named name with the ranks, pattern and options of base plus
+// extraSpecial special tokens and extraTokens regular tokens, for example cl100k_base with
+// <|im_start|> and <|im_end|>. The ranks of base are shared, not copied. A piece cache of base
+// isn't shared either, the derived encoding gets an empty one of the same size.
+// It fails if an extra token or id is already used by base or by another extra token,
+// and if base isn't a byte pair encoding of this package.
+func Derive(base mod.Encoding, name string, extraSpecial map[string]int, extraTokens map[string]int) (mod.Encoding, error) {
+	if name == "" {
+		return nil, fmt.Errorf("derived encoding needs a name")
+	}
+	var gptBase *GptBytePairEncoding
+	switch e := base.(type) {
+	case *GptBytePairEncoding:
+		gptBase = e
+	case *Cl100kGptBytePairEncoding:
+		gptBase = e.GptBytePairEncoding
+	default:
+		return nil, fmt.Errorf("cannot derive an encoding from %T", base)
+	}
+
+	tokenEncoder := gptBase.Encoder.Clone()
+	if len(extraTokens) > 0 {
+		var err error
+		if tokenEncoder, err = gptBase.Encoder.Extend(extraTokens); err != nil {
+			return nil, fmt.Errorf("cannot derive %s from %s: %w", name, gptBase.name, err)
+		}
+	}
+
+	specialTokens := gptBase.specialEncoder.Tokens()
+	specialIds := make(map[int]string, len(specialTokens))
+	for _, id := range specialTokens {
+		specialIds[id] = string(gptBase.specialEncoder.DecodeIfPresent(id))
+	}
+	// sorted for deterministic errors
+	names := make([]string, 0, len(extraSpecial))
+	for token := range extraSpecial {
+		names = append(names, token)
+	}
+	sort.Strings(names)
+	for _, token := range names {
+		id := extraSpecial[token]
+		switch {
+		case !strings.Contains(token, encoder.SPECIAL_START) || !strings.Contains(token, encoder.SPECIAL_END):
+			return nil, fmt.Errorf("special token %q must contain %s and %s", token, encoder.SPECIAL_START, encoder.SPECIAL_END)
+		case id < 0:
+			return nil, fmt.Errorf("special token id %d of %q is negative", id, token)
+		}
+		if _, exists := specialTokens[token]; exists {
+			return nil, fmt.Errorf("special token %q already exists", token)
+		}
+		if other, exists := specialIds[id]; exists {
+			return nil, fmt.Errorf("special token id %d of %q is already used by %q", id, token, other)
+		}
+		if tokenEncoder.HasToken(id) {
+			return nil, fmt.Errorf("special token id %d of %q is already used by a regular token", id, token)
+		}
+		specialTokens[token] = id
+		specialIds[id] = token
+	}
+	for token, id := range extraTokens {
+		if other, exists := specialIds[id]; exists {
+			return nil, fmt.Errorf("token id %d of %q is already used by %q", id, token, other)
+		}
+	}
+
+	derived := &GptBytePairEncoding{
+		Encoder:            tokenEncoder,
+		name:               name,
+		pattern:            gptBase.pattern,
+		specialEncoder:     encoder.NewSpecialEncoder(specialTokens),
+		specialTokenPolicy: gptBase.specialTokenPolicy,
+		truncation:         gptBase.truncation,
+		observer:           gptBase.observer,
+	}
+	if _, ok := base.(*Cl100kGptBytePairEncoding); ok {
+		return &Cl100kGptBytePairEncoding{GptBytePairEncoding: derived}, nil
+	}
+	return derived, nil
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -13,7 +15,6 @@ import (
 	regexp "github.com/dlclark/regexp2"
 
 	"github.com/currybab/tokgo/mod"
-	"github.com/currybab/tokgo/parser"
 )
 
 // Special token constants
@@ -23,6 +24,16 @@ const (
 	FIM_MIDDLE  = "<|fim_middle|>"
 	FIM_SUFFIX  = "<|fim_suffix|>"
 	ENDOFPROMPT = "<|endofprompt|>"
+
+	// harmony chat format
+	STARTOFTEXT = "<|startoftext|>"
+	START       = "<|start|>"
+	END         = "<|end|>"
+	MESSAGE     = "<|message|>"
+	CHANNEL     = "<|channel|>"
+	CONSTRAIN   = "<|constrain|>"
+	RETURN      = "<|return|>"
+	CALL        = "<|call|>"
 )
 
 // Special token maps
@@ -47,33 +58,66 @@ var (
 		ENDOFTEXT:   199999,
 		ENDOFPROMPT: 200018,
 	}
+	SPECIAL_TOKENS_O200K_HARMONY = newO200kHarmonySpecialTokens()
 )
 
-func R50kBase() mod.Encoding {
+// newO200kHarmonySpecialTokens returns the o200k_base special tokens, the harmony tokens and
+// <|reserved_N|> for every other id up to 201087. Like in tiktoken <|reserved_200018|> is kept too,
+// as an alias of <|endofprompt|>.
+func newO200kHarmonySpecialTokens() map[string]int {
+	tokens := map[string]int{
+		STARTOFTEXT: 199998,
+		RETURN:      200002,
+		CONSTRAIN:   200003,
+		CHANNEL:     200005,
+		START:       200006,
+		END:         200007,
+		MESSAGE:     200008,
+		CALL:        200012,
+	}
+	for token, id := range SPECIAL_TOKENS_O200K_BASE {
+		tokens[token] = id
+	}
+	used := make(map[int]bool, len(tokens))
+	for _, id := range tokens {
+		used[id] = true
+	}
+	for id := 200000; id < 201088; id++ {
+		if !used[id] || id == tokens[ENDOFPROMPT] {
+			tokens[fmt.Sprintf("<|reserved_%d|>", id)] = id
+		}
+	}
+	return tokens
+}
+
+func R50kBase(opts ...Option) mod.Encoding {
 	return from50kParameters(
 		"r50k_base",
 		"r50k_base.tiktoken",
 		SPECIAL_TOKENS_X50K_BASE,
+		opts...,
 	)
 }
 
-func P50kBase() mod.Encoding {
+func P50kBase(opts ...Option) mod.Encoding {
 	return from50kParameters(
 		"p50k_base",
 		"p50k_base.tiktoken",
 		SPECIAL_TOKENS_X50K_BASE,
+		opts...,
 	)
 }
 
-func P50kEdit() mod.Encoding {
+func P50kEdit(opts ...Option) mod.Encoding {
 	return from50kParameters(
 		"p50k_edit",
 		"p50k_base.tiktoken",
 		SPECIAL_TOKENS_P50K_EDIT,
+		opts...,
 	)
 }
 
-func Cl100kBase() mod.Encoding {
+func Cl100kBase(opts ...Option) mod.Encoding {
 	mergeableRanks, err := LoadMergeableRanks("cl100k_base.tiktoken")
 	if err != nil {
 		panic(err)
@@ -88,15 +132,21 @@ func Cl100kBase() mod.Encoding {
 		mergeableRanks,
 		SPECIAL_TOKENS_CL100K_BASE,
 	)
-	return NewCl100kGptBytePairEncoding(params)
+	return NewCl100kGptBytePairEncoding(params, opts...)
 }
 
-func O200kBase() mod.Encoding {
-	mergeableRanks, err := LoadMergeableRanks("o200k_base.tiktoken")
-	if err != nil {
-		panic(err)
-	}
-	patterns := []string{
+func O200kBase(opts ...Option) mod.Encoding {
+	return fromO200kParameters("o200k_base", SPECIAL_TOKENS_O200K_BASE, opts...)
+}
+
+// O200kHarmony is o200k_base with the special tokens of the harmony chat format used by gpt-oss.
+func O200kHarmony(opts ...Option) mod.Encoding {
+	return fromO200kParameters("o200k_harmony", SPECIAL_TOKENS_O200K_HARMONY, opts...)
+}
+
+// The patterns of the built-in encodings are compiled once, CutsAtLineEnds recognizes them by identity.
+var (
+	o200kPattern = regexp.MustCompile(strings.Join([]string{
 		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
 		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
 		`\p{N}{1,3}`,
@@ -104,36 +154,36 @@ func O200kBase() mod.Encoding {
 		`\s*[\r\n]+`,
 		`\s+(?!\S)`,
 		`\s+`,
-	}
-	regex, err := regexp.Compile(strings.Join(patterns, "|"), regexp.None)
+	}, "|"), regexp.None)
+	x50kPattern = regexp.MustCompile(`'(?:[sdmt]|ll|ve|re)| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`, regexp.None)
+)
+
+func fromO200kParameters(name string, specialTokens map[string]int, opts ...Option) mod.Encoding {
+	mergeableRanks, err := LoadMergeableRanks("o200k_base.tiktoken")
 	if err != nil {
 		panic(err)
 	}
 	params := mod.NewGptBytePairEncodingParams(
-		"o200k_base",
-		regex,
+		name,
+		o200kPattern,
 		mergeableRanks,
-		SPECIAL_TOKENS_O200K_BASE,
+		specialTokens,
 	)
-	return FromParameters(params)
+	return FromParameters(params, opts...)
 }
 
-func from50kParameters(name, fileName string, specialTokens map[string]int) mod.Encoding {
-	regex, err := regexp.Compile(`'(?:[sdmt]|ll|ve|re)| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`, regexp.None)
-	if err != nil {
-		panic(err)
-	}
+func from50kParameters(name, fileName string, specialTokens map[string]int, opts ...Option) mod.Encoding {
 	mergeableRanks, err := LoadMergeableRanks(fileName)
 	if err != nil {
 		panic(err)
 	}
 	params := mod.NewGptBytePairEncodingParams(
 		name,
-		regex,
+		x50kPattern,
 		mergeableRanks,
 		specialTokens,
 	)
-	return FromParameters(params)
+	return FromParameters(params, opts...)
 }
 
 // getResourcePath returns the path to a resource file relative to this source file
@@ -150,8 +200,13 @@ func LoadMergeableRanks(fileName string) (map[string]int, error) {
 		return nil, err
 	}
 	defer file.Close()
+	return ReadMergeableRanks(file)
+}
+
+// ReadMergeableRanks reads ranks in the .tiktoken format, a base64 encoded token and its rank per line.
+func ReadMergeableRanks(reader io.Reader) (map[string]int, error) {
 	result := make(map[string]int)
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
 		line := scanner.Text()
 		parts := strings.SplitN(line, " ", 2)
@@ -178,22 +233,17 @@ type Cl100kGptBytePairEncoding struct {
 	*GptBytePairEncoding
 }
 
-func NewCl100kGptBytePairEncoding(params *mod.GptBytePairEncodingParams) mod.Encoding {
-	return &Cl100kGptBytePairEncoding{
-		GptBytePairEncoding: NewGptBytePairEncoding(params),
-	}
+// AllowSpecial returns e with the SpecialTokensAllowed policy, everything else is shared with e.
+func (e *Cl100kGptBytePairEncoding) AllowSpecial() mod.Encoding {
+	return &Cl100kGptBytePairEncoding{GptBytePairEncoding: e.GptBytePairEncoding.AllowSpecial().(*GptBytePairEncoding)}
 }
 
-func (e *Cl100kGptBytePairEncoding) encodeOrdinaryInternalToInt(text string, maxTokenCount int, keepEncodings bool, out *[]int) int {
-	tokenCount := []int{0}
-	ranks := make([]int, 0)
-	parser.Split(text, func(utf8BytesList []byte) bool {
-		tokenCount[0] += e.GptBytePairEncoding.Encoder.AddTokensAndGetCount(maxTokenCount, keepEncodings, utf8BytesList, out, &ranks)
-		return tokenCount[0] >= maxTokenCount
-	})
-	return tokenCount[0]
+func NewCl100kGptBytePairEncoding(params *mod.GptBytePairEncodingParams, opts ...Option) mod.Encoding {
+	return &Cl100kGptBytePairEncoding{
+		GptBytePairEncoding: NewGptBytePairEncoding(params, opts...),
+	}
 }
 
-func FromParameters(params *mod.GptBytePairEncodingParams) mod.Encoding {
-	return NewGptBytePairEncoding(params)
+func FromParameters(params *mod.GptBytePairEncodingParams, opts ...Option) mod.Encoding {
+	return NewGptBytePairEncoding(params, opts...)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 	"unicode/utf8"
 
 	regexp "github.com/dlclark/regexp2"
@@ -45,19 +46,24 @@ func (i *internalResult) ToTokenCount() int {
 }
 
 type GptBytePairEncoding struct {
-	Encoder        *encoder.TokenEncoder
-	name           string
-	pattern        *regexp.Regexp
-	specialEncoder *encoder.SpecialEncoder
+	Encoder            *encoder.TokenEncoder
+	name               string
+	pattern            *regexp.Regexp
+	specialEncoder     *encoder.SpecialEncoder
+	specialTokenPolicy SpecialTokenPolicy
+	truncation         TruncationMode
+	observer           mod.Observer
 }
 
-func NewGptBytePairEncoding(params *mod.GptBytePairEncodingParams) *GptBytePairEncoding {
-	return &GptBytePairEncoding{
+func NewGptBytePairEncoding(params *mod.GptBytePairEncodingParams, opts ...Option) *GptBytePairEncoding {
+	e := &GptBytePairEncoding{
 		name:           params.GetName(),
 		pattern:        params.GetPattern(),
 		Encoder:        encoder.NewTokenEncoder(params.GetEncoder()),
 		specialEncoder: encoder.NewSpecialEncoder(params.GetSpecialTokensEncoder()),
 	}
+	newOptions(opts).apply(e)
+	return e
 }
 
 func (e *GptBytePairEncoding) encodeInternal(text string, maxTokenCount int, keepEncodings bool) *internalResult {
@@ -65,9 +71,41 @@ func (e *GptBytePairEncoding) encodeInternal(text string, maxTokenCount int, kee
 		return newInternalResult([]int{}, -1, false, -1)
 	}
 
-	e.specialEncoder.CheckForSpecialTokens(text)
+	out := make([]int, 0)
+	tokenCount := e.encodeInternalToInt(text, maxTokenCount, keepEncodings, &out)
+	return e.newEncodedResult(text, out, tokenCount, maxTokenCount, keepEncodings)
+}
 
-	return e.encodeOrdinaryInternal(text, maxTokenCount, keepEncodings)
+// encodeInternalToInt encodes text into out, treating special tokens according to the special token policy.
+func (e *GptBytePairEncoding) encodeInternalToInt(text string, maxTokenCount int, keepEncodings bool, out *[]int) int {
+	switch e.specialTokenPolicy {
+	case SpecialTokensAllowed:
+		return e.encodeWithSpecialTokensToInt(text, maxTokenCount, keepEncodings, out)
+	case SpecialTokensDisallowed:
+		e.specialEncoder.CheckForSpecialTokens(text)
+	}
+	return e.encodeOrdinaryInternalToInt(text, maxTokenCount, keepEncodings, out)
+}
+
+// encodeWithSpecialTokensToInt encodes the text between special tokens as ordinary text
+// and the special tokens themselves to their ids.
+func (e *GptBytePairEncoding) encodeWithSpecialTokensToInt(text string, maxTokenCount int, keepEncodings bool, out *[]int) int {
+	tokenCount := 0
+	for text != "" && tokenCount < maxTokenCount {
+		index, token, length := e.specialEncoder.FindNext(text)
+		if index < 0 {
+			return tokenCount + e.encodeOrdinaryInternalToInt(text, maxTokenCount, keepEncodings, out)
+		}
+		if index > 0 {
+			tokenCount += e.encodeOrdinaryInternalToInt(text[:index], maxTokenCount, keepEncodings, out)
+		}
+		if keepEncodings && len(*out) < maxTokenCount {
+			*out = append(*out, token)
+		}
+		tokenCount++
+		text = text[index+length:]
+	}
+	return tokenCount
 }
 
 func (e *GptBytePairEncoding) encodeOrdinaryInternal(text string, maxTokenCount int, keepEncodings bool) *internalResult {
@@ -77,7 +115,16 @@ func (e *GptBytePairEncoding) encodeOrdinaryInternal(text string, maxTokenCount
 
 	out := make([]int, 0)
 	tokenCount := e.encodeOrdinaryInternalToInt(text, maxTokenCount, keepEncodings, &out)
+	return e.newEncodedResult(text, out, tokenCount, maxTokenCount, keepEncodings)
+}
 
+// newEncodedResult wraps the tokens of text. Unless truncating at tokens, trailing tokens of a
+// truncated result are dropped until they decode to a prefix of text ending at a character boundary.
+func (e *GptBytePairEncoding) newEncodedResult(text string, out []int, tokenCount int, maxTokenCount int, keepEncodings bool) *internalResult {
+	if keepEncodings && maxTokenCount != math.MaxInt && e.truncation == TruncateAtToken {
+		decodedLength := len(e.decodeBytes(out))
+		return newInternalResult(out, -1, len(text) > decodedLength, decodedLength-1)
+	}
 	if keepEncodings && maxTokenCount != math.MaxInt {
 		// Make sure we didn't break the multibyte character
 		for tokensToRemove := 0; tokensToRemove <= len(out); tokensToRemove++ {
@@ -86,8 +133,8 @@ func (e *GptBytePairEncoding) encodeOrdinaryInternal(text string, maxTokenCount
 			for i := 0; i < size; i++ {
 				tokens[i] = out[i]
 			}
-			decoded := e.Decode(tokens)
-			if utf8.Valid([]byte(decoded)) && strings.HasPrefix(text, decoded) {
+			decoded := string(e.decodeBytes(tokens))
+			if strings.HasPrefix(text, decoded) && endsAtCharacterBoundary(text, len(decoded)) {
 				// If decoded text is equal to the head of the original text, we can safely return the tokens
 				return newInternalResult(tokens, -1, len(text) > len(decoded), len(decoded)-1)
 			}
@@ -97,25 +144,42 @@ func (e *GptBytePairEncoding) encodeOrdinaryInternal(text string, maxTokenCount
 	return newInternalResult(out, tokenCount, false, len(text)-1)
 }
 
+// encodeScratch holds the buffers reused between encode calls.
+type encodeScratch struct {
+	splitter  parser.Splitter
+	ranks     []int
+	utf8Bytes []byte
+}
+
+var encodeScratchPool = sync.Pool{
+	New: func() any {
+		return &encodeScratch{ranks: make([]int, 0, 10)}
+	},
+}
+
 func (e *GptBytePairEncoding) encodeOrdinaryInternalToInt(text string, maxTokenCount int, keepEncodings bool, out *[]int) int {
+	if !utf8.ValidString(text) {
+		return e.encodeInvalidUtf8ToInt(text, maxTokenCount, keepEncodings, out)
+	}
+
+	scratch := encodeScratchPool.Get().(*encodeScratch)
+	defer encodeScratchPool.Put(scratch)
+
+	tokenCount := 0
 	if e.pattern == nil {
 		// if cl100k
-		tokenCount := []int{0}
-		ranks := make([]int, 0)
-		parser.Split(text, func(utf8BytesList []byte) bool {
-			tokenCount[0] += e.Encoder.AddTokensAndGetCount(maxTokenCount, keepEncodings, utf8BytesList, out, &ranks)
-			return tokenCount[0] >= maxTokenCount
+		scratch.splitter.Split(text, func(utf8BytesList []byte) bool {
+			tokenCount += e.Encoder.AddTokensAndGetCount(maxTokenCount, keepEncodings, utf8BytesList, out, &scratch.ranks)
+			return tokenCount >= maxTokenCount
 		})
-		return tokenCount[0]
+		return tokenCount
 	}
 
-	tokenCount := 0
-	ranks := make([]int, 0, 10)
-
 	match, _ := e.pattern.FindStringMatch(text)
 	for tokenCount < maxTokenCount && match != nil {
-		bytes := []byte(match.Group.String())
-		tokenCount += e.Encoder.AddTokensAndGetCount(maxTokenCount, keepEncodings, bytes, out, &ranks)
+		runes := match.Group.Runes()
+		scratch.utf8Bytes = parser.AddUtf8Bytes(runes, 0, len(runes), scratch.utf8Bytes)
+		tokenCount += e.Encoder.AddTokensAndGetCount(maxTokenCount, keepEncodings, scratch.utf8Bytes, out, &scratch.ranks)
 		match, _ = e.pattern.FindNextMatch(match)
 	}
 	return tokenCount
@@ -126,7 +190,10 @@ func (e *GptBytePairEncoding) EncodeToIntArray(text string) []int {
 }
 
 func (e *GptBytePairEncoding) Encode(text string, maxTokens int) *mod.EncodingResult {
-	return e.encodeInternal(text, maxTokens, true).ToEncodingResult()
+	observation := e.startObservation()
+	result := e.encodeInternal(text, maxTokens, true).ToEncodingResult()
+	e.observeResult(observation, mod.OPERATION_ENCODE, text, result)
+	return result
 }
 
 func (e *GptBytePairEncoding) EncodeOrdinaryToIntArray(text string) []int {
@@ -134,15 +201,59 @@ func (e *GptBytePairEncoding) EncodeOrdinaryToIntArray(text string) []int {
 }
 
 func (e *GptBytePairEncoding) EncodeOrdinary(text string, maxTokens int) *mod.EncodingResult {
-	return e.encodeOrdinaryInternal(text, maxTokens, true).ToEncodingResult()
+	observation := e.startObservation()
+	result := e.encodeOrdinaryInternal(text, maxTokens, true).ToEncodingResult()
+	e.observeResult(observation, mod.OPERATION_ENCODE_ORDINARY, text, result)
+	return result
+}
+
+// AppendEncode appends the tokens of text to dst and returns the extended slice.
+// Unlike EncodeToIntArray it doesn't allocate a result. cl100k_base allocates nothing but the growth
+// of dst, the encodings with a regular expression pattern still allocate its matches.
+func (e *GptBytePairEncoding) AppendEncode(dst []int, text string) []int {
+	if text == "" {
+		return dst
+	}
+
+	observation := e.startObservation()
+	e.observe(observation, mod.OPERATION_ENCODE, len(text), e.encodeInternalToInt(text, math.MaxInt, true, &dst), false)
+	return dst
+}
+
+// AppendEncodeOrdinary appends the tokens of text to dst and returns the extended slice,
+// treating special tokens as ordinary text.
+func (e *GptBytePairEncoding) AppendEncodeOrdinary(dst []int, text string) []int {
+	if text == "" {
+		return dst
+	}
+
+	observation := e.startObservation()
+	e.observe(observation, mod.OPERATION_ENCODE_ORDINARY, len(text), e.encodeOrdinaryInternalToInt(text, math.MaxInt, true, &dst), false)
+	return dst
 }
 
 func (e *GptBytePairEncoding) CountTokens(text string) int {
-	return e.encodeInternal(text, math.MaxInt, false).ToTokenCount()
+	if text == "" {
+		return 0
+	}
+
+	observation := e.startObservation()
+	var out []int
+	count := e.encodeInternalToInt(text, math.MaxInt, false, &out)
+	e.observe(observation, mod.OPERATION_COUNT, len(text), count, false)
+	return count
 }
 
 func (e *GptBytePairEncoding) CountTokensOrdinary(text string) int {
-	return e.encodeOrdinaryInternal(text, math.MaxInt, false).ToTokenCount()
+	if text == "" {
+		return 0
+	}
+
+	observation := e.startObservation()
+	var out []int
+	count := e.encodeOrdinaryInternalToInt(text, math.MaxInt, false, &out)
+	e.observe(observation, mod.OPERATION_COUNT_ORDINARY, len(text), count, false)
+	return count
 }
 
 func (e *GptBytePairEncoding) Decode(tokens []int) string {
@@ -150,6 +261,13 @@ func (e *GptBytePairEncoding) Decode(tokens []int) string {
 }
 
 func (e *GptBytePairEncoding) DecodeBytes(tokens []int) []byte {
+	observation := e.startObservation()
+	out := e.decodeBytes(tokens)
+	e.observe(observation, mod.OPERATION_DECODE, len(out), len(tokens), false)
+	return out
+}
+
+func (e *GptBytePairEncoding) decodeBytes(tokens []int) []byte {
 	out := make([]byte, 0, 10*len(tokens))
 	for i := 0; i < len(tokens); i++ {
 		decodedToken := e.Encoder.DecodeToken(tokens[i], e.specialEncoder)
@@ -158,6 +276,37 @@ func (e *GptBytePairEncoding) DecodeBytes(tokens []int) []byte {
 	return out
 }
 
+// AllowSpecial returns e with the SpecialTokensAllowed policy, everything else is shared with e.
+func (e *GptBytePairEncoding) AllowSpecial() mod.Encoding {
+	if e.specialTokenPolicy == SpecialTokensAllowed {
+		return e
+	}
+	allowed := *e
+	allowed.specialTokenPolicy = SpecialTokensAllowed
+	return &allowed
+}
+
+// SetPieceCache attaches a cache for the tokens of repeated pieces, nil disables caching.
+// It must be called before the encoding is used concurrently.
+func (e *GptBytePairEncoding) SetPieceCache(cache *encoder.PieceCache) {
+	e.Encoder.PieceCache = cache
+}
+
+// GetPieceCache returns the attached piece cache or nil.
+func (e *GptBytePairEncoding) GetPieceCache() *encoder.PieceCache {
+	return e.Encoder.PieceCache
+}
+
+// SpecialTokenID returns the id of a special token of the encoding, regardless of the special token policy.
+func (e *GptBytePairEncoding) SpecialTokenID(specialToken string) (int, bool) {
+	return e.specialEncoder.Encode(specialToken)
+}
+
+// HasToken reports whether token is the id of a regular or a special token of the encoding.
+func (e *GptBytePairEncoding) HasToken(token int) bool {
+	return e.Encoder.HasToken(token) || e.specialEncoder.DecodeIfPresent(token) != nil
+}
+
 func (e *GptBytePairEncoding) GetName() string {
 	return e.name
 }
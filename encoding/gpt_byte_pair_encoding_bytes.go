@@ -0,0 +1,89 @@
+package encoding
+
+import (
+	"math"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// ValidUtf8PrefixLength returns the length of the longest prefix of text that is valid UTF-8.
+func ValidUtf8PrefixLength(text string) int {
+	for i := 0; i < len(text); {
+		if text[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return len(text)
+}
+
+// endsAtCharacterBoundary reports whether text can be cut after n bytes without splitting a valid
+// multibyte character. Bytes which are not part of a valid sequence are characters of their own.
+func endsAtCharacterBoundary(text string, n int) bool {
+	if n >= len(text) || utf8.RuneStart(text[n]) {
+		return true
+	}
+	for start := n - 1; start >= 0 && start > n-utf8.UTFMax; start-- {
+		if utf8.RuneStart(text[start]) {
+			r, size := utf8.DecodeRuneInString(text[start:])
+			return (r == utf8.RuneError && size == 1) || start+size <= n
+		}
+	}
+	return true
+}
+
+// encodeInvalidUtf8ToInt encodes the valid UTF-8 runs of text as usual and every byte
+// which is not part of a valid sequence as a piece of its own.
+func (e *GptBytePairEncoding) encodeInvalidUtf8ToInt(text string, maxTokenCount int, keepEncodings bool, out *[]int) int {
+	tokenCount := 0
+	ranks := make([]int, 0)
+	for text != "" && tokenCount < maxTokenCount {
+		valid := ValidUtf8PrefixLength(text)
+		if valid > 0 {
+			tokenCount += e.encodeOrdinaryInternalToInt(text[:valid], maxTokenCount, keepEncodings, out)
+			text = text[valid:]
+			continue
+		}
+		tokenCount += e.Encoder.AddTokensAndGetCount(maxTokenCount, keepEncodings, []byte(text[:1]), out, &ranks)
+		text = text[1:]
+	}
+	return tokenCount
+}
+
+// bytesToString reinterprets data as a string without copying it, the string must not outlive the call.
+func bytesToString(data []byte) string {
+	return unsafe.String(unsafe.SliceData(data), len(data))
+}
+
+// stringToBytes reinterprets text as bytes without copying it, the bytes must not be modified.
+func stringToBytes(text string) []byte {
+	return unsafe.Slice(unsafe.StringData(text), len(text))
+}
+
+// EncodeBytes encodes arbitrary bytes, treating special tokens as ordinary text.
+// Bytes that are not part of valid UTF-8 sequences are encoded as pieces of their own,
+// so DecodeBytes always returns data byte for byte. data is not copied and must not be
+// modified during the call.
+func (e *GptBytePairEncoding) EncodeBytes(data []byte) []int {
+	return e.AppendEncodeOrdinary(make([]int, 0), bytesToString(data))
+}
+
+// CountTokensBytes returns the number of tokens EncodeBytes would return.
+func (e *GptBytePairEncoding) CountTokensBytes(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+
+	observation := e.startObservation()
+	var out []int
+	count := e.encodeOrdinaryInternalToInt(bytesToString(data), math.MaxInt, false, &out)
+	e.observe(observation, mod.OPERATION_COUNT_ORDINARY, len(data), count, false)
+	return count
+}
@@ -0,0 +1,105 @@
+package encoding
+
+import (
+	"context"
+	"math"
+
+	"github.com/currybab/tokgo/mod"
+	"github.com/currybab/tokgo/parser"
+)
+
+// encodeContextInternal encodes the pieces of text one by one and checks ctx before every piece and
+// while merging large pieces. On cancellation it returns the tokens of the completed pieces with ctx.Err().
+func (e *GptBytePairEncoding) encodeContextInternal(ctx context.Context, text string, maxTokenCount int, keepEncodings bool, ordinary bool) (*internalResult, error) {
+	if err := ctx.Err(); err != nil {
+		return newInternalResult([]int{}, 0, text != "", -1), err
+	}
+	if text == "" {
+		return newInternalResult([]int{}, -1, false, -1), nil
+	}
+	if !ordinary && e.specialTokenPolicy == SpecialTokensDisallowed {
+		e.specialEncoder.CheckForSpecialTokens(text)
+	}
+
+	done := ctx.Done()
+	out := make([]int, 0)
+	var ranks []int
+	var err error
+	tokenCount := 0
+	processed := 0
+	encodePiece := func(piece parser.Piece) bool {
+		if done != nil {
+			select {
+			case <-done:
+				err = ctx.Err()
+				return false
+			default:
+			}
+		}
+		if piece.Kind == parser.PieceSpecialToken {
+			token, _ := e.specialEncoder.Encode(piece.Text)
+			if keepEncodings {
+				out = append(out, token)
+			}
+			tokenCount++
+		} else {
+			count, pieceErr := e.Encoder.AddTokensAndGetCountContext(ctx, maxTokenCount, keepEncodings, stringToBytes(piece.Text), &out, &ranks)
+			if pieceErr != nil {
+				err = pieceErr
+				return false
+			}
+			tokenCount += count
+		}
+		processed = piece.End
+		return tokenCount < maxTokenCount
+	}
+	if ordinary {
+		e.ordinaryPieces(text, 0, encodePiece)
+	} else {
+		e.Pieces(text)(encodePiece)
+	}
+
+	if err != nil {
+		return newInternalResult(out, tokenCount, true, processed-1), err
+	}
+	if len(out) > maxTokenCount {
+		out = out[:maxTokenCount]
+	}
+	return e.newEncodedResult(text, out, tokenCount, maxTokenCount, keepEncodings), nil
+}
+
+// EncodeContext is the same as Encode, but gives up once ctx is done. It then returns ctx.Err() with the
+// tokens of the text up to the last completely encoded piece, see mod.ContextEncoding.
+func (e *GptBytePairEncoding) EncodeContext(ctx context.Context, text string, maxTokens int) (*mod.EncodingResult, error) {
+	observation := e.startObservation()
+	internal, err := e.encodeContextInternal(ctx, text, maxTokens, true, false)
+	result := internal.ToEncodingResult()
+	e.observeResult(observation, mod.OPERATION_ENCODE, text, result)
+	return result, err
+}
+
+// EncodeOrdinaryContext is the same as EncodeOrdinary, but gives up once ctx is done like EncodeContext.
+func (e *GptBytePairEncoding) EncodeOrdinaryContext(ctx context.Context, text string, maxTokens int) (*mod.EncodingResult, error) {
+	observation := e.startObservation()
+	internal, err := e.encodeContextInternal(ctx, text, maxTokens, true, true)
+	result := internal.ToEncodingResult()
+	e.observeResult(observation, mod.OPERATION_ENCODE_ORDINARY, text, result)
+	return result, err
+}
+
+// CountTokensContext is the same as CountTokens, but gives up once ctx is done. It then returns ctx.Err()
+// with the number of tokens of the completely encoded pieces.
+func (e *GptBytePairEncoding) CountTokensContext(ctx context.Context, text string) (int, error) {
+	observation := e.startObservation()
+	internal, err := e.encodeContextInternal(ctx, text, math.MaxInt, false, false)
+	e.observe(observation, mod.OPERATION_COUNT, len(text), internal.ToTokenCount(), err != nil)
+	return internal.ToTokenCount(), err
+}
+
+// CountTokensOrdinaryContext is the same as CountTokensOrdinary, but gives up once ctx is done like CountTokensContext.
+func (e *GptBytePairEncoding) CountTokensOrdinaryContext(ctx context.Context, text string) (int, error) {
+	observation := e.startObservation()
+	internal, err := e.encodeContextInternal(ctx, text, math.MaxInt, false, true)
+	e.observe(observation, mod.OPERATION_COUNT_ORDINARY, len(text), internal.ToTokenCount(), err != nil)
+	return internal.ToTokenCount(), err
+}
@@ -0,0 +1,65 @@
+package encoding
+
+import (
+	"time"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// observation is the state at the start of an observed operation, zero if there is no observer.
+type observation struct {
+	start       time.Time
+	cacheHits   int64
+	cacheMisses int64
+}
+
+// SetObserver attaches an observer to the encoding, nil or a mod.NopObserver detaches it.
+// It must be called before the encoding is used concurrently.
+func (e *GptBytePairEncoding) SetObserver(observer mod.Observer) {
+	if _, ok := observer.(mod.NopObserver); ok {
+		observer = nil
+	}
+	e.observer = observer
+}
+
+// GetObserver returns the attached observer or nil.
+func (e *GptBytePairEncoding) GetObserver() mod.Observer {
+	return e.observer
+}
+
+func (e *GptBytePairEncoding) startObservation() observation {
+	if e.observer == nil {
+		return observation{}
+	}
+	o := observation{start: time.Now()}
+	if cache := e.Encoder.PieceCache; cache != nil {
+		o.cacheHits, o.cacheMisses = cache.Lookups()
+	}
+	return o
+}
+
+func (e *GptBytePairEncoding) observeResult(o observation, operation mod.Operation, text string, result *mod.EncodingResult) {
+	if e.observer == nil {
+		return
+	}
+	e.observe(o, operation, len(text), len(result.GetTokens()), result.IsTruncated())
+}
+
+func (e *GptBytePairEncoding) observe(o observation, operation mod.Operation, inputBytes int, tokens int, truncated bool) {
+	if e.observer == nil {
+		return
+	}
+	event := mod.Event{
+		Encoding:   e.name,
+		Operation:  operation,
+		InputBytes: inputBytes,
+		Tokens:     tokens,
+		Duration:   time.Since(o.start),
+		Truncated:  truncated,
+	}
+	if cache := e.Encoder.PieceCache; cache != nil {
+		hits, misses := cache.Lookups()
+		event.CacheHits, event.CacheMisses = hits-o.cacheHits, misses-o.cacheMisses
+	}
+	e.observer.Observe(event)
+}
@@ -0,0 +1,137 @@
+package encoding
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// minParallelSegmentBytes is the smallest segment handed to a single goroutine,
+// smaller inputs are not worth the scheduling overhead.
+const minParallelSegmentBytes = 64 * 1024
+
+// splitParallelSegments cuts text into segments that can be encoded independently at the positions
+// of NextLineEndCut, which only keeps the pieces of the whole text if CutsAtLineEnds holds for the pattern.
+func splitParallelSegments(text string, parallelism int) []string {
+	segmentSize := max(len(text)/(4*parallelism), minParallelSegmentBytes)
+	segments := make([]string, 0, len(text)/segmentSize+1)
+	for len(text) > segmentSize {
+		cut := NextLineEndCut(text, segmentSize)
+		if cut < 0 {
+			break
+		}
+		segments = append(segments, text[:cut])
+		text = text[cut:]
+	}
+	return append(segments, text)
+}
+
+// segmentEncoder is the signature of encodeOrdinaryInternalToInt and encodeWithSpecialTokensToInt.
+type segmentEncoder func(text string, maxTokenCount int, keepEncodings bool, out *[]int) int
+
+func (e *GptBytePairEncoding) encodeParallelInternal(text string, maxTokenCount int, keepEncodings bool, parallelism int) *internalResult {
+	cuts := CutsAtLineEnds(e.pattern)
+	switch e.specialTokenPolicy {
+	case SpecialTokensAllowed:
+		// a cut could split a special token with a line break, as Derive allows them
+		cuts = cuts && !e.specialEncoder.HasTokenContainingAny("\r\n")
+		return e.encodeSegmentsParallel(text, maxTokenCount, keepEncodings, parallelism, cuts, e.encodeWithSpecialTokensToInt)
+	case SpecialTokensDisallowed:
+		e.specialEncoder.CheckForSpecialTokens(text)
+	}
+	return e.encodeSegmentsParallel(text, maxTokenCount, keepEncodings, parallelism, cuts, e.encodeOrdinaryInternalToInt)
+}
+
+func (e *GptBytePairEncoding) encodeOrdinaryParallelInternal(text string, maxTokenCount int, keepEncodings bool, parallelism int) *internalResult {
+	return e.encodeSegmentsParallel(text, maxTokenCount, keepEncodings, parallelism, CutsAtLineEnds(e.pattern), e.encodeOrdinaryInternalToInt)
+}
+
+// encodeSegmentsParallel encodes the segments of text concurrently, or text as a whole if it can't be cut.
+func (e *GptBytePairEncoding) encodeSegmentsParallel(text string, maxTokenCount int, keepEncodings bool, parallelism int, cuts bool, encodeSegment segmentEncoder) *internalResult {
+	if text == "" {
+		return newInternalResult([]int{}, -1, false, -1)
+	}
+
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	segments := []string{text}
+	if parallelism > 1 && cuts {
+		segments = splitParallelSegments(text, parallelism)
+	}
+
+	// Segments are encoded in batches of parallelism so that a small maxTokenCount
+	// does not pay for encoding the whole text.
+	out := make([]int, 0)
+	tokenCount := 0
+	batchTokens := make([][]int, parallelism)
+	batchCounts := make([]int, parallelism)
+	for first := 0; first < len(segments) && tokenCount < maxTokenCount; first += parallelism {
+		batch := segments[first:min(first+parallelism, len(segments))]
+
+		var wg sync.WaitGroup
+		for i, segment := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tokens := make([]int, 0)
+				batchCounts[i] = encodeSegment(segment, maxTokenCount, keepEncodings, &tokens)
+				batchTokens[i] = tokens
+			}()
+		}
+		wg.Wait()
+
+		for i := range batch {
+			if tokenCount >= maxTokenCount {
+				break
+			}
+			tokenCount += batchCounts[i]
+			out = append(out, batchTokens[i]...)
+		}
+	}
+	if len(out) > maxTokenCount {
+		out = out[:maxTokenCount]
+	}
+
+	return e.newEncodedResult(text, out, tokenCount, maxTokenCount, keepEncodings)
+}
+
+// EncodeParallel is the same as Encode, but encodes independent segments of a large text concurrently
+// on up to parallelism goroutines. A parallelism <= 0 means runtime.GOMAXPROCS(0).
+// Texts are only cut into segments if CutsAtLineEnds holds for the pattern and no special token
+// contains a line break, otherwise they are encoded sequentially.
+func (e *GptBytePairEncoding) EncodeParallel(text string, maxTokens int, parallelism int) *mod.EncodingResult {
+	observation := e.startObservation()
+	result := e.encodeParallelInternal(text, maxTokens, true, parallelism).ToEncodingResult()
+	e.observeResult(observation, mod.OPERATION_ENCODE, text, result)
+	return result
+}
+
+// EncodeOrdinaryParallel is the same as EncodeOrdinary, but encodes independent segments of a large text
+// concurrently on up to parallelism goroutines. A parallelism <= 0 means runtime.GOMAXPROCS(0).
+func (e *GptBytePairEncoding) EncodeOrdinaryParallel(text string, maxTokens int, parallelism int) *mod.EncodingResult {
+	observation := e.startObservation()
+	result := e.encodeOrdinaryParallelInternal(text, maxTokens, true, parallelism).ToEncodingResult()
+	e.observeResult(observation, mod.OPERATION_ENCODE_ORDINARY, text, result)
+	return result
+}
+
+// CountTokensParallel is the same as CountTokens, but counts independent segments of a large text
+// concurrently on up to parallelism goroutines. A parallelism <= 0 means runtime.GOMAXPROCS(0).
+func (e *GptBytePairEncoding) CountTokensParallel(text string, parallelism int) int {
+	observation := e.startObservation()
+	count := e.encodeParallelInternal(text, math.MaxInt, false, parallelism).ToTokenCount()
+	e.observe(observation, mod.OPERATION_COUNT, len(text), count, false)
+	return count
+}
+
+// CountTokensOrdinaryParallel is the same as CountTokensOrdinary, but counts independent segments of
+// a large text concurrently on up to parallelism goroutines. A parallelism <= 0 means runtime.GOMAXPROCS(0).
+func (e *GptBytePairEncoding) CountTokensOrdinaryParallel(text string, parallelism int) int {
+	observation := e.startObservation()
+	count := e.encodeOrdinaryParallelInternal(text, math.MaxInt, false, parallelism).ToTokenCount()
+	e.observe(observation, mod.OPERATION_COUNT_ORDINARY, len(text), count, false)
+	return count
+}
@@ -0,0 +1,96 @@
+package encoding
+
+import (
+	"iter"
+	"unicode/utf8"
+
+	"github.com/currybab/tokgo/parser"
+)
+
+// Pieces returns the pre-tokenization pieces of text in order, each with its byte span and
+// the rule that produced it. Every piece is merged into tokens independently, so they
+// explain how the token count of a text comes about.
+// Special tokens are yielded as pieces of their own when the encoding allows them
+// and are split like ordinary text otherwise. Bytes that aren't valid UTF-8 are yielded one by one.
+func (e *GptBytePairEncoding) Pieces(text string) iter.Seq[parser.Piece] {
+	return func(yield func(parser.Piece) bool) {
+		if e.specialTokenPolicy != SpecialTokensAllowed {
+			e.ordinaryPieces(text, 0, yield)
+			return
+		}
+
+		offset := 0
+		for text != "" {
+			index, _, length := e.specialEncoder.FindNext(text)
+			if index < 0 {
+				e.ordinaryPieces(text, offset, yield)
+				return
+			}
+			if index > 0 && !e.ordinaryPieces(text[:index], offset, yield) {
+				return
+			}
+			end := index + length
+			if !yield(parser.Piece{Text: text[index:end], Start: offset + index, End: offset + end, Kind: parser.PieceSpecialToken}) {
+				return
+			}
+			offset += end
+			text = text[end:]
+		}
+	}
+}
+
+// ordinaryPieces yields the pieces of text, whose first byte is at offset in the whole text.
+// It returns false if yield asked to stop.
+func (e *GptBytePairEncoding) ordinaryPieces(text string, offset int, yield func(parser.Piece) bool) bool {
+	if !utf8.ValidString(text) {
+		for text != "" {
+			valid := ValidUtf8PrefixLength(text)
+			if valid == 0 {
+				if !yield(parser.Piece{Text: text[:1], Start: offset, End: offset + 1, Kind: parser.PieceInvalidByte}) {
+					return false
+				}
+				valid = 1
+			} else if !e.ordinaryPieces(text[:valid], offset, yield) {
+				return false
+			}
+			offset += valid
+			text = text[valid:]
+		}
+		return true
+	}
+
+	if e.pattern == nil {
+		// if cl100k
+		stopped := false
+		start := 0
+		var splitter parser.Splitter
+		splitter.SplitPieces(text, func(piece []byte, kind parser.PieceKind) bool {
+			end := start + len(piece)
+			stopped = !yield(parser.Piece{Text: text[start:end], Start: offset + start, End: offset + end, Kind: kind})
+			start = end
+			return stopped
+		})
+		return !stopped
+	}
+
+	// the pattern reports rune indexes, translate them to byte offsets while walking forward
+	runeIndex, byteIndex := 0, 0
+	match, _ := e.pattern.FindStringMatch(text)
+	for match != nil {
+		for ; runeIndex < match.Index; runeIndex++ {
+			_, size := utf8.DecodeRuneInString(text[byteIndex:])
+			byteIndex += size
+		}
+		start := byteIndex
+		for ; runeIndex < match.Index+match.Length; runeIndex++ {
+			_, size := utf8.DecodeRuneInString(text[byteIndex:])
+			byteIndex += size
+		}
+		piece := text[start:byteIndex]
+		if !yield(parser.Piece{Text: piece, Start: offset + start, End: offset + byteIndex, Kind: parser.ClassifyPiece(piece)}) {
+			return false
+		}
+		match, _ = e.pattern.FindNextMatch(match)
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package encoding
+
+import (
+	"github.com/currybab/tokgo/encoder"
+	"github.com/currybab/tokgo/mod"
+)
+
+// SpecialTokenPolicy decides how Encode, CountTokens and their variants treat special tokens in the text.
+// The Ordinary variants always treat them as text.
+type SpecialTokenPolicy int
+
+const (
+	// SpecialTokensDisallowed panics if the text contains a special token, this is the default.
+	SpecialTokensDisallowed SpecialTokenPolicy = iota
+	// SpecialTokensAsText encodes special tokens like any other text.
+	SpecialTokensAsText
+	// SpecialTokensAllowed encodes special tokens to their ids.
+	SpecialTokensAllowed
+)
+
+// TruncationMode decides how a result is cut when it has more than maxTokens tokens.
+type TruncationMode int
+
+const (
+	// TruncateAtCharacter drops trailing tokens until the tokens decode to a valid UTF-8 prefix of the text,
+	// so the result may have fewer than maxTokens tokens. This is the default.
+	TruncateAtCharacter TruncationMode = iota
+	// TruncateAtToken keeps exactly maxTokens tokens, even if the last one ends inside a multibyte character.
+	TruncateAtToken
+)
+
+type options struct {
+	largePieceThreshold    int
+	hasLargePieceThreshold bool
+	pieceCacheEntries      int
+	pieceCacheBytes        int
+	specialTokenPolicy     SpecialTokenPolicy
+	truncation             TruncationMode
+	observer               mod.Observer
+}
+
+// Option configures an encoding created by NewGptBytePairEncoding, the built-in constructors or a registry.
+type Option func(*options)
+
+// WithLargePieceThreshold sets the piece length in bytes from which the heap based merge is used.
+// Without it the VERY_LARGE_TOKENIZER_BYTE_THRESHOLD environment variable is used as a fallback.
+func WithLargePieceThreshold(threshold int) Option {
+	return func(o *options) {
+		o.largePieceThreshold = threshold
+		o.hasLargePieceThreshold = true
+	}
+}
+
+// WithPieceCache attaches a new encoder.PieceCache of at most maxEntries pieces of at most maxPieceBytes
+// to every encoding built with this option. The caches are never shared between encodings.
+func WithPieceCache(maxEntries int, maxPieceBytes int) Option {
+	return func(o *options) {
+		o.pieceCacheEntries = maxEntries
+		o.pieceCacheBytes = maxPieceBytes
+	}
+}
+
+// WithSpecialTokenPolicy sets how special tokens in the text are treated.
+func WithSpecialTokenPolicy(policy SpecialTokenPolicy) Option {
+	return func(o *options) {
+		o.specialTokenPolicy = policy
+	}
+}
+
+// WithTruncation sets how results exceeding maxTokens are cut.
+func WithTruncation(mode TruncationMode) Option {
+	return func(o *options) {
+		o.truncation = mode
+	}
+}
+
+// WithObserver attaches an observer that receives an event after every encode, count and decode
+// of the encodings built with this option. Without it operations aren't measured at all.
+func WithObserver(observer mod.Observer) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) apply(e *GptBytePairEncoding) {
+	if o.hasLargePieceThreshold {
+		e.Encoder.VERY_LARGE_TOKENIZER_BYTE_THRESHOLD = o.largePieceThreshold
+	}
+	if o.pieceCacheEntries > 0 {
+		e.Encoder.PieceCache = encoder.NewPieceCache(o.pieceCacheEntries, o.pieceCacheBytes)
+	}
+	e.specialTokenPolicy = o.specialTokenPolicy
+	e.truncation = o.truncation
+	e.SetObserver(o.observer)
+}
@@ -0,0 +1,408 @@
+// Package finetune validates chat fine-tuning datasets in the JSONL format of the OpenAI
+// fine-tuning API and estimates their token counts before an upload.
+package finetune
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/currybab/tokgo/chat"
+	"github.com/currybab/tokgo/mod"
+)
+
+// Limits of the default number of epochs the fine-tuning API chooses for a dataset.
+const (
+	DEFAULT_EPOCHS      = 3
+	MIN_DEFAULT_EPOCHS  = 1
+	MAX_DEFAULT_EPOCHS  = 25
+	MIN_TARGET_EXAMPLES = 100
+	MAX_TARGET_EXAMPLES = 25000
+)
+
+// maxLineBytes is the longest example that can be read.
+const maxLineBytes = 64 * 1024 * 1024
+
+// Kinds of the issues found in examples.
+const (
+	InvalidJSON                    = "invalid_json"
+	DataType                       = "data_type"
+	MissingMessagesList            = "missing_messages_list"
+	MessageMissingKey              = "message_missing_key"
+	MessageUnrecognizedKey         = "message_unrecognized_key"
+	UnrecognizedRole               = "unrecognized_role"
+	MissingContent                 = "missing_content"
+	InvalidWeight                  = "invalid_weight"
+	InvalidToolCalls               = "invalid_tool_calls"
+	InvalidTools                   = "invalid_tools"
+	ExampleMissingAssistantMessage = "example_missing_assistant_message"
+)
+
+var roles = []string{"system", "developer", "user", "assistant", "tool", "function"}
+
+var messageKeys = []string{"role", "content", "name", "weight", "function_call", "tool_calls", "tool_call_id", "refusal"}
+
+// Issue is a problem of the example at a line, such examples are left out of the statistics.
+type Issue struct {
+	Line    int    `json:"line"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Distribution summarizes a value over the valid examples.
+type Distribution struct {
+	Min    int     `json:"min"`
+	Max    int     `json:"max"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P5     float64 `json:"p5"`
+	P95    float64 `json:"p95"`
+}
+
+// Options configures Check.
+type Options struct {
+	// Epochs is the number of training epochs, chosen from the number of examples like the API does if zero.
+	Epochs int
+}
+
+// Report is the result of Check.
+type Report struct {
+	Model         string  `json:"model"`
+	Encoding      string  `json:"encoding"`
+	ContextLength int     `json:"context_length"`
+	Examples      int     `json:"examples"`
+	ValidExamples int     `json:"valid_examples"`
+	Issues        []Issue `json:"issues"`
+	// MissingSystem and MissingUser count the valid examples without a system or a user message.
+	MissingSystem int `json:"missing_system"`
+	MissingUser   int `json:"missing_user"`
+	// Messages, Tokens and AssistantTokens are distributed per valid example. AssistantTokens are
+	// the content tokens of the assistant messages that are trained on.
+	Messages        Distribution `json:"messages"`
+	Tokens          Distribution `json:"tokens"`
+	AssistantTokens Distribution `json:"assistant_tokens"`
+	// OverContextLength are the lines of the examples with more tokens than the context length of the model,
+	// they are truncated when training.
+	OverContextLength []int `json:"over_context_length"`
+	// EpochTokens are the tokens of the valid examples, each truncated to the context length.
+	EpochTokens  int `json:"epoch_tokens"`
+	Epochs       int `json:"epochs"`
+	BilledTokens int `json:"billed_tokens"`
+}
+
+// IssueCounts returns the number of issues of each kind.
+func (r *Report) IssueCounts() map[string]int {
+	counts := map[string]int{}
+	for _, issue := range r.Issues {
+		counts[issue.Kind]++
+	}
+	return counts
+}
+
+// Check reads the examples of r, one JSON object per line, validates their structure and
+// counts their tokens with the encoding of model, see chat.CountRequest. Examples with issues
+// are reported and skipped, an error is only returned if r can't be read.
+func Check(r io.Reader, encoding mod.Encoding, model mod.ModelType, options Options) (*Report, error) {
+	report := &Report{
+		Model:             model.GetName(),
+		Encoding:          encoding.GetName(),
+		ContextLength:     model.GetMaxContextLength(),
+		Issues:            []Issue{},
+		OverContextLength: []int{},
+	}
+	var messages, tokens, assistantTokens []int
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		report.Examples++
+		example, issues := parseExample(scanner.Bytes())
+		if len(issues) > 0 {
+			for _, issue := range issues {
+				issue.Line = line
+				report.Issues = append(report.Issues, issue)
+			}
+			continue
+		}
+		// examples have neither images nor a response format, so only their tools can fail to count
+		count, err := chat.CountRequest(encoding, &example.request)
+		if err != nil {
+			report.Issues = append(report.Issues, Issue{Line: line, Kind: InvalidTools, Message: err.Error()})
+			continue
+		}
+		report.ValidExamples++
+
+		assistantCount := 0
+		hasSystem, hasUser := false, false
+		for i, message := range example.request.Messages {
+			switch message.Role {
+			case "system", "developer":
+				hasSystem = true
+			case "user":
+				hasUser = true
+			case "assistant":
+				if example.trained[i] {
+					assistantCount += encoding.CountTokensOrdinary(message.Content)
+					for _, call := range message.ToolCalls {
+						assistantCount += encoding.CountTokensOrdinary(call.Function.Name) + encoding.CountTokensOrdinary(call.Function.Arguments)
+					}
+				}
+			}
+		}
+		if !hasSystem {
+			report.MissingSystem++
+		}
+		if !hasUser {
+			report.MissingUser++
+		}
+		if count > report.ContextLength {
+			report.OverContextLength = append(report.OverContextLength, line)
+		}
+		report.EpochTokens += min(count, report.ContextLength)
+		messages = append(messages, len(example.request.Messages))
+		tokens = append(tokens, count)
+		assistantTokens = append(assistantTokens, assistantCount)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Messages = distribution(messages)
+	report.Tokens = distribution(tokens)
+	report.AssistantTokens = distribution(assistantTokens)
+	report.Epochs = options.Epochs
+	if report.Epochs <= 0 {
+		report.Epochs = DefaultEpochs(report.ValidExamples)
+	}
+	report.BilledTokens = report.Epochs * report.EpochTokens
+	return report, nil
+}
+
+// DefaultEpochs returns the number of epochs the fine-tuning API trains a dataset of examples for
+// unless told otherwise: DEFAULT_EPOCHS, raised for small and lowered for large datasets so that
+// between MIN_TARGET_EXAMPLES and MAX_TARGET_EXAMPLES examples are trained on.
+func DefaultEpochs(examples int) int {
+	switch {
+	case examples == 0:
+		return DEFAULT_EPOCHS
+	case examples*DEFAULT_EPOCHS < MIN_TARGET_EXAMPLES:
+		return min(MAX_DEFAULT_EPOCHS, MIN_TARGET_EXAMPLES/examples)
+	case examples*DEFAULT_EPOCHS > MAX_TARGET_EXAMPLES:
+		return max(MIN_DEFAULT_EPOCHS, MAX_TARGET_EXAMPLES/examples)
+	default:
+		return DEFAULT_EPOCHS
+	}
+}
+
+type example struct {
+	request chat.Request
+	// trained flags the messages with a weight other than 0
+	trained []bool
+}
+
+// parseExample converts a line to the request that is counted, or returns its issues.
+func parseExample(line []byte) (*example, []Issue) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(line, &object); err != nil {
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			return nil, []Issue{{Kind: InvalidJSON, Message: err.Error()}}
+		}
+		return nil, []Issue{{Kind: DataType, Message: "example is not a JSON object"}}
+	}
+	var rawMessages []map[string]json.RawMessage
+	if err := json.Unmarshal(object["messages"], &rawMessages); err != nil || len(rawMessages) == 0 {
+		return nil, []Issue{{Kind: MissingMessagesList, Message: "example has no messages list"}}
+	}
+
+	var issues []Issue
+	result := &example{}
+	hasAssistant := false
+	for i, raw := range rawMessages {
+		issue := func(kind string, format string, args ...any) {
+			issues = append(issues, Issue{Kind: kind, Message: fmt.Sprintf("message %d: ", i+1) + fmt.Sprintf(format, args...)})
+		}
+		message := chat.Message{}
+		for key := range raw {
+			if !slices.Contains(messageKeys, key) {
+				issue(MessageUnrecognizedKey, "unrecognized key %q", key)
+			}
+		}
+		if err := json.Unmarshal(raw["role"], &message.Role); err != nil || message.Role == "" {
+			issue(MessageMissingKey, "missing role")
+		} else if !slices.Contains(roles, message.Role) {
+			issue(UnrecognizedRole, "unrecognized role %q", message.Role)
+		}
+		if name, ok := raw["name"]; ok {
+			json.Unmarshal(name, &message.Name)
+		}
+
+		content, ok := raw["content"]
+		_, hasToolCalls := raw["tool_calls"]
+		_, hasFunctionCall := raw["function_call"]
+		switch {
+		case !ok && !hasToolCalls && !hasFunctionCall:
+			issue(MessageMissingKey, "missing content")
+		case ok:
+			text, valid := contentText(content, hasToolCalls || hasFunctionCall)
+			if !valid {
+				issue(MissingContent, "content is neither text nor a list of text parts")
+			}
+			message.Content = text
+		}
+		if hasToolCalls {
+			if err := json.Unmarshal(raw["tool_calls"], &message.ToolCalls); err != nil {
+				issue(InvalidToolCalls, "tool_calls: %v", err)
+			}
+		}
+		if hasFunctionCall {
+			var call chat.FunctionCall
+			if err := json.Unmarshal(raw["function_call"], &call); err != nil {
+				issue(InvalidToolCalls, "function_call: %v", err)
+			}
+			message.ToolCalls = append(message.ToolCalls, chat.ToolCall{Type: "function", Function: call})
+		}
+
+		trained := message.Role == "assistant"
+		if weight, ok := raw["weight"]; ok {
+			var value int
+			if err := json.Unmarshal(weight, &value); err != nil || (value != 0 && value != 1) {
+				issue(InvalidWeight, "weight must be 0 or 1")
+			}
+			trained = trained && value == 1
+		}
+		hasAssistant = hasAssistant || message.Role == "assistant"
+		result.request.Messages = append(result.request.Messages, message)
+		result.trained = append(result.trained, trained)
+	}
+	if !hasAssistant {
+		issues = append(issues, Issue{Kind: ExampleMissingAssistantMessage, Message: "example has no assistant message"})
+	}
+
+	if err := unmarshalOptional(object["tools"], &result.request.Tools); err != nil {
+		issues = append(issues, Issue{Kind: InvalidTools, Message: "tools: " + err.Error()})
+	} else if err := unmarshalOptional(object["functions"], &result.request.Functions); err != nil {
+		issues = append(issues, Issue{Kind: InvalidTools, Message: "functions: " + err.Error()})
+	}
+	if len(issues) > 0 {
+		return nil, issues
+	}
+	return result, nil
+}
+
+// unmarshalOptional decodes value into v unless the field is missing.
+func unmarshalOptional(value json.RawMessage, v any) error {
+	if value == nil {
+		return nil
+	}
+	return json.Unmarshal(value, v)
+}
+
+// contentText returns the text of a content, which is a string, a list of text parts or null
+// if the message has calls instead.
+func contentText(content json.RawMessage, nullable bool) (string, bool) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		if string(bytes.TrimSpace(content)) == "null" {
+			return "", nullable
+		}
+		return text, true
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil || len(parts) == 0 {
+		return "", false
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", false
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, ""), true
+}
+
+// distribution summarizes values, with quantiles interpolated linearly between the closest ranks.
+func distribution(values []int) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	sum := 0
+	for _, value := range sorted {
+		sum += value
+	}
+	return Distribution{
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Mean:   float64(sum) / float64(len(sorted)),
+		Median: quantile(sorted, 0.5),
+		P5:     quantile(sorted, 0.05),
+		P95:    quantile(sorted, 0.95),
+	}
+}
+
+func quantile(sorted []int, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := min(lower+1, len(sorted)-1)
+	fraction := position - float64(lower)
+	return float64(sorted[lower]) + fraction*float64(sorted[upper]-sorted[lower])
+}
+
+// WriteText writes the report as text.
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "model %s (%s, context length %d)\n", r.Model, r.Encoding, r.ContextLength)
+	fmt.Fprintf(w, "%d examples, %d valid\n", r.Examples, r.ValidExamples)
+	if len(r.Issues) > 0 {
+		fmt.Fprintln(w, "\nissues:")
+		for _, issue := range r.Issues {
+			fmt.Fprintf(w, "  line %d: %s: %s\n", issue.Line, issue.Kind, issue.Message)
+		}
+	}
+	if r.ValidExamples == 0 {
+		return nil
+	}
+	if r.MissingSystem > 0 || r.MissingUser > 0 {
+		fmt.Fprintf(w, "\n%d examples without a system message, %d without a user message\n", r.MissingSystem, r.MissingUser)
+	}
+
+	fmt.Fprintln(w)
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "per example\tmin\tp5\tmedian\tmean\tp95\tmax\t")
+	for _, row := range []struct {
+		name         string
+		distribution Distribution
+	}{
+		{"messages", r.Messages},
+		{"tokens", r.Tokens},
+		{"assistant tokens", r.AssistantTokens},
+	} {
+		d := row.distribution
+		fmt.Fprintf(table, "%s\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%d\t\n", row.name, d.Min, d.P5, d.Median, d.Mean, d.P95, d.Max)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.OverContextLength) > 0 {
+		fmt.Fprintf(w, "\n%d examples over the context length of %d tokens will be truncated, lines %s\n",
+			len(r.OverContextLength), r.ContextLength, strings.Trim(fmt.Sprint(r.OverContextLength), "[]"))
+	}
+	_, err := fmt.Fprintf(w, "\n%d tokens per epoch, %d epochs: %d billed training tokens\n", r.EpochTokens, r.Epochs, r.BilledTokens)
+	return err
+}
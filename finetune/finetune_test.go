@@ -0,0 +1,116 @@
+package finetune_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/chat"
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/finetune"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+const dataset = `{"messages": [{"role": "system", "content": "Be terse."}, {"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello!"}]}
+{"messages": [{"role": "user", "content": [{"type": "text", "text": "2+2?"}]}, {"role": "assistant", "content": "4", "weight": 0}, {"role": "user", "content": "Sure?"}, {"role": "assistant", "content": "Yes, 4."}]}
+
+{"messages": [{"role": "user", "content": "Weather?"}, {"role": "assistant", "content": null, "tool_calls": [{"id": "1", "type": "function", "function": {"name": "weather", "arguments": "{}"}}]}], "tools": [{"type": "function", "function": {"name": "weather", "description": "Current weather"}}]}
+`
+
+func TestCheck(t *testing.T) {
+	enc := encoding.O200kBase()
+	report, err := finetune.Check(strings.NewReader(dataset), enc, mod.GPT_4O_MINI, finetune.Options{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "gpt-4o-mini", report.Model)
+	assert.Equal(t, "o200k_base", report.Encoding)
+	assert.Equal(t, 3, report.Examples)
+	assert.Equal(t, 3, report.ValidExamples)
+	assert.Empty(t, report.Issues)
+	assert.Equal(t, 2, report.MissingSystem)
+	assert.Equal(t, 0, report.MissingUser)
+
+	first := chat.CountTokens(enc, []chat.Message{{Role: "system", Content: "Be terse."}, {Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello!"}})
+	second := chat.CountTokens(enc, []chat.Message{{Role: "user", Content: "2+2?"}, {Role: "assistant", Content: "4"}, {Role: "user", Content: "Sure?"}, {Role: "assistant", Content: "Yes, 4."}})
+	third, err := chat.CountRequest(enc, &chat.Request{
+		Messages: []chat.Message{{Role: "user", Content: "Weather?"}, {Role: "assistant", ToolCalls: []chat.ToolCall{{Function: chat.FunctionCall{Name: "weather", Arguments: "{}"}}}}},
+		Tools:    []chat.Tool{{Type: "function", Function: chat.FunctionDefinition{Name: "weather", Description: "Current weather"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, first+second+third, report.EpochTokens)
+	assert.Equal(t, 2, report.Messages.Min)
+	assert.Equal(t, 4, report.Messages.Max)
+	assert.Equal(t, 3.0, report.Messages.Median)
+	assert.Equal(t, min(first, second, third), report.Tokens.Min)
+	// the weight 0 answer isn't trained on
+	assert.Equal(t, enc.CountTokensOrdinary("Yes, 4."), report.AssistantTokens.Max)
+
+	// 3 examples are trained for 33 epochs to see 100 examples, at most 25
+	assert.Equal(t, finetune.MAX_DEFAULT_EPOCHS, report.Epochs)
+	assert.Equal(t, 25*report.EpochTokens, report.BilledTokens)
+
+	var text strings.Builder
+	assert.NoError(t, report.WriteText(&text))
+	assert.Contains(t, text.String(), "3 examples, 3 valid")
+	assert.Contains(t, text.String(), "25 epochs")
+}
+
+func TestCheckIssues(t *testing.T) {
+	lines := []string{
+		`{"messages": [{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello"}]}`,
+		`not json`,
+		`[1, 2]`,
+		`{"prompt": "Hi", "completion": "Hello"}`,
+		`{"messages": [{"content": "Hi"}, {"role": "assistant", "content": "Hello", "extra": 1}]}`,
+		`{"messages": [{"role": "human", "content": "Hi"}, {"role": "assistant", "content": 42, "weight": 2}]}`,
+		`{"messages": [{"role": "user", "content": "Hi"}]}`,
+		`{"messages": [{"role": "user", "content": "Hi"}, {"role": "assistant", "tool_calls": {}}]}`,
+		`{"messages": [{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello"}], "tools": [{"function": {"name": "f", "parameters": {"properties": 1}}}]}`,
+	}
+	report, err := finetune.Check(strings.NewReader(strings.Join(lines, "\n")), encoding.Cl100kBase(), mod.GPT_3_5_TURBO, finetune.Options{Epochs: 2})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 9, report.Examples)
+	assert.Equal(t, 1, report.ValidExamples)
+	assert.Equal(t, map[string]int{
+		finetune.InvalidJSON:                    1,
+		finetune.DataType:                       1,
+		finetune.MissingMessagesList:            1,
+		finetune.MessageMissingKey:              1,
+		finetune.MessageUnrecognizedKey:         1,
+		finetune.UnrecognizedRole:               1,
+		finetune.MissingContent:                 1,
+		finetune.InvalidWeight:                  1,
+		finetune.ExampleMissingAssistantMessage: 1,
+		finetune.InvalidToolCalls:               1,
+		finetune.InvalidTools:                   1,
+	}, report.IssueCounts())
+	assert.Equal(t, 5, report.Issues[3].Line)
+	assert.Equal(t, `message 2: unrecognized key "extra"`, report.Issues[4].Message)
+	last := report.Issues[len(report.Issues)-1]
+	assert.Equal(t, 9, last.Line)
+	assert.Equal(t, finetune.InvalidTools, last.Kind)
+	assert.Contains(t, last.Message, "parameters of function f")
+	assert.Equal(t, 2, report.Epochs)
+}
+
+func TestCheckContextLength(t *testing.T) {
+	long := strings.Repeat("word ", 3000)
+	dataset := `{"messages": [{"role": "user", "content": "` + long + `"}, {"role": "assistant", "content": "ok"}]}` + "\n" +
+		`{"messages": [{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "ok"}]}`
+	report, err := finetune.Check(strings.NewReader(dataset), encoding.R50kBase(), mod.DAVINCI, finetune.Options{Epochs: 1})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int{1}, report.OverContextLength)
+	assert.Greater(t, report.Tokens.Max, mod.DAVINCI.GetMaxContextLength())
+	assert.Equal(t, mod.DAVINCI.GetMaxContextLength()+report.Tokens.Min, report.EpochTokens)
+}
+
+func TestDefaultEpochs(t *testing.T) {
+	assert.Equal(t, 25, finetune.DefaultEpochs(1))
+	assert.Equal(t, 10, finetune.DefaultEpochs(10))
+	assert.Equal(t, 3, finetune.DefaultEpochs(34))
+	assert.Equal(t, 3, finetune.DefaultEpochs(8000))
+	assert.Equal(t, 2, finetune.DefaultEpochs(10000))
+	assert.Equal(t, 1, finetune.DefaultEpochs(30000))
+}
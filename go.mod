@@ -2,8 +2,6 @@ module github.com/currybab/tokgo
 
 go 1.24.2
 
-require github.com/emirpasic/gods/v2 v2.0.0-alpha
-
 require (
 	github.com/dlclark/regexp2 v1.11.5
 	github.com/stretchr/testify v1.10.0
@@ -0,0 +1,95 @@
+// Package metrics aggregates the events of encodings, see mod.Observer.
+package metrics
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// ExpvarObserver sums up the events of encodings in an expvar.Map, one map per encoding and
+// operation, such as cl100k_base.encode, with the counters calls, input_bytes, tokens,
+// nanoseconds, truncated, cache_hits and cache_misses. The map can be read at /debug/vars.
+type ExpvarObserver struct {
+	vars     *expvar.Map
+	mu       sync.RWMutex
+	counters map[counterKey]*counters
+}
+
+type counterKey struct {
+	encoding  string
+	operation mod.Operation
+}
+
+type counters struct {
+	calls       expvar.Int
+	inputBytes  expvar.Int
+	tokens      expvar.Int
+	nanoseconds expvar.Int
+	truncated   expvar.Int
+	cacheHits   expvar.Int
+	cacheMisses expvar.Int
+}
+
+// NewExpvarObserver sums up events in vars.
+func NewExpvarObserver(vars *expvar.Map) *ExpvarObserver {
+	return &ExpvarObserver{vars: vars, counters: map[counterKey]*counters{}}
+}
+
+// PublishExpvarObserver sums up events in a new expvar.Map published as name.
+// Like expvar.Publish it panics if name is already published.
+func PublishExpvarObserver(name string) *ExpvarObserver {
+	return NewExpvarObserver(expvar.NewMap(name))
+}
+
+// Vars returns the map the events are summed up in.
+func (o *ExpvarObserver) Vars() *expvar.Map {
+	return o.vars
+}
+
+func (o *ExpvarObserver) Observe(event mod.Event) {
+	c := o.countersOf(counterKey{encoding: event.Encoding, operation: event.Operation})
+	c.calls.Add(1)
+	c.inputBytes.Add(int64(event.InputBytes))
+	c.tokens.Add(int64(event.Tokens))
+	c.nanoseconds.Add(event.Duration.Nanoseconds())
+	if event.Truncated {
+		c.truncated.Add(1)
+	}
+	c.cacheHits.Add(event.CacheHits)
+	c.cacheMisses.Add(event.CacheMisses)
+}
+
+// countersOf returns the counters of an encoding and operation, publishing them on first use.
+func (o *ExpvarObserver) countersOf(key counterKey) *counters {
+	o.mu.RLock()
+	c, ok := o.counters[key]
+	o.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if c, ok := o.counters[key]; ok {
+		return c
+	}
+	c = &counters{}
+	operation := new(expvar.Map).Init()
+	operation.Set("calls", &c.calls)
+	operation.Set("input_bytes", &c.inputBytes)
+	operation.Set("tokens", &c.tokens)
+	operation.Set("nanoseconds", &c.nanoseconds)
+	operation.Set("truncated", &c.truncated)
+	operation.Set("cache_hits", &c.cacheHits)
+	operation.Set("cache_misses", &c.cacheMisses)
+	encoding, ok := o.vars.Get(key.encoding).(*expvar.Map)
+	if !ok {
+		encoding = new(expvar.Map).Init()
+		o.vars.Set(key.encoding, encoding)
+	}
+	encoding.Set(string(key.operation), operation)
+	o.counters[key] = c
+	return c
+}
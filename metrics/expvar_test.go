@@ -0,0 +1,39 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/currybab/tokgo/metrics"
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpvarObserver(t *testing.T) {
+	observer := metrics.NewExpvarObserver(new(expvar.Map).Init())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			observer.Observe(mod.Event{Encoding: "cl100k_base", Operation: mod.OPERATION_ENCODE, InputBytes: 10, Tokens: 3, Duration: time.Microsecond, Truncated: i%2 == 0, CacheHits: 2, CacheMisses: 1})
+		}()
+	}
+	wg.Wait()
+	observer.Observe(mod.Event{Encoding: "o200k_base", Operation: mod.OPERATION_DECODE, InputBytes: 5, Tokens: 1})
+
+	var vars map[string]map[string]map[string]int64
+	assert.NoError(t, json.Unmarshal([]byte(observer.Vars().String()), &vars))
+	assert.Equal(t, map[string]map[string]map[string]int64{
+		"cl100k_base": {"encode": {"calls": 8, "input_bytes": 80, "tokens": 24, "nanoseconds": 8000, "truncated": 4, "cache_hits": 16, "cache_misses": 8}},
+		"o200k_base":  {"decode": {"calls": 1, "input_bytes": 5, "tokens": 1, "nanoseconds": 0, "truncated": 0, "cache_hits": 0, "cache_misses": 0}},
+	}, vars)
+}
+
+func TestPublishExpvarObserver(t *testing.T) {
+	observer := metrics.PublishExpvarObserver("tokgo_test")
+	assert.Same(t, observer.Vars(), expvar.Get("tokgo_test"))
+}
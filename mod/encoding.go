@@ -1,5 +1,14 @@
 package mod
 
+import (
+	"context"
+	"iter"
+
+	"github.com/currybab/tokgo/parser"
+)
+
+// VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY names the environment variable used as a fallback
+// when an encoding is built without encoding.WithLargePieceThreshold.
 var VERY_LARGE_TOKENIZER_BYTE_THRESHOLD_KEY = "VERY_LARGE_TOKENIZER_BYTE_THRESHOLD"
 
 type Encoding interface {
@@ -13,3 +22,71 @@ type Encoding interface {
 	DecodeBytes(tokens []int) []byte
 	GetName() string
 }
+
+// ParallelEncoding is implemented by encodings that can encode a single large text
+// by splitting it into independent segments and encoding them concurrently.
+// The results are identical to the sequential methods of Encoding.
+type ParallelEncoding interface {
+	Encoding
+	EncodeParallel(text string, maxTokens int, parallelism int) *EncodingResult
+	EncodeOrdinaryParallel(text string, maxTokens int, parallelism int) *EncodingResult
+	CountTokensParallel(text string, parallelism int) int
+	CountTokensOrdinaryParallel(text string, parallelism int) int
+}
+
+// AppendEncoding is implemented by encodings that can append tokens to a caller
+// provided slice without allocating a result for them.
+type AppendEncoding interface {
+	Encoding
+	AppendEncode(dst []int, text string) []int
+	AppendEncodeOrdinary(dst []int, text string) []int
+}
+
+// ByteEncoding is implemented by encodings that can encode arbitrary bytes,
+// including invalid UTF-8, so that decoding returns them byte for byte.
+type ByteEncoding interface {
+	Encoding
+	EncodeBytes(data []byte) []int
+	CountTokensBytes(data []byte) int
+}
+
+// PieceEncoding is implemented by encodings that expose the pieces their
+// pre-tokenizer splits a text into before merging each piece into tokens.
+type PieceEncoding interface {
+	Encoding
+	Pieces(text string) iter.Seq[parser.Piece]
+}
+
+// SpecialTokenEncoding is implemented by encodings that can look up the ids of their
+// special tokens, so they can be inserted into token sequences directly.
+type SpecialTokenEncoding interface {
+	Encoding
+	SpecialTokenID(specialToken string) (int, bool)
+}
+
+// VocabularyEncoding is implemented by encodings that can tell whether an id is one of their
+// tokens, regular or special.
+type VocabularyEncoding interface {
+	Encoding
+	HasToken(token int) bool
+}
+
+// AllowSpecialEncoding is implemented by encodings that can encode special tokens to their ids
+// whatever special token policy they were built with. AllowSpecial returns such a view of the
+// encoding that shares everything else with it.
+type AllowSpecialEncoding interface {
+	Encoding
+	AllowSpecial() Encoding
+}
+
+// ContextEncoding is implemented by encodings that can give up encoding a text once a context is done.
+// They return ctx.Err() together with the progress so far: the tokens of the pieces that were encoded
+// completely, a truncated result and the index of the last byte of those pieces. A text that was
+// processed completely is returned without an error, like by the methods of Encoding.
+type ContextEncoding interface {
+	Encoding
+	EncodeContext(ctx context.Context, text string, maxTokens int) (*EncodingResult, error)
+	EncodeOrdinaryContext(ctx context.Context, text string, maxTokens int) (*EncodingResult, error)
+	CountTokensContext(ctx context.Context, text string) (int, error)
+	CountTokensOrdinaryContext(ctx context.Context, text string) (int, error)
+}
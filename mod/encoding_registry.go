@@ -8,3 +8,10 @@ type EncodingRegistry interface {
 	RegisterGptBytePairEncoding(parameters *GptBytePairEncodingParams) (EncodingRegistry, error)
 	RegisterCustomEncoding(encoding Encoding) (EncodingRegistry, error)
 }
+
+// NamedEncodingRegistry is implemented by registries that can list the names GetEncoding finds,
+// including the encodings registered with RegisterGptBytePairEncoding and RegisterCustomEncoding.
+type NamedEncodingRegistry interface {
+	EncodingRegistry
+	GetEncodingNames() []string
+}
@@ -8,14 +8,17 @@ const (
 	P50K_EDIT   EncodingType = "p50k_edit"
 	CL100K_BASE EncodingType = "cl100k_base"
 	O200K_BASE  EncodingType = "o200k_base"
+	// O200K_HARMONY is o200k_base with the special tokens of the harmony chat format.
+	O200K_HARMONY EncodingType = "o200k_harmony"
 )
 
 var encodingTypeMap = map[string]EncodingType{
-	"r50k_base":   R50K_BASE,
-	"p50k_base":   P50K_BASE,
-	"p50k_edit":   P50K_EDIT,
-	"cl100k_base": CL100K_BASE,
-	"o200k_base":  O200K_BASE,
+	"r50k_base":     R50K_BASE,
+	"p50k_base":     P50K_BASE,
+	"p50k_edit":     P50K_EDIT,
+	"cl100k_base":   CL100K_BASE,
+	"o200k_base":    O200K_BASE,
+	"o200k_harmony": O200K_HARMONY,
 }
 
 func EncodingTypeValues() []EncodingType {
@@ -25,6 +28,7 @@ func EncodingTypeValues() []EncodingType {
 		P50K_EDIT,
 		CL100K_BASE,
 		O200K_BASE,
+		O200K_HARMONY,
 	}
 }
 
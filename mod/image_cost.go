@@ -0,0 +1,65 @@
+package mod
+
+import "math"
+
+// ImageDetail is the detail level an image input is processed at.
+type ImageDetail string
+
+const (
+	IMAGE_DETAIL_LOW  ImageDetail = "low"
+	IMAGE_DETAIL_HIGH ImageDetail = "high"
+	// IMAGE_DETAIL_AUTO lets the model choose, it is priced like IMAGE_DETAIL_HIGH, the upper bound.
+	IMAGE_DETAIL_AUTO ImageDetail = "auto"
+)
+
+// Sizes an image is scaled to before it is cut into tiles at high detail.
+const (
+	IMAGE_MAX_SIDE   = 2048
+	IMAGE_SHORT_SIDE = 768
+	IMAGE_TILE_SIDE  = 512
+)
+
+// ImageCost is the price of image inputs of a vision model in tokens.
+type ImageCost struct {
+	// BaseTokens are billed for every image, a low detail image costs nothing more.
+	BaseTokens int
+	// TileTokens are billed per tile of a high detail image.
+	TileTokens int
+}
+
+// Tokens returns the tokens of an image of width x height pixels. At high detail the image is scaled
+// to fit in IMAGE_MAX_SIDE x IMAGE_MAX_SIDE, then down until its shortest side is IMAGE_SHORT_SIDE,
+// and every started IMAGE_TILE_SIDE square tile is billed.
+func (c ImageCost) Tokens(width int, height int, detail ImageDetail) int {
+	if detail == IMAGE_DETAIL_LOW {
+		return c.BaseTokens
+	}
+	w, h := float64(width), float64(height)
+	if longest := max(w, h); longest > IMAGE_MAX_SIDE {
+		w, h = w*IMAGE_MAX_SIDE/longest, h*IMAGE_MAX_SIDE/longest
+	}
+	if shortest := min(w, h); shortest > IMAGE_SHORT_SIDE {
+		w, h = w*IMAGE_SHORT_SIDE/shortest, h*IMAGE_SHORT_SIDE/shortest
+	}
+	tiles := math.Ceil(math.Floor(w)/IMAGE_TILE_SIDE) * math.Ceil(math.Floor(h)/IMAGE_TILE_SIDE)
+	return c.BaseTokens + int(tiles)*c.TileTokens
+}
+
+var (
+	// GPT_4O_IMAGE_COST prices the images of gpt-4o and gpt-4-turbo.
+	GPT_4O_IMAGE_COST = ImageCost{BaseTokens: 85, TileTokens: 170}
+	// GPT_4O_MINI_IMAGE_COST prices the images of gpt-4o-mini, which bills more tokens at a lower price per token.
+	GPT_4O_MINI_IMAGE_COST = ImageCost{BaseTokens: 2833, TileTokens: 5667}
+)
+
+var modelImageCosts = map[string]ImageCost{
+	GPT_4O.name:      GPT_4O_IMAGE_COST,
+	GPT_4_TURBO.name: GPT_4O_IMAGE_COST,
+	GPT_4O_MINI.name: GPT_4O_MINI_IMAGE_COST,
+}
+
+// GetImageCost returns the price of image inputs, false if the model doesn't accept images.
+func (m *ModelType) GetImageCost() (ImageCost, bool) {
+	cost, ok := modelImageCosts[m.name]
+	return cost, ok
+}
@@ -29,6 +29,8 @@ var (
 	GPT_4_TURBO       = ModelType{"gpt-4-turbo", CL100K_BASE, 128000}
 	GPT_3_5_TURBO     = ModelType{"gpt-3.5-turbo", CL100K_BASE, 16385}
 	GPT_3_5_TURBO_16K = ModelType{"gpt-3.5-turbo-16k", CL100K_BASE, 16385}
+	GPT_OSS_20B       = ModelType{"gpt-oss-20b", O200K_HARMONY, 131072}
+	GPT_OSS_120B      = ModelType{"gpt-oss-120b", O200K_HARMONY, 131072}
 
 	// Text models
 	TEXT_DAVINCI_003 = ModelType{"text-davinci-003", P50K_BASE, 4097}
@@ -80,6 +82,8 @@ var nameToModelType = map[string]*ModelType{
 	"gpt-4-turbo":                  &GPT_4_TURBO,
 	"gpt-3.5-turbo":                &GPT_3_5_TURBO,
 	"gpt-3.5-turbo-16k":            &GPT_3_5_TURBO_16K,
+	"gpt-oss-20b":                  &GPT_OSS_20B,
+	"gpt-oss-120b":                 &GPT_OSS_120B,
 	"text-davinci-003":             &TEXT_DAVINCI_003,
 	"text-davinci-002":             &TEXT_DAVINCI_002,
 	"text-davinci-001":             &TEXT_DAVINCI_001,
@@ -121,11 +125,25 @@ func ModelTypeValues() []ModelType {
 	return modelTypes
 }
 
+// ModelTypeFromName returns the model of a name, or of the longest known prefix of a dated or
+// suffixed name such as gpt-4o-mini-2024-07-18, which shares the encoding and image cost of its model.
 func ModelTypeFromName(name string) (*ModelType, bool) {
 	model, exists := nameToModelType[name]
 	if exists {
 		return model, exists
 	}
+	if strings.HasPrefix(name, GPT_OSS_20B.GetName()) {
+		return &GPT_OSS_20B, true
+	}
+
+	if strings.HasPrefix(name, GPT_OSS_120B.GetName()) {
+		return &GPT_OSS_120B, true
+	}
+
+	if strings.HasPrefix(name, GPT_4O_MINI.GetName()) {
+		return &GPT_4O_MINI, true
+	}
+
 	if strings.HasPrefix(name, GPT_4O.GetName()) {
 		return &GPT_4O, true
 	}
@@ -134,6 +152,10 @@ func ModelTypeFromName(name string) (*ModelType, bool) {
 		return &GPT_4_32K, true
 	}
 
+	if strings.HasPrefix(name, GPT_4_TURBO.GetName()) {
+		return &GPT_4_TURBO, true
+	}
+
 	if strings.HasPrefix(name, GPT_4.GetName()) {
 		return &GPT_4, true
 	}
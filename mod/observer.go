@@ -0,0 +1,41 @@
+package mod
+
+import "time"
+
+// Operation names an observed operation of an encoding.
+type Operation string
+
+const (
+	OPERATION_ENCODE          Operation = "encode"
+	OPERATION_ENCODE_ORDINARY Operation = "encode_ordinary"
+	OPERATION_COUNT           Operation = "count"
+	OPERATION_COUNT_ORDINARY  Operation = "count_ordinary"
+	OPERATION_DECODE          Operation = "decode"
+)
+
+// Event describes an operation of an encoding.
+type Event struct {
+	Encoding  string
+	Operation Operation
+	// InputBytes is the length of the encoded text, or of the decoded text.
+	InputBytes int
+	// Tokens are the tokens produced, counted or decoded.
+	Tokens    int
+	Duration  time.Duration
+	Truncated bool
+	// CacheHits and CacheMisses are the lookups of the piece cache of the encoding during the operation,
+	// including those of operations running concurrently on the same encoding.
+	CacheHits   int64
+	CacheMisses int64
+}
+
+// Observer receives an event after every operation of the encodings it is attached to.
+// It is called on the goroutine of the operation and must be safe for concurrent use.
+type Observer interface {
+	Observe(event Event)
+}
+
+// NopObserver ignores all events.
+type NopObserver struct{}
+
+func (NopObserver) Observe(Event) {}
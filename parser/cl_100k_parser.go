@@ -40,15 +40,40 @@ func (b *ByteArrayList) GetData() []byte {
 // FragmentConsumer is a function that processes ByteArrayList and returns a boolean
 type FragmentConsumer func([]byte) bool
 
+// Splitter holds the buffers used by Split so that they can be reused between calls.
+// A Splitter must not be used concurrently.
+type Splitter struct {
+	runes     []rune
+	utf8Bytes []byte
+}
+
 // Split tokenizes the input string into UTF-8 fragments
 func Split(input string, fragmentConsumer FragmentConsumer) {
+	var splitter Splitter
+	splitter.Split(input, fragmentConsumer)
+}
+
+// Split tokenizes the input string into UTF-8 fragments, reusing the buffers of the splitter.
+// A fragment is only valid until fragmentConsumer returns.
+func (s *Splitter) Split(input string, fragmentConsumer FragmentConsumer) {
+	s.SplitPieces(input, func(piece []byte, _ PieceKind) bool {
+		return fragmentConsumer(piece)
+	})
+}
+
+// SplitPieces tokenizes the input string like Split and also reports which rule produced each piece.
+// The pieces are contiguous and cover the whole input.
+func (s *Splitter) SplitPieces(input string, pieceConsumer PieceConsumer) {
 	if !IsValidUTF8(input) {
 		panic("Input is not UTF-8: " + input)
 	}
 
-	utf8Bytes := []byte{}
 	finished := false
-	inputRunes := []rune(input)
+	s.runes = s.runes[:0]
+	for _, r := range input {
+		s.runes = append(s.runes, r)
+	}
+	inputRunes := s.runes
 
 	for endIndex := 0; endIndex < len(inputRunes) && !finished; {
 		startIndex := endIndex
@@ -65,12 +90,12 @@ func Split(input string, fragmentConsumer FragmentConsumer) {
 			if IsShortContraction(c1) {
 				// 1) `\'[sdtm]` - contractions, such as the suffixes of `he\'s`, `I\'d`, `\'tis`, `I\'m`
 				endIndex += 2
-				finished = fragmentConsumer(AddUtf8Bytes(inputRunes, startIndex, endIndex, utf8Bytes))
+				finished = pieceConsumer(s.addUtf8Bytes(startIndex, endIndex), PieceContraction)
 				continue
 			} else if startIndex+2 < len(inputRunes) && IsLongContraction(c1, int(inputRunes[startIndex+2])) {
 				// 1) `\'(?:ll|ve|re)` - contractions, such as the suffixes of `you\'ll`, `we\'ve`, `they\'re`
 				endIndex += 3
-				finished = fragmentConsumer(AddUtf8Bytes(inputRunes, startIndex, endIndex, utf8Bytes))
+				finished = pieceConsumer(s.addUtf8Bytes(startIndex, endIndex), PieceContraction)
 				continue
 			}
 		}
@@ -91,7 +116,7 @@ func Split(input string, fragmentConsumer FragmentConsumer) {
 					endIndex += 1
 				}
 			}
-			finished = fragmentConsumer(AddUtf8Bytes(inputRunes, startIndex, endIndex, utf8Bytes))
+			finished = pieceConsumer(s.addUtf8Bytes(startIndex, endIndex), PieceWord)
 		} else if IsNumeric(c0) {
 			// 3) `\p{N}{1,3}` - numbers, such as `4`, `235` or `3½`
 			endIndex += 1
@@ -104,7 +129,7 @@ func Split(input string, fragmentConsumer FragmentConsumer) {
 					}
 				}
 			}
-			finished = fragmentConsumer(AddUtf8Bytes(inputRunes, startIndex, endIndex, utf8Bytes))
+			finished = pieceConsumer(s.addUtf8Bytes(startIndex, endIndex), PieceNumber)
 		} else if IsNotWhitespaceOrLetterOrNumeric(c0) || ((c0 == ' ') && IsNotWhitespaceOrLetterOrNumeric(c1)) {
 			// 4) ` ?[^\s\p{L}\p{N}]++[\r\n]*` - punctuation, such as `,`, ` .`, `"`
 			endIndex += 1
@@ -121,7 +146,7 @@ func Split(input string, fragmentConsumer FragmentConsumer) {
 			for endIndex < len(inputRunes) && IsNewline(int(inputRunes[endIndex])) {
 				endIndex += 1
 			}
-			finished = fragmentConsumer(AddUtf8Bytes(inputRunes, startIndex, endIndex, utf8Bytes))
+			finished = pieceConsumer(s.addUtf8Bytes(startIndex, endIndex), PiecePunctuation)
 		} else {
 			// 5) `\s*[\r\n]+` - line endings such as `\r\n    \r\n`
 			// 6) `\s+(?!\S)` - whitespaces such as `               ` or ` `
@@ -160,7 +185,7 @@ func Split(input string, fragmentConsumer FragmentConsumer) {
 					if startIndex >= endIndex {
 						panic("startIndex must be less than endIndex")
 					}
-					finished = fragmentConsumer(AddUtf8Bytes(inputRunes, startIndex, endIndex, utf8Bytes))
+					finished = pieceConsumer(s.addUtf8Bytes(startIndex, endIndex), PieceNewlineRun)
 					startIndex = endIndex
 					endIndex = finalEndIndex
 				}
@@ -171,13 +196,23 @@ func Split(input string, fragmentConsumer FragmentConsumer) {
 					endIndex -= 1
 				}
 				if startIndex < endIndex {
-					finished = fragmentConsumer(AddUtf8Bytes(inputRunes, startIndex, endIndex, utf8Bytes))
+					kind := PieceTrailingWhitespace
+					if lastNewLineIndex >= startIndex {
+						kind = PieceNewlineRun
+					}
+					finished = pieceConsumer(s.addUtf8Bytes(startIndex, endIndex), kind)
 				}
 			}
 		}
 	}
 }
 
+// addUtf8Bytes converts the runes between start and end into the reused byte buffer
+func (s *Splitter) addUtf8Bytes(start, end int) []byte {
+	s.utf8Bytes = AddUtf8Bytes(s.runes, start, end, s.utf8Bytes)
+	return s.utf8Bytes
+}
+
 // IsShortContraction checks if a character is a short contraction
 func IsShortContraction(ch int) bool {
 	return strings.ContainsRune(SDTM, rune(ch))
@@ -203,26 +238,24 @@ func IsValidUTF8(input string) bool {
 	return utf8.ValidString(input)
 }
 
-// IsLetter checks if a code point is a letter
+// IsLetter checks if a code point is a letter.
+// Above ASCII it follows the Unicode tables of the Go release, like \p{L} of regexp2 does,
+// which may be of another Unicode version than the tables of tiktoken.
 func IsLetter(ch int) bool {
 	if ch < 0xaa {
 		return (ch >= 'a' && ch <= 'z') ||
 			(ch >= 'A' && ch <= 'Z')
-	} else if ch <= 0x323af {
-		return unicode.IsLetter(rune(ch))
 	}
-	return false
+	return unicode.IsLetter(rune(ch))
 }
 
-// IsNumeric checks if a code point is a number
+// IsNumeric checks if a code point is a number.
+// Above ASCII it follows the Unicode tables of the Go release, like IsLetter.
 func IsNumeric(ch int) bool {
 	if ch < 0xb2 {
 		return ch >= '0' && ch <= '9'
-	} else if ch <= 0x1fbf9 {
-		runeChar := rune(ch)
-		return unicode.IsNumber(runeChar)
 	}
-	return false
+	return unicode.IsNumber(rune(ch))
 }
 
 // IsLetterOrNumeric checks if a code point is a letter or number
@@ -231,11 +264,9 @@ func IsLetterOrNumeric(ch int) bool {
 		return (ch >= 'a' && ch <= 'z') ||
 			(ch >= 'A' && ch <= 'Z') ||
 			(ch >= '0' && ch <= '9')
-	} else if ch <= 0x323af {
-		runeChar := rune(ch)
-		return unicode.IsLetter(runeChar) || unicode.IsNumber(runeChar)
 	}
-	return false
+	runeChar := rune(ch)
+	return unicode.IsLetter(runeChar) || unicode.IsNumber(runeChar)
 }
 
 // IsWhitespace checks if a code point is whitespace
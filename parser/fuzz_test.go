@@ -0,0 +1,119 @@
+package parser_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/currybab/tokgo/parser"
+	"github.com/dlclark/regexp2"
+)
+
+// cl100kPattern is the pattern of cl100k_base that Split implements, with a group per alternative.
+// regexp2 has no possessive quantifiers, so they are written as atomic groups, and the contractions
+// are matched case-insensitively like by tiktoken.
+var cl100kPattern = regexp2.MustCompile(`('(?i:[sdmtſ]|ll|ve|re))|((?>[^\r\n\p{L}\p{N}]?)\p{L}+)|(\p{N}{1,3})|( ?(?>[^\s\p{L}\p{N}]+)[\r\n]*)|(\s*[\r\n])|(\s+(?!\S))|(\s+)`, regexp2.None)
+
+// cl100kPatternKinds are the kinds of the pieces matched by the groups of cl100kPattern.
+var cl100kPatternKinds = []parser.PieceKind{
+	parser.PieceContraction,
+	parser.PieceWord,
+	parser.PieceNumber,
+	parser.PiecePunctuation,
+	parser.PieceNewlineRun,
+	parser.PieceTrailingWhitespace,
+	parser.PieceTrailingWhitespace,
+}
+
+// piece is a piece of text and the kind of the rule that matched it.
+type piece struct {
+	text string
+	kind parser.PieceKind
+}
+
+func regexPieces(t *testing.T, text string) []piece {
+	var pieces []piece
+	match, err := cl100kPattern.FindStringMatch(text)
+	for ; match != nil && err == nil; match, err = cl100kPattern.FindNextMatch(match) {
+		for i, kind := range cl100kPatternKinds {
+			if match.GroupByNumber(i+1).Length > 0 {
+				pieces = append(pieces, piece{text: match.String(), kind: kind})
+				break
+			}
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pieces
+}
+
+func splitPieces(text string) []piece {
+	var pieces []piece
+	var splitter parser.Splitter
+	splitter.SplitPieces(text, func(p []byte, kind parser.PieceKind) bool {
+		pieces = append(pieces, piece{text: string(p), kind: kind})
+		return false
+	})
+	return pieces
+}
+
+func FuzzSplitMatchesCl100kPattern(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"Hello, world! It's 12345 o'clock.\n\n  Tab\there",
+		"they'RE WE'VE i'Ll 'ſ 's'",
+		"  \r\n\r\n   x 　y ",
+		"3½ ٣٤٥ 𝟘𝟙𝟚",
+		"...!!!\n\n\n ???",
+		"\U00033479\U000323b0 \U00031350",
+		"🤚🏾 naïve café́",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		if !utf8.ValidString(text) {
+			t.Skip("Split only accepts UTF-8")
+		}
+		if len(text) > 4096 {
+			t.Skip("the pattern backtracks too much on long inputs")
+		}
+		expected := regexPieces(t, text)
+		actual := splitPieces(text)
+		if !slices.Equal(expected, actual) {
+			t.Errorf("pieces of %q\nregex: %v\nsplit: %v", text, expected, actual)
+		}
+	})
+}
+
+// documentedUnicodeVersions are the versions of the Unicode tables of the Go releases the README lists.
+var documentedUnicodeVersions = []string{"15.0.0", "17.0.0"}
+
+// TestUnicodeVersion pins the Unicode tables IsLetter and IsNumeric follow. regexp2 shares them,
+// so the comparisons above can't notice a new version, while tiktoken brings its own tables:
+// when Go upgrades Unicode, compare the new letters and numbers with tiktoken and update the README.
+func TestUnicodeVersion(t *testing.T) {
+	if !slices.Contains(documentedUnicodeVersions, unicode.Version) {
+		t.Errorf("the Unicode tables are of version %s, check the letters and numbers it adds against tiktoken", unicode.Version)
+	}
+}
+
+// TestSplitMatchesCl100kPatternForEveryCodePoint puts every code point in the contexts of the rules,
+// which random inputs rarely reach for code points outside of the seeds. It takes a while, so -short skips it.
+func TestSplitMatchesCl100kPatternForEveryCodePoint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("checks all code points")
+	}
+	for cp := MIN_CODE_POINT; cp <= MAX_CODE_POINT; cp++ {
+		if cp >= 0xd800 && cp <= 0xdfff {
+			continue
+		}
+		c := rune(cp)
+		text := fmt.Sprintf("a%c1%c ?%c'%c\t%c\n%c", c, c, c, c, c, c)
+		if expected, actual := regexPieces(t, text), splitPieces(text); !slices.Equal(expected, actual) {
+			t.Fatalf("pieces of %q (0x%x)\nregex: %v\nsplit: %v", text, cp, expected, actual)
+		}
+	}
+}
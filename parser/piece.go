@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"unicode/utf8"
+)
+
+// PieceKind names the pre-tokenization rule that produced a piece.
+type PieceKind int
+
+const (
+	// PieceContraction is a contraction suffix such as `'s`, `'ll` or `'re`.
+	PieceContraction PieceKind = iota
+	// PieceWord is a run of letters with an optional leading non-letter, such as ` of` or `It`.
+	PieceWord
+	// PieceNumber is a run of numbers, such as `4` or `235`.
+	PieceNumber
+	// PiecePunctuation is a run of punctuation with an optional leading space and trailing newlines, such as ` .` or `",\n`.
+	PiecePunctuation
+	// PieceNewlineRun is whitespace up to and including the last line ending of a run, such as `\r\n    \r\n`.
+	PieceNewlineRun
+	// PieceTrailingWhitespace is whitespace that isn't attached to the following piece, such as `   `.
+	PieceTrailingWhitespace
+	// PieceSpecialToken is a special token such as `<|endoftext|>`, it's never produced by Split.
+	PieceSpecialToken
+	// PieceInvalidByte is a single byte that isn't part of valid UTF-8, it's never produced by Split.
+	PieceInvalidByte
+)
+
+var pieceKindNames = [...]string{
+	PieceContraction:        "contraction",
+	PieceWord:               "word",
+	PieceNumber:             "number",
+	PiecePunctuation:        "punctuation",
+	PieceNewlineRun:         "newline run",
+	PieceTrailingWhitespace: "trailing whitespace",
+	PieceSpecialToken:       "special token",
+	PieceInvalidByte:        "invalid byte",
+}
+
+func (k PieceKind) String() string {
+	if k < 0 || int(k) >= len(pieceKindNames) {
+		return "unknown"
+	}
+	return pieceKindNames[k]
+}
+
+// PieceConsumer is a function that processes a piece and its kind and returns true to stop splitting
+type PieceConsumer func(piece []byte, kind PieceKind) bool
+
+// Piece is a pre-tokenization piece of a text, Start and End are byte offsets into the text.
+type Piece struct {
+	Text  string
+	Start int
+	End   int
+	Kind  PieceKind
+}
+
+// ClassifyPiece returns the kind of a piece matched by a pre-tokenization pattern other than cl100k's,
+// using the same rules Split distinguishes.
+func ClassifyPiece(piece string) PieceKind {
+	if isContraction(piece) {
+		return PieceContraction
+	}
+
+	hasLetter, hasNumber, hasNewline, allWhitespace := false, false, false, true
+	for _, r := range piece {
+		ch := int(r)
+		hasLetter = hasLetter || IsLetter(ch)
+		hasNumber = hasNumber || IsNumeric(ch)
+		hasNewline = hasNewline || IsNewline(ch)
+		allWhitespace = allWhitespace && IsWhitespace(ch)
+	}
+	switch {
+	case hasLetter:
+		return PieceWord
+	case hasNumber:
+		return PieceNumber
+	case !allWhitespace:
+		return PiecePunctuation
+	case hasNewline && IsNewline(int(piece[len(piece)-1])):
+		return PieceNewlineRun
+	default:
+		return PieceTrailingWhitespace
+	}
+}
+
+func isContraction(piece string) bool {
+	if len(piece) < 2 || piece[0] != '\'' {
+		return false
+	}
+	c1, size := utf8.DecodeRuneInString(piece[1:])
+	switch rest := piece[1+size:]; utf8.RuneCountInString(rest) {
+	case 0:
+		return IsShortContraction(int(c1))
+	case 1:
+		c2, _ := utf8.DecodeRuneInString(rest)
+		return IsLongContraction(int(c1), int(c2))
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyPiece(t *testing.T) {
+	for piece, expected := range map[string]parser.PieceKind{
+		"'s":    parser.PieceContraction,
+		"'LL":   parser.PieceContraction,
+		"'sup":  parser.PieceWord,
+		" of":   parser.PieceWord,
+		"235":   parser.PieceNumber,
+		" 3½":   parser.PieceNumber,
+		" .":    parser.PiecePunctuation,
+		"\",\n": parser.PiecePunctuation,
+		"\r\n ": parser.PieceTrailingWhitespace,
+		" \r\n": parser.PieceNewlineRun,
+		"     ": parser.PieceTrailingWhitespace,
+		"　":     parser.PieceTrailingWhitespace,
+	} {
+		assert.Equal(t, expected, parser.ClassifyPiece(piece), piece)
+	}
+}
+
+func TestSplitPiecesMatchesSplit(t *testing.T) {
+	input := "He's   here\r\n\r\n  and, 12345 you'll ok  "
+	var fragments []string
+	parser.Split(input, func(fragment []byte) bool {
+		fragments = append(fragments, string(fragment))
+		return false
+	})
+
+	var pieces []string
+	var kinds []parser.PieceKind
+	var splitter parser.Splitter
+	splitter.SplitPieces(input, func(piece []byte, kind parser.PieceKind) bool {
+		pieces = append(pieces, string(piece))
+		kinds = append(kinds, kind)
+		return false
+	})
+
+	assert.Equal(t, fragments, pieces)
+	assert.Equal(t, []parser.PieceKind{
+		parser.PieceWord, parser.PieceContraction, parser.PieceTrailingWhitespace, parser.PieceWord,
+		parser.PieceNewlineRun, parser.PieceTrailingWhitespace, parser.PieceWord, parser.PiecePunctuation,
+		parser.PieceTrailingWhitespace, parser.PieceNumber, parser.PieceNumber, parser.PieceWord,
+		parser.PieceContraction, parser.PieceWord, parser.PieceTrailingWhitespace,
+	}, kinds)
+	assert.Equal(t, "newline run", parser.PieceNewlineRun.String())
+}
@@ -0,0 +1,30 @@
+# Writes cl100k_base_encodings.csv without tiktoken: base_prompts.csv already holds the
+# cl100k_base tokens tiktoken encoded its inputs to, and the truncated tokens are chosen like
+# generate_reference_csv.py does, decoding with the ranks in resources/cl100k_base.tiktoken.
+import base64
+import csv
+
+decoder = {}
+with open("../../resources/cl100k_base.tiktoken", encoding="utf-8") as f:
+    for line in f:
+        token, rank = line.split()
+        decoder[int(rank)] = base64.b64decode(token)
+
+
+def decode(tokens):
+    return b"".join(decoder[token] for token in tokens).decode("utf-8", errors="replace")
+
+
+with open("../../resources/test/base_prompts.csv", mode="r", encoding="utf-8", newline="") as f:
+    csvdata = csv.reader(f, delimiter=",", quotechar='"')
+    next(csvdata, None)
+    with open("../../resources/test/cl100k_base_encodings.csv", mode="w", encoding="utf-8", newline="") as outFile:
+        writer = csv.writer(outFile, delimiter=",", quotechar='"')
+        writer.writerow(["input", "output", "outputMaxTokens10"])
+        for row in csvdata:
+            encoded = [int(token) for token in row[1].strip("[]").split(",") if token.strip()]
+            for i in reversed(range(11)):
+                encodedShort = encoded[:i]
+                if row[0].startswith(decode(encodedShort)):
+                    writer.writerow([row[0], encoded, encodedShort])
+                    break
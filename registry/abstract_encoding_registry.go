@@ -2,6 +2,7 @@ package tokgo
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/currybab/tokgo/encoding"
@@ -10,6 +11,7 @@ import (
 
 type AbstractEncodingRegistry struct {
 	encodings sync.Map // map[string]mod.Encoding
+	options   []encoding.Option
 }
 
 func (a *AbstractEncodingRegistry) GetEncoding(encodingName string) (mod.Encoding, error) {
@@ -20,6 +22,17 @@ func (a *AbstractEncodingRegistry) GetEncoding(encodingName string) (mod.Encodin
 	return encoding.(mod.Encoding), nil
 }
 
+// GetEncodingNames returns the sorted names of the encodings of the registry.
+func (a *AbstractEncodingRegistry) GetEncodingNames() []string {
+	var names []string
+	a.encodings.Range(func(name, _ any) bool {
+		names = append(names, name.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
 func (a *AbstractEncodingRegistry) GetEncodingByType(encodingType mod.EncodingType) (mod.Encoding, error) {
 	encoding, exists := a.encodings.Load(encodingType.GetName())
 	if !exists {
@@ -45,7 +58,7 @@ func (a *AbstractEncodingRegistry) GetEncodingForModelType(modelType mod.ModelTy
 }
 
 func (a *AbstractEncodingRegistry) RegisterGptBytePairEncoding(parameters *mod.GptBytePairEncodingParams) (mod.EncodingRegistry, error) {
-	return a.RegisterCustomEncoding(encoding.FromParameters(parameters))
+	return a.RegisterCustomEncoding(encoding.FromParameters(parameters, a.options...))
 }
 
 func (a *AbstractEncodingRegistry) RegisterCustomEncoding(encoding mod.Encoding) (mod.EncodingRegistry, error) {
@@ -61,15 +74,17 @@ func (a *AbstractEncodingRegistry) RegisterCustomEncoding(encoding mod.Encoding)
 func (a *AbstractEncodingRegistry) AddEncoding(encodingType mod.EncodingType) error {
 	switch encodingType {
 	case mod.R50K_BASE:
-		a.encodings.Store(encodingType.GetName(), encoding.R50kBase())
+		a.encodings.Store(encodingType.GetName(), encoding.R50kBase(a.options...))
 	case mod.P50K_BASE:
-		a.encodings.Store(encodingType.GetName(), encoding.P50kBase())
+		a.encodings.Store(encodingType.GetName(), encoding.P50kBase(a.options...))
 	case mod.P50K_EDIT:
-		a.encodings.Store(encodingType.GetName(), encoding.P50kEdit())
+		a.encodings.Store(encodingType.GetName(), encoding.P50kEdit(a.options...))
 	case mod.CL100K_BASE:
-		a.encodings.Store(encodingType.GetName(), encoding.Cl100kBase())
+		a.encodings.Store(encodingType.GetName(), encoding.Cl100kBase(a.options...))
 	case mod.O200K_BASE:
-		a.encodings.Store(encodingType.GetName(), encoding.O200kBase())
+		a.encodings.Store(encodingType.GetName(), encoding.O200kBase(a.options...))
+	case mod.O200K_HARMONY:
+		a.encodings.Store(encodingType.GetName(), encoding.O200kHarmony(a.options...))
 	default:
 		return fmt.Errorf("unknown encoding type %s", encodingType.GetName())
 	}
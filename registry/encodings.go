@@ -1,17 +1,42 @@
 package tokgo
 
-import "github.com/currybab/tokgo/mod"
+import (
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+)
 
-func NewDefaultEncodingRegistry() mod.EncodingRegistry {
+// NewDefaultEncodingRegistry creates a registry with all built-in encodings loaded.
+// The options are applied to every built-in encoding and to encodings registered
+// with RegisterGptBytePairEncoding.
+func NewDefaultEncodingRegistry(opts ...encoding.Option) mod.EncodingRegistry {
 	reg := &DefaultEncodingRegistry{
-		AbstractEncodingRegistry: &AbstractEncodingRegistry{},
+		AbstractEncodingRegistry: &AbstractEncodingRegistry{options: opts},
 	}
 	reg.initializeDefaultEncodings()
 	return reg
 }
 
-func NewLazyEncodingRegistry() mod.EncodingRegistry {
+// NewLazyEncodingRegistry creates a registry which loads built-in encodings on first use.
+// The options are applied like in NewDefaultEncodingRegistry.
+func NewLazyEncodingRegistry(opts ...encoding.Option) mod.EncodingRegistry {
 	return &LazyEncodingRegistry{
-		AbstractEncodingRegistry: &AbstractEncodingRegistry{},
+		AbstractEncodingRegistry: &AbstractEncodingRegistry{options: opts},
 	}
 }
+
+// RegisterDerivedEncoding derives an encoding named name from the encoding baseName of the registry
+// with extra special and regular tokens, see encoding.Derive, and registers it.
+func RegisterDerivedEncoding(registry mod.EncodingRegistry, baseName string, name string, extraSpecial map[string]int, extraTokens map[string]int) (mod.Encoding, error) {
+	base, err := registry.GetEncoding(baseName)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := encoding.Derive(base, name, extraSpecial, extraTokens)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := registry.RegisterCustomEncoding(derived); err != nil {
+		return nil, err
+	}
+	return derived, nil
+}
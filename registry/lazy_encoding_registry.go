@@ -2,6 +2,7 @@ package tokgo
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/currybab/tokgo/mod"
 )
@@ -13,7 +14,7 @@ type LazyEncodingRegistry struct {
 func (r *LazyEncodingRegistry) GetEncoding(encodingName string) (mod.Encoding, error) {
 	encodingType, exists := mod.EncodingTypeFromName(encodingName)
 	if exists {
-		err := r.AddEncoding(encodingType)
+		err := r.addEncodingIfAbsent(encodingType)
 		if err != nil {
 			return nil, err
 		}
@@ -21,8 +22,20 @@ func (r *LazyEncodingRegistry) GetEncoding(encodingName string) (mod.Encoding, e
 	return r.AbstractEncodingRegistry.GetEncoding(encodingName)
 }
 
+// GetEncodingNames returns the sorted names of the built-in encodings, loaded or not, and the registered ones.
+func (r *LazyEncodingRegistry) GetEncodingNames() []string {
+	names := r.AbstractEncodingRegistry.GetEncodingNames()
+	for _, encodingType := range mod.EncodingTypeValues() {
+		if !slices.Contains(names, encodingType.GetName()) {
+			names = append(names, encodingType.GetName())
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
 func (r *LazyEncodingRegistry) GetEncodingByType(encodingType mod.EncodingType) (mod.Encoding, error) {
-	err := r.AddEncoding(encodingType)
+	err := r.addEncodingIfAbsent(encodingType)
 	if err != nil {
 		return nil, err
 	}
@@ -38,9 +51,18 @@ func (r *LazyEncodingRegistry) GetEncodingForModel(modelName string) (mod.Encodi
 }
 
 func (r *LazyEncodingRegistry) GetEncodingForModelType(modelType mod.ModelType) (mod.Encoding, error) {
-	err := r.AddEncoding(modelType.GetEncodingType())
+	err := r.addEncodingIfAbsent(modelType.GetEncodingType())
 	if err != nil {
 		return nil, err
 	}
 	return r.AbstractEncodingRegistry.GetEncodingForModelType(modelType)
 }
+
+// addEncodingIfAbsent loads a built-in encoding only once, so its piece cache and
+// other state survive between lookups.
+func (r *LazyEncodingRegistry) addEncodingIfAbsent(encodingType mod.EncodingType) error {
+	if _, exists := r.encodings.Load(encodingType.GetName()); exists {
+		return nil
+	}
+	return r.AddEncoding(encodingType)
+}
@@ -0,0 +1,42 @@
+package registry_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/mod"
+	tokgo "github.com/currybab/tokgo/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterDerivedEncoding(t *testing.T) {
+	registry := tokgo.NewLazyEncodingRegistry()
+	derived, err := tokgo.RegisterDerivedEncoding(registry, "cl100k_base", "cl100k_im",
+		map[string]int{"<|im_start|>": 100264, "<|im_end|>": 100265}, nil)
+	assert.NoError(t, err)
+
+	registered, err := registry.GetEncoding("cl100k_im")
+	assert.NoError(t, err)
+	assert.Same(t, derived, registered)
+	assert.Equal(t, "<|im_end|>", registered.Decode([]int{100265}))
+
+	_, err = tokgo.RegisterDerivedEncoding(registry, "cl100k_base", "cl100k_im", nil, nil)
+	assert.EqualError(t, err, "encoding cl100k_im already registered")
+	_, err = tokgo.RegisterDerivedEncoding(registry, "unknown", "other", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestRegistriesProvideO200kHarmony(t *testing.T) {
+	for _, registry := range []mod.EncodingRegistry{tokgo.NewDefaultEncodingRegistry(), tokgo.NewLazyEncodingRegistry()} {
+		harmony, err := registry.GetEncodingByType(mod.O200K_HARMONY)
+		assert.NoError(t, err)
+		assert.Equal(t, "o200k_harmony", harmony.GetName())
+
+		forModel, err := registry.GetEncodingForModel("gpt-oss-20b")
+		assert.NoError(t, err)
+		assert.Same(t, harmony, forModel)
+	}
+
+	modelType, ok := mod.ModelTypeFromName("gpt-oss-120b-2025")
+	assert.True(t, ok)
+	assert.Equal(t, mod.O200K_HARMONY, modelType.GetEncodingType())
+}
@@ -3,7 +3,10 @@ package registry_test
 import (
 	"testing"
 
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
 	tokgo "github.com/currybab/tokgo/registry"
+	"github.com/stretchr/testify/assert"
 )
 
 func setupLazyEncodingRegistry() {
@@ -84,3 +87,15 @@ func TestLazyGetEncodingReturnsEmptyOptionalForNonExistingEncodingName(t *testin
 	setupLazyEncodingRegistry()
 	getEncodingReturnsEmptyOptionalForNonExistingEncodingName(t)
 }
+
+func TestLazyRegistryAppliesOptionsAndKeepsLoadedEncodings(t *testing.T) {
+	registry = tokgo.NewLazyEncodingRegistry(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed))
+
+	first, err := registry.GetEncodingByType(mod.CL100K_BASE)
+	assert.Nil(t, err)
+	second, err := registry.GetEncodingForModel("gpt-4")
+	assert.Nil(t, err)
+	assert.Same(t, first, second)
+
+	assert.Equal(t, []int{100257}, first.EncodeToIntArray("<|endoftext|>"))
+}
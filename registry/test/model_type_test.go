@@ -0,0 +1,51 @@
+package registry_test
+
+import (
+	"testing"
+
+	"github.com/currybab/tokgo/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelTypeFromNameResolvesDatedNames(t *testing.T) {
+	for name, expected := range map[string]*mod.ModelType{
+		"gpt-4o-mini-2024-07-18": &mod.GPT_4O_MINI,
+		"gpt-4o-2024-08-06":      &mod.GPT_4O,
+		"gpt-4-turbo-2024-04-09": &mod.GPT_4_TURBO,
+		"gpt-4-turbo-preview":    &mod.GPT_4_TURBO,
+		"gpt-4-32k-0613":         &mod.GPT_4_32K,
+		"gpt-4-0613":             &mod.GPT_4,
+	} {
+		model, ok := mod.ModelTypeFromName(name)
+		assert.True(t, ok, name)
+		assert.Same(t, expected, model, name)
+	}
+
+	// the dated names are priced like their model
+	mini, _ := mod.ModelTypeFromName("gpt-4o-mini-2024-07-18")
+	cost, ok := mini.GetImageCost()
+	expected, _ := mod.GPT_4O_MINI.GetImageCost()
+	assert.True(t, ok)
+	assert.Equal(t, expected, cost)
+	turbo, _ := mod.ModelTypeFromName("gpt-4-turbo-2024-04-09")
+	_, ok = turbo.GetImageCost()
+	assert.True(t, ok, "gpt-4-turbo accepts images, gpt-4 doesn't")
+	_, ok = mod.GPT_4.GetImageCost()
+	assert.False(t, ok)
+
+	_, ok = mod.ModelTypeFromName("gpt-5-unknown")
+	assert.False(t, ok)
+}
+
+func TestModelTypeFromNameResolvesGptOssSizes(t *testing.T) {
+	model, ok := mod.ModelTypeFromName("gpt-oss-20b-2025-08-05")
+	assert.True(t, ok)
+	assert.Same(t, &mod.GPT_OSS_20B, model)
+
+	model, ok = mod.ModelTypeFromName("gpt-oss-120b-2025-08-05")
+	assert.True(t, ok)
+	assert.Same(t, &mod.GPT_OSS_120B, model)
+
+	_, ok = mod.ModelTypeFromName("gpt-oss-7b")
+	assert.False(t, ok)
+}
@@ -0,0 +1,25 @@
+package registry_test
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/metrics"
+	"github.com/currybab/tokgo/mod"
+	tokgo "github.com/currybab/tokgo/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryAttachesObserverToItsEncodings(t *testing.T) {
+	observer := metrics.NewExpvarObserver(new(expvar.Map).Init())
+	registry := tokgo.NewLazyEncodingRegistry(encoding.WithObserver(observer))
+
+	for _, encodingType := range []mod.EncodingType{mod.CL100K_BASE, mod.O200K_BASE} {
+		enc, err := registry.GetEncodingByType(encodingType)
+		assert.NoError(t, err)
+		enc.CountTokens("hello world")
+	}
+	assert.Equal(t, "2", observer.Vars().Get("cl100k_base").(*expvar.Map).Get("count").(*expvar.Map).Get("tokens").String())
+	assert.NotNil(t, observer.Vars().Get("o200k_base"))
+}
@@ -0,0 +1,416 @@
+// Package server exposes encodings over HTTP as JSON endpoints, so that services written in
+// other languages can tokenize with tokgo:
+//
+//	POST /encode  {"model": "gpt-4o", "text": "hello"}            -> {"encoding": "o200k_base", "tokens": [24912]}
+//	POST /count   {"encoding": "cl100k_base", "texts": ["a", "b"]} -> {"encoding": "cl100k_base", "counts": [1, 1]}
+//	POST /decode  {"encoding": "cl100k_base", "tokens": [15339]}    -> {"encoding": "cl100k_base", "text": "hello"}
+//	GET  /models                                                   -> the encodings and models that can be selected
+//
+// A request selects its encoding by name or by model, and carries a single text or token list,
+// or a batch of them. Failed requests are answered with {"error": "..."}.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/currybab/tokgo/encoder"
+	"github.com/currybab/tokgo/mod"
+)
+
+const (
+	// DefaultMaxRequestBytes limits the body of a request unless Options.MaxRequestBytes is set.
+	DefaultMaxRequestBytes = 16 << 20
+	// DefaultMaxBatchSize limits the texts or token lists of a request unless Options.MaxBatchSize is set.
+	DefaultMaxBatchSize = 1024
+)
+
+// Options configures NewHandler.
+type Options struct {
+	// MaxRequestBytes is the largest request body, DefaultMaxRequestBytes if zero.
+	MaxRequestBytes int64
+	// MaxBatchSize is the largest number of texts or token lists in a request, DefaultMaxBatchSize if zero.
+	MaxBatchSize int
+}
+
+// EncodeRequest is the body of /encode and /count. Either Text or Texts is set.
+type EncodeRequest struct {
+	// Encoding is the name of the encoding, Model overrides it.
+	Encoding string   `json:"encoding,omitempty"`
+	Model    string   `json:"model,omitempty"`
+	Text     *string  `json:"text,omitempty"`
+	Texts    []string `json:"texts,omitempty"`
+	// AllowSpecial encodes special tokens to their ids instead of as ordinary text, whatever the special
+	// token policy of the encodings of the registry. Encodings that don't implement mod.AllowSpecialEncoding
+	// keep their policy, a disallowed special token is a bad request.
+	AllowSpecial bool `json:"allow_special,omitempty"`
+	// MaxTokens truncates the tokens of every text of /encode if positive.
+	MaxTokens int `json:"max_tokens,omitempty"`
+}
+
+// EncodeResult holds the tokens of a text.
+type EncodeResult struct {
+	Tokens    []int `json:"tokens"`
+	Truncated bool  `json:"truncated,omitempty"`
+}
+
+// EncodeResponse answers /encode with the tokens of Text, or Results in the order of Texts.
+type EncodeResponse struct {
+	Encoding string `json:"encoding"`
+	*EncodeResult
+	Results []EncodeResult `json:"results,omitempty"`
+}
+
+// CountResponse answers /count with the token count of Text, or Counts in the order of Texts.
+type CountResponse struct {
+	Encoding string `json:"encoding"`
+	Count    *int   `json:"count,omitempty"`
+	Counts   []int  `json:"counts,omitempty"`
+}
+
+// DecodeRequest is the body of /decode. Either Tokens or Batch is set.
+type DecodeRequest struct {
+	Encoding string  `json:"encoding,omitempty"`
+	Model    string  `json:"model,omitempty"`
+	Tokens   []int   `json:"tokens,omitempty"`
+	Batch    [][]int `json:"batch,omitempty"`
+}
+
+// DecodeResponse answers /decode with the text of Tokens, or Texts in the order of Batch.
+type DecodeResponse struct {
+	Encoding string   `json:"encoding"`
+	Text     *string  `json:"text,omitempty"`
+	Texts    []string `json:"texts,omitempty"`
+}
+
+// Model describes a model that can be selected.
+type Model struct {
+	Name             string `json:"name"`
+	Encoding         string `json:"encoding"`
+	MaxContextLength int    `json:"max_context_length"`
+}
+
+// ModelsResponse answers /models.
+type ModelsResponse struct {
+	Encodings []string `json:"encodings"`
+	Models    []Model  `json:"models"`
+}
+
+// ErrorResponse is the body of a failed request.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type handler struct {
+	registry mod.EncodingRegistry
+	options  Options
+}
+
+// NewHandler returns a handler of the endpoints that resolves encodings with registry.
+// It can be mounted under a prefix with http.StripPrefix.
+func NewHandler(registry mod.EncodingRegistry, options Options) http.Handler {
+	if options.MaxRequestBytes <= 0 {
+		options.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	if options.MaxBatchSize <= 0 {
+		options.MaxBatchSize = DefaultMaxBatchSize
+	}
+	h := &handler{registry: registry, options: options}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /encode", h.encode)
+	mux.HandleFunc("POST /count", h.count)
+	mux.HandleFunc("POST /decode", h.decode)
+	mux.HandleFunc("GET /models", h.models)
+	return mux
+}
+
+// requestError is answered with its status code.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...any) error {
+	return &requestError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func (h *handler) encode(w http.ResponseWriter, r *http.Request) {
+	var request EncodeRequest
+	encoding, texts, err := h.readEncodeRequest(w, r, &request)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if request.AllowSpecial {
+		encoding = allowSpecial(encoding)
+	}
+	maxTokens := math.MaxInt
+	if request.MaxTokens > 0 {
+		maxTokens = request.MaxTokens
+	}
+	results := make([]EncodeResult, len(texts))
+	err = protect(func() error {
+		for i, text := range texts {
+			result, err := encodeText(r.Context(), encoding, text, maxTokens, request.AllowSpecial)
+			if err != nil {
+				return err
+			}
+			results[i] = EncodeResult{Tokens: result.GetTokens(), Truncated: result.IsTruncated()}
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	response := EncodeResponse{Encoding: encoding.GetName()}
+	if request.Text != nil {
+		response.EncodeResult = &results[0]
+	} else {
+		response.Results = results
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *handler) count(w http.ResponseWriter, r *http.Request) {
+	var request EncodeRequest
+	encoding, texts, err := h.readEncodeRequest(w, r, &request)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if request.AllowSpecial {
+		encoding = allowSpecial(encoding)
+	}
+	counts := make([]int, len(texts))
+	err = protect(func() error {
+		for i, text := range texts {
+			count, err := countText(r.Context(), encoding, text, request.AllowSpecial)
+			if err != nil {
+				return err
+			}
+			counts[i] = count
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	response := CountResponse{Encoding: encoding.GetName()}
+	if request.Text != nil {
+		response.Count = &counts[0]
+	} else {
+		response.Counts = counts
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *handler) decode(w http.ResponseWriter, r *http.Request) {
+	var request DecodeRequest
+	if err := h.readJSON(w, r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	batch := request.Batch
+	switch {
+	case request.Tokens != nil && batch != nil:
+		writeError(w, badRequest("both tokens and batch are set"))
+		return
+	case request.Tokens != nil:
+		batch = [][]int{request.Tokens}
+	case batch == nil:
+		writeError(w, badRequest("tokens or batch is required"))
+		return
+	case len(batch) > h.options.MaxBatchSize:
+		writeError(w, &requestError{status: http.StatusRequestEntityTooLarge, message: fmt.Sprintf("batch of %d exceeds the limit of %d", len(batch), h.options.MaxBatchSize)})
+		return
+	}
+	encoding, err := h.resolve(request.Encoding, request.Model)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	for _, tokens := range batch {
+		for _, token := range tokens {
+			if !hasToken(encoding, token) {
+				writeError(w, badRequest("token %d is not in the vocabulary of %s", token, encoding.GetName()))
+				return
+			}
+		}
+	}
+	texts := make([]string, len(batch))
+	for i, tokens := range batch {
+		texts[i] = encoding.Decode(tokens)
+	}
+	response := DecodeResponse{Encoding: encoding.GetName()}
+	if request.Tokens != nil {
+		response.Text = &texts[0]
+	} else {
+		response.Texts = texts
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *handler) models(w http.ResponseWriter, r *http.Request) {
+	response := ModelsResponse{}
+	if named, ok := h.registry.(mod.NamedEncodingRegistry); ok {
+		response.Encodings = named.GetEncodingNames()
+	} else {
+		for _, encodingType := range mod.EncodingTypeValues() {
+			response.Encodings = append(response.Encodings, encodingType.GetName())
+		}
+	}
+	for _, model := range mod.ModelTypeValues() {
+		response.Models = append(response.Models, Model{
+			Name:             model.GetName(),
+			Encoding:         model.GetEncodingType().GetName(),
+			MaxContextLength: model.GetMaxContextLength(),
+		})
+	}
+	sort.Slice(response.Models, func(i, j int) bool {
+		return response.Models[i].Name < response.Models[j].Name
+	})
+	writeJSON(w, http.StatusOK, response)
+}
+
+// readEncodeRequest reads the body of /encode or /count and returns its encoding and texts.
+func (h *handler) readEncodeRequest(w http.ResponseWriter, r *http.Request, request *EncodeRequest) (mod.Encoding, []string, error) {
+	if err := h.readJSON(w, r, request); err != nil {
+		return nil, nil, err
+	}
+	texts := request.Texts
+	switch {
+	case request.Text != nil && texts != nil:
+		return nil, nil, badRequest("both text and texts are set")
+	case request.Text != nil:
+		texts = []string{*request.Text}
+	case texts == nil:
+		return nil, nil, badRequest("text or texts is required")
+	case len(texts) > h.options.MaxBatchSize:
+		return nil, nil, &requestError{status: http.StatusRequestEntityTooLarge, message: fmt.Sprintf("batch of %d exceeds the limit of %d", len(texts), h.options.MaxBatchSize)}
+	}
+	encoding, err := h.resolve(request.Encoding, request.Model)
+	return encoding, texts, err
+}
+
+// resolve looks up the encoding of model, or the encoding named encoding if model is empty.
+func (h *handler) resolve(encoding string, model string) (mod.Encoding, error) {
+	var resolved mod.Encoding
+	var err error
+	switch {
+	case model != "":
+		resolved, err = h.registry.GetEncodingForModel(model)
+	case encoding != "":
+		resolved, err = h.registry.GetEncoding(encoding)
+	default:
+		return nil, badRequest("encoding or model is required")
+	}
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return resolved, nil
+}
+
+// readJSON decodes the body of a request, at most MaxRequestBytes long, into v.
+func (h *handler) readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.options.MaxRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return &requestError{status: http.StatusRequestEntityTooLarge, message: fmt.Sprintf("request body exceeds the limit of %d bytes", maxBytesError.Limit)}
+		}
+		return badRequest("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// allowSpecial returns encoding with special tokens allowed if it supports that, encoding itself otherwise.
+func allowSpecial(encoding mod.Encoding) mod.Encoding {
+	if allowing, ok := encoding.(mod.AllowSpecialEncoding); ok {
+		return allowing.AllowSpecial()
+	}
+	return encoding
+}
+
+// encodeText encodes text, and gives up once the request is canceled if the encoding supports it.
+func encodeText(ctx context.Context, encoding mod.Encoding, text string, maxTokens int, allowSpecial bool) (*mod.EncodingResult, error) {
+	if contextEncoding, ok := encoding.(mod.ContextEncoding); ok {
+		if allowSpecial {
+			return contextEncoding.EncodeContext(ctx, text, maxTokens)
+		}
+		return contextEncoding.EncodeOrdinaryContext(ctx, text, maxTokens)
+	}
+	if allowSpecial {
+		return encoding.Encode(text, maxTokens), nil
+	}
+	return encoding.EncodeOrdinary(text, maxTokens), nil
+}
+
+// countText counts the tokens of text, and gives up once the request is canceled if the encoding supports it.
+func countText(ctx context.Context, encoding mod.Encoding, text string, allowSpecial bool) (int, error) {
+	if contextEncoding, ok := encoding.(mod.ContextEncoding); ok {
+		if allowSpecial {
+			return contextEncoding.CountTokensContext(ctx, text)
+		}
+		return contextEncoding.CountTokensOrdinaryContext(ctx, text)
+	}
+	if allowSpecial {
+		return encoding.CountTokens(text), nil
+	}
+	return encoding.CountTokensOrdinary(text), nil
+}
+
+// hasToken reports whether token is an id of encoding. Without a vocabulary to look it up in,
+// no token decodes to nothing but an unknown one.
+func hasToken(encoding mod.Encoding, token int) bool {
+	if vocabulary, ok := encoding.(mod.VocabularyEncoding); ok {
+		return vocabulary.HasToken(token)
+	}
+	return len(encoding.DecodeBytes([]int{token})) > 0
+}
+
+// protect runs f and turns the panic of a disallowed special token in a text into a bad request,
+// other panics are internal errors.
+func protect(f func() error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if recovered == encoder.SPECIAL_TOKENS_NOT_SUPPORTED {
+				err = badRequest("%v", recovered)
+			} else {
+				err = fmt.Errorf("internal error: %v", recovered)
+			}
+		}
+	}()
+	return f()
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var requestError *requestError
+	if errors.As(err, &requestError) {
+		status = requestError.status
+	} else if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,179 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/mod"
+	tokgo "github.com/currybab/tokgo/registry"
+	"github.com/currybab/tokgo/server"
+	"github.com/stretchr/testify/assert"
+)
+
+var handler = server.NewHandler(tokgo.NewLazyEncodingRegistry(), server.Options{MaxRequestBytes: 1024, MaxBatchSize: 3})
+
+func post(t *testing.T, path string, body string) (int, map[string]any) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var response map[string]any
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return recorder.Code, response
+}
+
+func TestEncode(t *testing.T) {
+	code, response := post(t, "/encode", `{"model": "gpt-4o", "text": "hello"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"encoding": "o200k_base", "tokens": []any{24912.0}}, response)
+
+	code, response = post(t, "/encode", `{"encoding": "cl100k_base", "texts": ["hello world", ""], "max_tokens": 1}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"encoding": "cl100k_base", "results": []any{
+		map[string]any{"tokens": []any{15339.0}, "truncated": true},
+		map[string]any{"tokens": []any{}},
+	}}, response)
+}
+
+func TestEncodeSpecialTokens(t *testing.T) {
+	code, response := post(t, "/encode", `{"encoding": "cl100k_base", "text": "<|endoftext|>"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["tokens"], 7)
+
+	// the request allows special tokens although the registry disallows them
+	code, response = post(t, "/encode", `{"encoding": "cl100k_base", "text": "<|endoftext|>", "allow_special": true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []any{100257.0}, response["tokens"])
+	code, response = post(t, "/count", `{"model": "gpt-4o", "text": "<|endoftext|>", "allow_special": true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1.0, response["count"])
+
+	// and the registry allowing special tokens doesn't allow them in requests that don't
+	allowed := server.NewHandler(tokgo.NewLazyEncodingRegistry(encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed)), server.Options{})
+	recorder := httptest.NewRecorder()
+	allowed.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/count", strings.NewReader(`{"encoding": "cl100k_base", "text": "<|endoftext|>"}`)))
+	assert.JSONEq(t, `{"encoding": "cl100k_base", "count": 7}`, recorder.Body.String())
+
+	// an encoding that can't allow special tokens keeps its policy
+	registry := tokgo.NewLazyEncodingRegistry()
+	_, err := registry.RegisterCustomEncoding(brokenEncoding{encoding.Cl100kBase()})
+	assert.NoError(t, err)
+	recorder = httptest.NewRecorder()
+	server.NewHandler(registry, server.Options{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/encode", strings.NewReader(`{"encoding": "broken", "text": "<|endoftext|>", "allow_special": true}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.JSONEq(t, `{"error": "Encoding special tokens is not supported."}`, recorder.Body.String())
+}
+
+func TestCount(t *testing.T) {
+	code, response := post(t, "/count", `{"encoding": "r50k_base", "texts": ["hello world", "a"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"encoding": "r50k_base", "counts": []any{2.0, 1.0}}, response)
+
+	code, response = post(t, "/count", `{"model": "gpt-4", "text": ""}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"encoding": "cl100k_base", "count": 0.0}, response)
+}
+
+func TestCanceledRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest(http.MethodPost, "/count", strings.NewReader(`{"encoding": "cl100k_base", "text": "hello"}`)).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.JSONEq(t, `{"error": "context canceled"}`, recorder.Body.String())
+}
+
+func TestDecode(t *testing.T) {
+	code, response := post(t, "/decode", `{"encoding": "cl100k_base", "tokens": [15339, 1917]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"encoding": "cl100k_base", "text": "hello world"}, response)
+
+	code, response = post(t, "/decode", `{"model": "gpt-4o", "batch": [[24912], []]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"encoding": "o200k_base", "texts": []any{"hello", ""}}, response)
+}
+
+// brokenEncoding panics when it counts tokens, and has no vocabulary to look tokens up in.
+type brokenEncoding struct {
+	mod.Encoding
+}
+
+func (brokenEncoding) GetName() string {
+	return "broken"
+}
+
+func (brokenEncoding) CountTokensOrdinary(text string) int {
+	panic("index out of range")
+}
+
+func TestInternalErrors(t *testing.T) {
+	registry := tokgo.NewLazyEncodingRegistry()
+	_, err := registry.RegisterCustomEncoding(brokenEncoding{encoding.Cl100kBase()})
+	assert.NoError(t, err)
+	handler := server.NewHandler(registry, server.Options{})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/count", strings.NewReader(`{"encoding": "broken", "text": "hello"}`)))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.JSONEq(t, `{"error": "internal error: index out of range"}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/decode", strings.NewReader(`{"encoding": "broken", "batch": [[15339], [100256]]}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.JSONEq(t, `{"error": "token 100256 is not in the vocabulary of broken"}`, recorder.Body.String())
+}
+
+func TestModels(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/models", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response server.ModelsResponse
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Contains(t, response.Encodings, "o200k_base")
+	assert.Contains(t, response.Models, server.Model{Name: "gpt-4o", Encoding: "o200k_base", MaxContextLength: 128000})
+
+	registry := tokgo.NewLazyEncodingRegistry()
+	_, err := tokgo.RegisterDerivedEncoding(registry, "cl100k_base", "cl100k_im", map[string]int{"<|im_start|>": 100264}, nil)
+	assert.NoError(t, err)
+	recorder = httptest.NewRecorder()
+	server.NewHandler(registry, server.Options{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/models", nil))
+	response = server.ModelsResponse{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, []string{"cl100k_base", "cl100k_im", "o200k_base", "o200k_harmony", "p50k_base", "p50k_edit", "r50k_base"}, response.Encodings)
+}
+
+func TestErrors(t *testing.T) {
+	for _, test := range []struct {
+		path   string
+		body   string
+		status int
+		error  string
+	}{
+		{"/encode", `{"text": "hi"}`, http.StatusBadRequest, "encoding or model is required"},
+		{"/encode", `{"encoding": "nope", "text": "hi"}`, http.StatusBadRequest, "encoding nope not found"},
+		{"/encode", `{"encoding": "cl100k_base"}`, http.StatusBadRequest, "text or texts is required"},
+		{"/count", `{"encoding": "cl100k_base", "text": "a", "texts": ["b"]}`, http.StatusBadRequest, "both text and texts are set"},
+		{"/count", `{"encoding": "cl100k_base", "texts": ["a", "b", "c", "d"]}`, http.StatusRequestEntityTooLarge, "batch of 4 exceeds the limit of 3"},
+		{"/count", `{"encoding": "cl100k_base", "text": "` + strings.Repeat("a", 2000) + `"}`, http.StatusRequestEntityTooLarge, "request body exceeds the limit of 1024 bytes"},
+		{"/count", `{"encoding": "cl100k_base", "txt": "a"}`, http.StatusBadRequest, `invalid request body: json: unknown field "txt"`},
+		{"/decode", `{"encoding": "cl100k_base"}`, http.StatusBadRequest, "tokens or batch is required"},
+		{"/decode", `{"encoding": "cl100k_base", "batch": [[1], [2], [3], [4]]}`, http.StatusRequestEntityTooLarge, "batch of 4 exceeds the limit of 3"},
+		{"/decode", `{"encoding": "cl100k_base", "batch": [[15339], [100256]]}`, http.StatusBadRequest, "token 100256 is not in the vocabulary of cl100k_base"},
+		{"/decode", `{"encoding": "r50k_base", "tokens": [-1]}`, http.StatusBadRequest, "token -1 is not in the vocabulary of r50k_base"},
+	} {
+		code, response := post(t, test.path, test.body)
+		assert.Equal(t, test.status, code, test.body)
+		assert.Equal(t, test.error, response["error"], test.body)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/encode", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
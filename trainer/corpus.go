@@ -0,0 +1,193 @@
+package trainer
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	regexp "github.com/dlclark/regexp2"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/parser"
+)
+
+const (
+	readBlockBytes = 64 * 1024
+	// chunkBytes is the size from which the corpus is pre-tokenized in chunks instead of as a whole.
+	chunkBytes = 1024 * 1024
+	// maxPendingBytes is the size at which a chunk is cut before its last piece if it has no line ending to cut at,
+	// for patterns that are cut at line endings.
+	maxPendingBytes = 4 * chunkBytes
+	// tailBytes is the end of a chunk that is pre-tokenized to find its last piece.
+	tailBytes = 64 * 1024
+)
+
+// pieceCounter counts the pre-tokenized pieces of a corpus.
+type pieceCounter struct {
+	pattern       *regexp.Regexp
+	specialTokens []string
+	counts        map[string]int
+	splitter      parser.Splitter
+	// cutsAtLineEnds is whether chunks may end right before a line ending, see encoding.CutsAtLineEnds.
+	cutsAtLineEnds bool
+}
+
+func newPieceCounter(pattern *regexp.Regexp, specialTokens []string) *pieceCounter {
+	return &pieceCounter{
+		pattern:        pattern,
+		specialTokens:  specialTokens,
+		counts:         map[string]int{},
+		cutsAtLineEnds: encoding.CutsAtLineEnds(pattern),
+	}
+}
+
+// addReader counts the pieces of everything read from reader. Large inputs are split into chunks, see cut.
+func (p *pieceCounter) addReader(reader io.Reader) error {
+	var pending []byte
+	block := make([]byte, readBlockBytes)
+	for {
+		n, err := reader.Read(block)
+		pending = append(pending, block[:n]...)
+		if len(pending) >= chunkBytes {
+			if cut := p.cut(pending); cut > 0 {
+				p.addText(string(pending[:cut]))
+				pending = append(pending[:0], pending[cut:]...)
+			}
+		}
+		if err == io.EOF {
+			p.addText(string(pending))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cut returns where pending can be split into chunks, 0 if it should be read further. Chunks end right before
+// a line ending that follows an ASCII letter or digit if the pattern allows it, see encoding.CutsAtLineEnds,
+// and before their last piece otherwise or once they reach maxPendingBytes without such a line ending.
+// That piece is carried over and pre-tokenized again with the text that follows it.
+// Chunks are never cut inside a special token.
+func (p *pieceCounter) cut(pending []byte) int {
+	cut := -1
+	if p.cutsAtLineEnds {
+		cut = encoding.LastLineEndCut(pending)
+	}
+	if cut <= 0 && (!p.cutsAtLineEnds || len(pending) >= maxPendingBytes) {
+		cut = p.lastPieceStart(pending)
+	}
+	if cut <= 0 {
+		return 0
+	}
+	return p.cutOutsideSpecialTokens(pending, cut)
+}
+
+// lastPieceStart returns where the last piece of data starts, pre-tokenizing only its end. If the
+// whole end is a single piece, it is cut at a character boundary so that pending stays bounded.
+func (p *pieceCounter) lastPieceStart(data []byte) int {
+	start := len(data) - tailBytes
+	for start < len(data) && !utf8.RuneStart(data[start]) {
+		start++
+	}
+	last, offset := 0, 0
+	p.eachPiece(string(data[start:]), func(piece string) {
+		last = offset
+		offset += len(piece)
+	})
+	// the last piece may be the first byte of a character that was only partly read
+	cut := start + last
+	for cut > start && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+	return cut
+}
+
+// cutOutsideSpecialTokens moves cut to the start of a special token it would split, including a
+// token at the end of data that is only partly read.
+func (p *pieceCounter) cutOutsideSpecialTokens(data []byte, cut int) int {
+	for moved := true; moved; {
+		moved = false
+		for _, token := range p.specialTokens {
+			for start := max(cut-len(token)+1, 0); start < cut; start++ {
+				end := min(start+len(token), len(data))
+				if string(data[start:end]) == token[:end-start] {
+					cut, moved = start, true
+					break
+				}
+			}
+		}
+	}
+	return cut
+}
+
+// addText counts the pieces of text between the special tokens, the special tokens themselves aren't learned.
+func (p *pieceCounter) addText(text string) {
+	for text != "" {
+		index, length := p.nextSpecialToken(text)
+		if index < 0 {
+			p.addOrdinaryText(text)
+			return
+		}
+		p.addOrdinaryText(text[:index])
+		text = text[index+length:]
+	}
+}
+
+func (p *pieceCounter) nextSpecialToken(text string) (int, int) {
+	index, length := -1, 0
+	for _, token := range p.specialTokens {
+		if i := strings.Index(text, token); i >= 0 && (index < 0 || i < index || (i == index && len(token) > length)) {
+			index, length = i, len(token)
+		}
+	}
+	return index, length
+}
+
+func (p *pieceCounter) addOrdinaryText(text string) {
+	p.eachPiece(text, func(piece string) {
+		p.counts[piece]++
+	})
+}
+
+// eachPiece calls yield with the pieces of text in order. Like the encoders do, every byte that
+// isn't part of a valid UTF-8 sequence is a piece of its own and the valid text around it is split apart.
+func (p *pieceCounter) eachPiece(text string, yield func(piece string)) {
+	for text != "" {
+		valid := encoding.ValidUtf8PrefixLength(text)
+		if valid == 0 {
+			yield(text[:1])
+			text = text[1:]
+			continue
+		}
+		p.eachValidPiece(text[:valid], yield)
+		text = text[valid:]
+	}
+}
+
+func (p *pieceCounter) eachValidPiece(text string, yield func(piece string)) {
+	if p.pattern == nil {
+		p.splitter.Split(text, func(piece []byte) bool {
+			yield(string(piece))
+			return false
+		})
+		return
+	}
+
+	match, _ := p.pattern.FindStringMatch(text)
+	for match != nil {
+		yield(match.String())
+		match, _ = p.pattern.FindNextMatch(match)
+	}
+}
+
+// sortedPieces returns the counted pieces sorted, for a deterministic training order.
+func (p *pieceCounter) sortedPieces() []string {
+	pieces := make([]string, 0, len(p.counts))
+	for piece := range p.counts {
+		pieces = append(pieces, piece)
+	}
+	sort.Strings(pieces)
+	return pieces
+}
@@ -0,0 +1,30 @@
+package trainer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	regexp "github.com/dlclark/regexp2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddReaderCountsTheSamePiecesAsTheWholeText(t *testing.T) {
+	var lines strings.Builder
+	for i := 0; lines.Len() < 3*chunkBytes; i++ {
+		fmt.Fprintf(&lines, "line %d of the corpus\n", i)
+	}
+	corpus := lines.String()
+
+	for name, pattern := range map[string]*regexp.Regexp{
+		"cl100k splitter": nil,
+		// a piece ends with its line ending, so cutting right before line endings would change the pieces
+		"custom pattern": regexp.MustCompile(`[^\n]*\n|[^\n]+`, regexp.None),
+	} {
+		whole := newPieceCounter(pattern, nil)
+		whole.addText(corpus)
+		chunked := newPieceCounter(pattern, nil)
+		assert.NoError(t, chunked.addReader(strings.NewReader(corpus)))
+		assert.Equal(t, whole.counts, chunked.counts, name)
+	}
+}
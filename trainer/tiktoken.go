@@ -0,0 +1,27 @@
+package trainer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// WriteTiktoken writes ranks in the .tiktoken format, ordered by rank, which encoding.ReadMergeableRanks reads back.
+func WriteTiktoken(w io.Writer, ranks map[string]int) error {
+	tokens := make([]string, 0, len(ranks))
+	for token := range ranks {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return ranks[tokens[i]] < ranks[tokens[j]] })
+
+	writer := bufio.NewWriter(w)
+	for _, token := range tokens {
+		writer.WriteString(base64.StdEncoding.EncodeToString([]byte(token)))
+		writer.WriteByte(' ')
+		writer.WriteString(strconv.Itoa(ranks[token]))
+		writer.WriteByte('\n')
+	}
+	return writer.Flush()
+}
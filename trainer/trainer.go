@@ -0,0 +1,233 @@
+// Package trainer learns byte pair encoding ranks from a corpus. The trained parameters
+// plug into encoding.FromParameters like the built-in encodings.
+package trainer
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+
+	regexp "github.com/dlclark/regexp2"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// byteTokenCount is the number of single byte tokens every vocabulary starts with.
+const byteTokenCount = 256
+
+// Config configures Train.
+type Config struct {
+	// Name of the trained encoding.
+	Name string
+	// Pattern splits the corpus into pieces before merging. If nil, the cl100k splitter of
+	// the parser package is used, which the encoders also use for parameters without a pattern.
+	Pattern *regexp.Regexp
+	// VocabSize is the number of mergeable ranks including the 256 single bytes, special tokens aren't counted.
+	// Training stops earlier if no pair is left to merge.
+	VocabSize int
+	// SpecialTokens get the ids following the mergeable ranks, in order. They are cut out of the corpus before training.
+	SpecialTokens []string
+	// MinFrequency is the number of occurrences a pair needs to be merged, every pair can be merged if zero.
+	MinFrequency int
+}
+
+// Train learns the mergeable ranks of a byte pair encoding from the corpus. Rank i is the i-th merge,
+// after the single bytes which have their value as rank, so the ranks are compatible with encoder.TokenEncoder.
+func Train(config Config, corpus ...io.Reader) (*mod.GptBytePairEncodingParams, error) {
+	if config.VocabSize < byteTokenCount {
+		return nil, fmt.Errorf("vocab size %d is smaller than the %d single byte tokens", config.VocabSize, byteTokenCount)
+	}
+	for _, token := range config.SpecialTokens {
+		if token == "" {
+			return nil, errors.New("special tokens must not be empty")
+		}
+	}
+
+	pieces := newPieceCounter(config.Pattern, config.SpecialTokens)
+	for _, reader := range corpus {
+		if err := pieces.addReader(reader); err != nil {
+			return nil, err
+		}
+	}
+
+	ranks := newMerger(pieces).merge(config.VocabSize, max(config.MinFrequency, 1))
+
+	specialTokens := make(map[string]int, len(config.SpecialTokens))
+	for _, token := range config.SpecialTokens {
+		if _, exists := specialTokens[token]; !exists {
+			specialTokens[token] = len(ranks) + len(specialTokens)
+		}
+	}
+	return mod.NewGptBytePairEncodingParams(config.Name, config.Pattern, ranks, specialTokens), nil
+}
+
+// word is a distinct piece of the corpus as a sequence of token ids.
+type word struct {
+	symbols []int32
+	count   int
+}
+
+// pairKey packs two adjacent token ids.
+type pairKey uint64
+
+func newPairKey(left, right int32) pairKey {
+	return pairKey(uint64(uint32(left))<<32 | uint64(uint32(right)))
+}
+
+func (k pairKey) split() (int32, int32) {
+	return int32(uint32(k >> 32)), int32(uint32(k))
+}
+
+type pairCandidate struct {
+	count int
+	pair  pairKey
+}
+
+// pairHeap orders candidates by descending count, ties are merged in the order of their ids.
+type pairHeap []pairCandidate
+
+func (h pairHeap) Len() int { return len(h) }
+func (h pairHeap) Less(i, j int) bool {
+	return h[i].count > h[j].count || (h[i].count == h[j].count && h[i].pair < h[j].pair)
+}
+func (h pairHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pairHeap) Push(x any)   { *h = append(*h, x.(pairCandidate)) }
+func (h *pairHeap) Pop() any {
+	old := *h
+	candidate := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return candidate
+}
+
+// merger keeps the pair counts up to date while merging, so that every merge only revisits
+// the words containing the merged pair instead of recounting the corpus.
+// Candidates are not removed from the heap when a count changes, instead the new count is pushed
+// and outdated candidates are skipped when popped.
+type merger struct {
+	tokens     [][]byte
+	ranks      map[string]int
+	words      []word
+	pairCounts map[pairKey]int
+	pairWords  map[pairKey][]int32 // may contain duplicates and words which lost the pair
+	candidates pairHeap
+	visited    []int
+}
+
+func newMerger(pieces *pieceCounter) *merger {
+	m := &merger{
+		tokens:     make([][]byte, byteTokenCount),
+		ranks:      make(map[string]int, byteTokenCount),
+		pairCounts: map[pairKey]int{},
+		pairWords:  map[pairKey][]int32{},
+	}
+	for i := range m.tokens {
+		m.tokens[i] = []byte{byte(i)}
+		m.ranks[string(m.tokens[i])] = i
+	}
+
+	for _, piece := range pieces.sortedPieces() {
+		if len(piece) < 2 {
+			continue
+		}
+		symbols := make([]int32, len(piece))
+		for i := 0; i < len(piece); i++ {
+			symbols[i] = int32(piece[i])
+		}
+		index := int32(len(m.words))
+		m.words = append(m.words, word{symbols: symbols, count: pieces.counts[piece]})
+		for i := 0; i+1 < len(symbols); i++ {
+			pair := newPairKey(symbols[i], symbols[i+1])
+			m.pairCounts[pair] += pieces.counts[piece]
+			m.pairWords[pair] = append(m.pairWords[pair], index)
+		}
+	}
+	m.visited = make([]int, len(m.words))
+
+	m.candidates = make(pairHeap, 0, len(m.pairCounts))
+	for pair, count := range m.pairCounts {
+		m.candidates = append(m.candidates, pairCandidate{count: count, pair: pair})
+	}
+	heap.Init(&m.candidates)
+	return m
+}
+
+// merge merges the most frequent pair until there are vocabSize tokens and returns their ranks.
+func (m *merger) merge(vocabSize int, minFrequency int) map[string]int {
+	for step := 1; len(m.tokens) < vocabSize && m.candidates.Len() > 0; step++ {
+		candidate := heap.Pop(&m.candidates).(pairCandidate)
+		if m.pairCounts[candidate.pair] != candidate.count {
+			continue // outdated
+		}
+		if candidate.count < minFrequency {
+			break
+		}
+		m.mergePair(candidate.pair, step)
+	}
+	return m.ranks
+}
+
+func (m *merger) mergePair(pair pairKey, step int) {
+	left, right := pair.split()
+	mergedBytes := append(append([]byte{}, m.tokens[left]...), m.tokens[right]...)
+	// different merge orders can produce the same bytes, they share the token
+	rank, exists := m.ranks[string(mergedBytes)]
+	if !exists {
+		rank = len(m.tokens)
+		m.tokens = append(m.tokens, mergedBytes)
+		m.ranks[string(mergedBytes)] = rank
+	}
+	mergedToken := int32(rank)
+
+	deltas := map[pairKey]int{}
+	for _, index := range m.pairWords[pair] {
+		if m.visited[index] == step {
+			continue
+		}
+		m.visited[index] = step
+
+		w := &m.words[index]
+		symbols := w.symbols
+		for i := 0; i+1 < len(symbols); i++ {
+			deltas[newPairKey(symbols[i], symbols[i+1])] -= w.count
+		}
+		replaced := replacePair(symbols, left, right, mergedToken)
+		for i := 0; i+1 < len(replaced); i++ {
+			newPair := newPairKey(replaced[i], replaced[i+1])
+			deltas[newPair] += w.count
+			if replaced[i] == mergedToken || replaced[i+1] == mergedToken {
+				m.pairWords[newPair] = append(m.pairWords[newPair], index)
+			}
+		}
+		w.symbols = replaced
+	}
+	delete(m.pairWords, pair)
+
+	for changed, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		count := m.pairCounts[changed] + delta
+		if count <= 0 {
+			delete(m.pairCounts, changed)
+			continue
+		}
+		m.pairCounts[changed] = count
+		heap.Push(&m.candidates, pairCandidate{count: count, pair: changed})
+	}
+}
+
+// replacePair replaces the occurrences of left and right from left to right in place.
+func replacePair(symbols []int32, left, right, merged int32) []int32 {
+	out := symbols[:0]
+	for i := 0; i < len(symbols); {
+		if i+1 < len(symbols) && symbols[i] == left && symbols[i+1] == right {
+			out = append(out, merged)
+			i += 2
+		} else {
+			out = append(out, symbols[i])
+			i++
+		}
+	}
+	return out
+}
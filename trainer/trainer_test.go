@@ -0,0 +1,152 @@
+package trainer_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	regexp "github.com/dlclark/regexp2"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/trainer"
+	"github.com/stretchr/testify/assert"
+)
+
+const CORPUS = `The quick brown fox jumps over the lazy dog.
+The lazy dog sleeps while the quick fox runs.
+<|endoftext|>let x = map(filter(items, is_valid), to_string)
+let y = map(filter(values, is_valid), to_string)
+`
+
+func repeatedCorpus(n int) string {
+	return strings.Repeat(CORPUS, n)
+}
+
+func TestTrainLearnsFrequentPieces(t *testing.T) {
+	params, err := trainer.Train(trainer.Config{
+		Name:          "dsl",
+		VocabSize:     320,
+		SpecialTokens: []string{"<|endoftext|>", "<|pad|>"},
+	}, strings.NewReader(repeatedCorpus(10)))
+	assert.NoError(t, err)
+
+	ranks := params.GetEncoder()
+	assert.Equal(t, "dsl", params.GetName())
+	assert.Len(t, ranks, 320)
+	for i := 0; i < 256; i++ {
+		assert.Equal(t, i, ranks[string([]byte{byte(i)})])
+	}
+	seen := make([]bool, len(ranks))
+	for _, rank := range ranks {
+		seen[rank] = true
+	}
+	assert.NotContains(t, seen, false, "ranks must be contiguous")
+	assert.Contains(t, ranks, " quick")
+	assert.Contains(t, ranks, "_valid")
+	assert.NotContains(t, ranks, "<|endoftext|>")
+	assert.Equal(t, map[string]int{"<|endoftext|>": 320, "<|pad|>": 321}, params.GetSpecialTokensEncoder())
+
+	enc := encoding.FromParameters(params, encoding.WithSpecialTokenPolicy(encoding.SpecialTokensAllowed))
+	for _, text := range []string{CORPUS, "A new sentence the fox hasn't seen, 你好 🌍"} {
+		assert.Equal(t, text, enc.Decode(enc.EncodeToIntArray(text)))
+	}
+	assert.Equal(t, []int{ranks[" quick"]}, enc.EncodeOrdinaryToIntArray(" quick"))
+	assert.Equal(t, 320, enc.EncodeToIntArray("<|endoftext|>")[0])
+}
+
+func TestTrainWithPattern(t *testing.T) {
+	pattern := regexp.MustCompile(`'(?:[sdmt]|ll|ve|re)| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`, regexp.None)
+	params, err := trainer.Train(trainer.Config{Name: "dsl", Pattern: pattern, VocabSize: 300}, strings.NewReader(repeatedCorpus(5)))
+	assert.NoError(t, err)
+
+	enc := encoding.FromParameters(params)
+	assert.Equal(t, CORPUS, enc.Decode(enc.EncodeOrdinaryToIntArray(CORPUS)))
+	assert.Contains(t, params.GetEncoder(), " lazy")
+	assert.NotContains(t, params.GetEncoder(), ".\n", "the pattern separates punctuation and whitespace")
+}
+
+func TestTrainStopsAtMinFrequency(t *testing.T) {
+	params, err := trainer.Train(trainer.Config{VocabSize: 100_000, MinFrequency: 5}, strings.NewReader(repeatedCorpus(4)))
+	assert.NoError(t, err)
+	assert.Less(t, len(params.GetEncoder()), 100_000)
+	assert.Greater(t, len(params.GetEncoder()), 256)
+
+	params, err = trainer.Train(trainer.Config{VocabSize: 100_000, MinFrequency: 5}, strings.NewReader(repeatedCorpus(5)))
+	assert.NoError(t, err)
+	assert.Contains(t, params.GetEncoder(), " quick")
+}
+
+func TestTrainReadsLargeCorporaInChunks(t *testing.T) {
+	var lines []string
+	for i := 0; len(lines) < 60_000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d of the corpus: value_%d = %d", i, i%97, i*31))
+	}
+	corpus := strings.Join(lines, "\n")
+	assert.Greater(t, len(corpus), 2*1024*1024)
+
+	config := trainer.Config{VocabSize: 400}
+	whole, err := trainer.Train(config, strings.NewReader(corpus))
+	assert.NoError(t, err)
+
+	// cutting right before a line ending that follows a digit doesn't change any piece
+	var readers []io.Reader
+	for i := 0; i < len(lines); i += 1000 {
+		part := strings.Join(lines[i:min(i+1000, len(lines))], "\n")
+		if i > 0 {
+			part = "\n" + part
+		}
+		readers = append(readers, strings.NewReader(part))
+	}
+	parts, err := trainer.Train(config, readers...)
+	assert.NoError(t, err)
+	assert.Equal(t, whole.GetEncoder(), parts.GetEncoder())
+}
+
+func TestTrainSplitsTextAtInvalidBytes(t *testing.T) {
+	params, err := trainer.Train(trainer.Config{VocabSize: 1000}, strings.NewReader("ab\xffab ab\xfe"))
+	assert.NoError(t, err)
+
+	ranks := params.GetEncoder()
+	assert.Contains(t, ranks, "ab")
+	assert.NotContains(t, ranks, "abab", "the invalid byte separates the pieces")
+	enc := encoding.FromParameters(params)
+	assert.Equal(t, []int{ranks["ab"], 0xff, ranks["ab"], ranks[" ab"], 0xfe}, enc.EncodeOrdinaryToIntArray("ab\xffab ab\xfe"))
+}
+
+func TestTrainCutsLongLinesOutsideSpecialTokens(t *testing.T) {
+	// no line ending to cut at, and every cut before the last piece would split a special token
+	corpus := strings.Repeat("<|endoftext|>", 5*1024*1024/len("<|endoftext|>"))
+	params, err := trainer.Train(trainer.Config{VocabSize: 1000, SpecialTokens: []string{"<|endoftext|>"}}, strings.NewReader(corpus))
+	assert.NoError(t, err)
+	assert.Len(t, params.GetEncoder(), 256, "no piece of a special token is learned")
+
+	line := strings.Repeat("words without a line ending, ", 200_000)
+	assert.Greater(t, len(line), 4*1024*1024)
+	whole, err := trainer.Train(trainer.Config{VocabSize: 300}, strings.NewReader(line))
+	assert.NoError(t, err)
+	assert.Contains(t, whole.GetEncoder(), " without")
+	enc := encoding.FromParameters(whole)
+	assert.Equal(t, line, enc.Decode(enc.EncodeOrdinaryToIntArray(line)))
+}
+
+func TestTrainRejectsSmallVocab(t *testing.T) {
+	_, err := trainer.Train(trainer.Config{VocabSize: 255}, strings.NewReader(CORPUS))
+	assert.Error(t, err)
+}
+
+func TestWriteTiktokenRoundTrips(t *testing.T) {
+	params, err := trainer.Train(trainer.Config{VocabSize: 300}, strings.NewReader(repeatedCorpus(5)))
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	assert.NoError(t, trainer.WriteTiktoken(&buffer, params.GetEncoder()))
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	assert.Len(t, lines, 300)
+	assert.Equal(t, "AA== 0", lines[0])
+
+	ranks, err := encoding.ReadMergeableRanks(&buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, params.GetEncoder(), ranks)
+}
@@ -0,0 +1,107 @@
+// Package visualize renders the token boundaries of a text, for terminals (ANSI) and for web pages (HTML).
+package visualize
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/currybab/tokgo/mod"
+)
+
+// Segment is a single token of a text together with the bytes it decodes to.
+type Segment struct {
+	Token int
+	Bytes []byte
+}
+
+// Partial reports whether the token is only a part of a multibyte character.
+func (s Segment) Partial() bool {
+	return !utf8.Valid(s.Bytes)
+}
+
+// Label returns the text of the token with whitespace made visible and the bytes
+// that aren't a complete character on their own escaped as \xNN.
+// A line ending is shown as a marker followed by the line ending itself.
+func (s Segment) Label() string {
+	var builder strings.Builder
+	for rest := s.Bytes; len(rest) > 0; {
+		r, size := utf8.DecodeRune(rest)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&builder, "\\x%02x", rest[0])
+		case r == ' ':
+			builder.WriteString("·")
+		case r == '\t':
+			builder.WriteString("→")
+		case r == '\r':
+			builder.WriteString("␍")
+		case r == '\n':
+			builder.WriteString("↵\n")
+		default:
+			builder.WriteRune(r)
+		}
+		rest = rest[size:]
+	}
+	return builder.String()
+}
+
+// Segments encodes text, treating special tokens as ordinary text, and returns one segment per token.
+func Segments(encoding mod.Encoding, text string) []Segment {
+	tokens := encoding.EncodeOrdinaryToIntArray(text)
+	segments := make([]Segment, len(tokens))
+	for i, token := range tokens {
+		segments[i] = Segment{Token: token, Bytes: encoding.DecodeBytes([]int{token})}
+	}
+	return segments
+}
+
+// ansiBackgrounds are 256 colour palette backgrounds that stay readable with black text.
+var ansiBackgrounds = []int{153, 157, 223, 218, 189}
+
+// htmlBackgrounds are the same colours as ansiBackgrounds.
+var htmlBackgrounds = []string{"#afd7ff", "#afffaf", "#ffd7af", "#ffafd7", "#d7d7ff"}
+
+// WriteANSI writes text to w with alternating background colours per token.
+func WriteANSI(w io.Writer, encoding mod.Encoding, text string) error {
+	var builder strings.Builder
+	for i, segment := range Segments(encoding, text) {
+		colour := fmt.Sprintf("\x1b[30;48;5;%dm", ansiBackgrounds[i%len(ansiBackgrounds)])
+		// reset the colour before line endings so that it doesn't fill the rest of the line
+		lines := strings.Split(segment.Label(), "\n")
+		for j, line := range lines {
+			if j > 0 {
+				builder.WriteString("\n")
+			}
+			if line != "" {
+				builder.WriteString(colour)
+				builder.WriteString(line)
+				builder.WriteString("\x1b[0m")
+			}
+		}
+	}
+	builder.WriteString("\n")
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// WriteHTML writes text to w as an HTML fragment with a span per token.
+// The spans alternate their background colour, have the class tokgo-token (and tokgo-partial
+// for parts of a multibyte character) and show the token id as a tooltip.
+func WriteHTML(w io.Writer, encoding mod.Encoding, text string) error {
+	var builder strings.Builder
+	builder.WriteString(`<pre class="tokgo">`)
+	for i, segment := range Segments(encoding, text) {
+		class := "tokgo-token"
+		if segment.Partial() {
+			class += " tokgo-partial"
+		}
+		fmt.Fprintf(&builder, `<span class="%s" style="background-color:%s" title="%d">%s</span>`,
+			class, htmlBackgrounds[i%len(htmlBackgrounds)], segment.Token, html.EscapeString(segment.Label()))
+	}
+	builder.WriteString("</pre>\n")
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
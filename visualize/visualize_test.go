@@ -0,0 +1,47 @@
+package visualize_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/currybab/tokgo/encoding"
+	"github.com/currybab/tokgo/visualize"
+	"github.com/stretchr/testify/assert"
+)
+
+var cl100k = encoding.Cl100kBase()
+
+func TestSegmentsDecodeToText(t *testing.T) {
+	text := "Hello  wörld 🌍\n<|endoftext|>"
+	var builder strings.Builder
+	for _, segment := range visualize.Segments(cl100k, text) {
+		builder.Write(segment.Bytes)
+	}
+	assert.Equal(t, text, builder.String())
+}
+
+func TestLabelShowsWhitespaceAndPartialBytes(t *testing.T) {
+	assert.Equal(t, "·a→b␍↵\n", visualize.Segment{Bytes: []byte(" a\tb\r\n")}.Label())
+	assert.Equal(t, "·\\xf0\\x9f", visualize.Segment{Bytes: []byte(" \xf0\x9f")}.Label())
+	assert.True(t, visualize.Segment{Bytes: []byte("\x8c")}.Partial())
+	assert.False(t, visualize.Segment{Bytes: []byte("🌍")}.Partial())
+}
+
+func TestWriteANSI(t *testing.T) {
+	var builder strings.Builder
+	assert.NoError(t, visualize.WriteANSI(&builder, cl100k, "Hello world\nbye"))
+	assert.Equal(t,
+		"\x1b[30;48;5;153mHello\x1b[0m\x1b[30;48;5;157m·world\x1b[0m\x1b[30;48;5;223m↵\x1b[0m\n\x1b[30;48;5;218mbye\x1b[0m\n",
+		builder.String())
+}
+
+func TestWriteHTML(t *testing.T) {
+	var builder strings.Builder
+	assert.NoError(t, visualize.WriteHTML(&builder, cl100k, "<b> 🌍"))
+
+	html := builder.String()
+	assert.True(t, strings.HasPrefix(html, `<pre class="tokgo"><span class="tokgo-token" style="background-color:#afd7ff" title="34277">&lt;b</span>`), html)
+	assert.Contains(t, html, `class="tokgo-token tokgo-partial"`)
+	assert.Contains(t, html, `\xf0\x9f`)
+	assert.True(t, strings.HasSuffix(html, "</pre>\n"))
+}